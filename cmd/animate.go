@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var Animation = pkg.AnimationConfig{
+	Format:       pkg.AnimationFormatGIF,
+	Width:        800,
+	Height:       800,
+	FPS:          10,
+	Speed:        4,
+	TrailSeconds: 5,
+}
+
+var animateCmd = &cobra.Command{
+	Use:   "animate",
+	Short: "Renders laps as cars moving along the track into an animated gif or png frames",
+	Long: `Renders laps as cars moving along the track into an animated gif or png frames.
+Every car leaves a trail, the overlay shows its lap time, speed and the delta to the first car at the same distance.
+Given one input file, the two fastest valid laps are animated, given several, the fastest lap of each.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := Animation
+		config.DataConfig = newDataConfig()
+		config.InputFiles = inputFiles()
+		config.OutputFile = OutputFile
+
+		if err := pkg.Animate(config); err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(animateCmd)
+	animateCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (gif), the prefix of the numbered frames for png")
+	_ = animateCmd.MarkFlagRequired("outputFile")
+	animateCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
+	animateCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS data with accelerometer information")
+	addTrackFlags(animateCmd)
+
+	flags := animateCmd.Flags()
+	flags.IntSliceVarP(&Animation.Laps, "laps", "", nil, "Numbers of the laps to animate as printed by the laps command, for example 3,5")
+	flags.StringVarP(&Animation.Format, "format", "f", Animation.Format, "Output format, gif or png")
+	flags.IntVarP(&Animation.Width, "width", "", Animation.Width, "Width of the frames in pixels")
+	flags.IntVarP(&Animation.Height, "height", "", Animation.Height, "Height of the frames in pixels")
+	flags.Float64VarP(&Animation.FPS, "fps", "", Animation.FPS, "Frames per second")
+	flags.Float64VarP(&Animation.Speed, "speed", "", Animation.Speed, "Factor of the lap time to the animation time, 2 plays twice as fast")
+	flags.Float64VarP(&Animation.TrailSeconds, "trail", "", Animation.TrailSeconds, "Seconds of driving the trail behind every car shows")
+
+	rootCmd.AddCommand(animateCmd)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var EvaluationTruthFile string
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Measures the accuracy of the smoothing and every lap detector against a ground truth",
+	Long: `Measures the accuracy of the smoothing and every lap detector against a ground truth.
+The truth of a simulated session is found next to it, otherwise the "# Lap N:" annotations of the session are used.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		evaluation, err := pkg.Evaluate(pkg.EvaluationConfig{
+			DataConfig: newDataConfig(),
+			TruthFile:  EvaluationTruthFile,
+		})
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		pkg.PrettyPrintEvaluation(evaluation)
+	},
+}
+
+func init() {
+	evaluateCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File, - reads the standard input (required)")
+	_ = evaluateCmd.MarkFlagRequired("inputFile")
+	evaluateCmd.Flags().StringVarP(&EvaluationTruthFile, "truth", "", "", "Truth json of a simulated session, by default the one next to the input file")
+	addTrackFlags(evaluateCmd)
+
+	rootCmd.AddCommand(evaluateCmd)
+}
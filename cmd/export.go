@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+	"strings"
+)
+
+var (
+	ExportFormat      string
+	ExportPointSpeeds bool
+	ExportSampleRate  float64
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Converts a session with its laps into the formats of other tools",
+	Long: `Converts a session with its laps into the formats of other tools.
+racerender writes a TrackAddict csv for RaceRender and other video overlay tools, with the laps of this tool in the
+Lap column and the "# Lap N:" annotations. csv writes a plain csv with one row per measurement and its lap.
+kml and geojson write every lap as a line with its number, time, top speed and validity, together with the gates.
+vbo writes a Racelogic VBOX file and motec a csv for MoTeC i2 with beacon markers at the laps and computed g forces.
+Given several input files, each is exported into its own file named after the output file and the input file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		files := inputFiles()
+		outputFiles := []string{OutputFile}
+		if len(files) > 1 {
+			outputFiles = pkg.OutputFilesForInputs(OutputFile, files)
+		}
+		err := pkg.ForEachSessionData(ctx, dataConfig, files, func(i int, data *pkg.TrackData) error {
+			logInferredCircuit(data.TrackInformation)
+
+			config := pkg.ExportConfig{
+				DataConfig:   dataConfig,
+				OutputFile:   outputFiles[i],
+				Format:       ExportFormat,
+				PointSpeeds:  ExportPointSpeeds,
+				SampleRateHz: ExportSampleRate,
+			}
+			config.InputFile = files[i]
+			return pkg.Export(data, config)
+		})
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(exportCmd)
+	exportCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File")
+	_ = exportCmd.MarkFlagRequired("outputFile")
+	exportCmd.Flags().StringVarP(&ExportFormat, "format", "f", pkg.ExportFormatRaceRender,
+		fmt.Sprintf("Output format, one of %s", strings.Join(pkg.ExportFormats(), ", ")))
+	exportCmd.Flags().BoolVarP(&ExportPointSpeeds, "point-speeds", "", false, "If set, kml and geojson also contain a point with the speed for every GPS fix")
+	exportCmd.Flags().Float64VarP(&ExportSampleRate, "rate", "", pkg.DefaultMoTeCSampleRateHz, "Samples per second of the motec export")
+	exportCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
+	exportCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, the smoothed GPS positions are exported")
+	addTrackFlags(exportCmd)
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var inferCmd = &cobra.Command{
+	Use:   "infer-track",
+	Short: "Infers the start/finish gate of a circuit from the driven path, for sessions without a known track",
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := pkg.ReadData(newDataConfig())
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		inference, err := pkg.InferCircuit(data.GPSMeasurement)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		pkg.PrettyPrintCircuitInference(inference)
+
+		// ready to be pasted into a json file of the track database
+		track, err := json.MarshalIndent(pkg.TrackDatabase{Tracks: []pkg.Track{*inference.Track()}}, "", "  ")
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		fmt.Println(string(track))
+	},
+}
+
+func init() {
+	inferCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File, - reads the standard input (required)")
+	_ = inferCmd.MarkFlagRequired("inputFile")
+
+	rootCmd.AddCommand(inferCmd)
+}
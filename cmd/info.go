@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Prints the session metadata like device, app version and sample rate",
+	Run: func(cmd *cobra.Command, args []string) {
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		files := inputFiles()
+		summaries, err := pkg.SummarizeSessions(ctx, dataConfig, files)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		for i, summary := range summaries {
+			if len(files) > 1 {
+				fmt.Println(files[i])
+			}
+			pkg.PrettyPrintSessionSummary(summary)
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(infoCmd)
+	addTrackFlags(infoCmd)
+
+	rootCmd.AddCommand(infoCmd)
+}
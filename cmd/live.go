@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	LiveListen  string
+	LivePublish string
+	LiveJSON    bool
+)
+
+var liveCmd = &cobra.Command{
+	Use:   "live",
+	Short: "Times laps live from a TrackAddict csv or NMEA stream over tcp, udp or stdin",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		onStatus := printLiveStatus
+		if LiveJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			onStatus = func(status pkg.LiveStatus) error {
+				return encoder.Encode(status)
+			}
+		}
+
+		err := pkg.RunLive(ctx, pkg.LiveConfig{
+			DataConfig: newDataConfig(),
+			Listen:     LiveListen,
+			Publish:    LivePublish,
+		}, onStatus)
+		if err != nil && err != context.Canceled {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	liveCmd.Flags().StringVarP(&LiveListen, "listen", "l", "-", "Where to read the telemetry from: tcp://host:port, udp://host:port or - for stdin")
+	liveCmd.Flags().StringVarP(&LivePublish, "publish", "", "", "Optionally sends every status as a json line to tcp://host:port or udp://host:port")
+	liveCmd.Flags().BoolVarP(&LiveJSON, "json", "", false, "If set, prints every status as a json line instead of text")
+	liveCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, GPS data is smoothed once enough measurements arrived")
+	addTrackFlags(liveCmd)
+
+	rootCmd.AddCommand(liveCmd)
+}
+
+func printLiveStatus(status pkg.LiveStatus) error {
+	if status.LapCompleted && status.LastLapSeconds > 0 {
+		fmt.Printf("Lap %d completed in %s\n", status.Lap-1, liveDuration(status.LastLapSeconds))
+	}
+
+	parts := []string{
+		fmt.Sprintf("Lap %d", status.Lap),
+		liveDuration(status.CurrentLapSeconds),
+		"last " + liveDuration(status.LastLapSeconds),
+		"best " + liveDuration(status.BestLapSeconds),
+	}
+	if status.DeltaSeconds != nil {
+		parts = append(parts, fmt.Sprintf("delta %+.3f", *status.DeltaSeconds))
+	}
+	parts = append(parts, fmt.Sprintf("%.0f km/h", status.SpeedKph))
+	fmt.Println(strings.Join(parts, " | "))
+	return nil
+}
+
+func liveDuration(seconds float64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Joins partial logs of one session into a single TrackAddict csv",
+	Long: `Joins partial logs of one session into a single TrackAddict csv, for example when the app crashed and was restarted.
+The logs are ordered by their UTC time, measurements overlapping with an earlier log are dropped and the time starts
+with the first log. The lap numbers continue: a lap that was interrupted by a crash continues in the next log, its time
+includes the gap. The laps of the merged session are printed afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := pkg.MergeConfig{
+			DataConfig: newDataConfig(),
+			InputFiles: inputFiles(),
+			OutputFile: OutputFile,
+		}
+		data, err := pkg.Merge(config)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		logInferredCircuit(data.TrackInformation)
+		pkg.PrettyPrintLaps(data.Laps)
+	},
+}
+
+func init() {
+	addInputFilesFlag(mergeCmd)
+	mergeCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (required)")
+	_ = mergeCmd.MarkFlagRequired("outputFile")
+	mergeCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, the printed laps are recalculated, the written file keeps the laps of the logs")
+	addTrackFlags(mergeCmd)
+
+	rootCmd.AddCommand(mergeCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"io"
+	"log"
+	"os"
+)
+
+var (
+	ReplayTarget string
+	ReplayFormat string
+	ReplaySpeed  float64
+	ReplaySeek   float64
+	ReplayLoop   bool
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Streams a recorded session in real or accelerated time to stdout, tcp or udp",
+	Long: `Streams a recorded session in real or accelerated time to stdout, tcp or udp.
+When run in a terminal, commands can be typed while replaying:
+  <enter> or pause   pauses or resumes the replay
+  seek 120           jumps to 120s into the session, seek +30 and seek -30 jump relative to now
+  speed 4            replays four times as fast`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		var controls io.Reader
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			controls = os.Stdin
+		}
+
+		err := pkg.Replay(ctx, pkg.ReplayConfig{
+			DataConfig:  newDataConfig(),
+			Target:      ReplayTarget,
+			Format:      ReplayFormat,
+			Speed:       ReplaySpeed,
+			SeekSeconds: ReplaySeek,
+			Loop:        ReplayLoop,
+			Controls:    controls,
+		}, os.Stdout)
+		if err != nil && err != context.Canceled {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File, - reads the standard input (required)")
+	_ = replayCmd.MarkFlagRequired("inputFile")
+	replayCmd.Flags().StringVarP(&ReplayTarget, "target", "t", "-", "Where to send the session to: tcp://host:port, udp://host:port or - for stdout")
+	replayCmd.Flags().StringVarP(&ReplayFormat, "format", "f", pkg.ReplayFormatCSV, "Format of the lines: csv, nmea or json")
+	replayCmd.Flags().Float64VarP(&ReplaySpeed, "speed", "", 1, "Replay speed, 2 replays twice as fast as recorded")
+	replayCmd.Flags().Float64VarP(&ReplaySeek, "seek", "", 0, "Starts the replay at the given second of the session")
+	replayCmd.Flags().BoolVarP(&ReplayLoop, "loop", "", false, "If set, the replay starts over at the end of the session")
+	replayCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, the smoothed GPS data is replayed")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var ReportMapTiles bool
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Creates a self-contained html report with laps, track map and speed charts",
+	Long: `Creates a self-contained html report with laps, track map and speed charts.
+Given several input files, they end up in one report that compares the fastest lap of each session.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		files := inputFiles()
+		sessions, err := pkg.ReadAllData(ctx, dataConfig, files)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		for _, data := range sessions {
+			logInferredCircuit(data.TrackInformation)
+		}
+
+		err = pkg.SessionsReport(sessions, files, pkg.ReportConfig{
+			DataConfig: dataConfig,
+			OutputFile: OutputFile,
+			MapTiles:   ReportMapTiles,
+		})
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(reportCmd)
+	reportCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (html)")
+	_ = reportCmd.MarkFlagRequired("outputFile")
+	reportCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
+	reportCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS data with accelerometer information")
+	reportCmd.Flags().BoolVarP(&ReportMapTiles, "map-tiles", "", false, "If set, the track map is drawn on OpenStreetMap tiles, which needs network access")
+	addTrackFlags(reportCmd)
+
+	rootCmd.AddCommand(reportCmd)
+}
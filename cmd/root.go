@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/thomasjungblut/trackaddict-cli/pkg"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
 )
 
 var (
 	InputFile          string
+	InputFiles         []string
+	InputFormat        string
 	OutputFile         string
 	PlotImageWidth     int
 	PlotImageHeight    int
@@ -17,6 +22,11 @@ var (
 	PlotLapsSeparately bool
 	FilteringEnabled   bool
 	RecalculateLaps    bool
+	TrackName          string
+	TrackDatabaseDir   string
+	StartGate          string
+	FinishGate         string
+	PitLane            string
 )
 
 var rootCmd = &cobra.Command{
@@ -28,36 +38,57 @@ var lapCmd = &cobra.Command{
 	Use:   "laps",
 	Short: "Prints your lap times",
 	Run: func(cmd *cobra.Command, args []string) {
-		dataConfig := pkg.DataConfig{InputFile: InputFile, UseSmoothedGPSData: FilteringEnabled, RecalculateLaps: RecalculateLaps}
-		data, err := pkg.ReadData(dataConfig)
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		// laps only need the lap boundaries, so we can stream even very large sessions
+		sessions, err := pkg.ReadAllSessionLaps(ctx, dataConfig, inputFiles())
 		if err != nil {
 			log.Fatalf("encountered an error: %v", err)
 		}
-		
-		pkg.PrettyPrintLaps(data.Laps)
+		for _, session := range sessions {
+			logInferredCircuit(session.TrackInformation)
+		}
+
+		if len(sessions) == 1 {
+			pkg.PrettyPrintLaps(sessions[0].Laps)
+			return
+		}
+		pkg.PrettyPrintSessionsLaps(sessions)
+		pkg.PrettyPrintBestLaps(sessions)
 	},
 }
 
 var plotCmd = &cobra.Command{
 	Use:   "plot",
 	Short: "Plots a small map of your GPS coordinates",
+	Long: `Plots a small map of your GPS coordinates.
+Given several input files, each is plotted into its own image named after the output file and the input file.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		dataConfig := pkg.DataConfig{InputFile: InputFile, UseSmoothedGPSData: FilteringEnabled, RecalculateLaps: RecalculateLaps}
-		data, err := pkg.ReadData(dataConfig)
-		if err != nil {
-			log.Fatalf("encountered an error: %v", err)
-		}
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
 
-		config := pkg.PlotConfig{
-			DataConfig:         dataConfig,
-			OutputFile:         OutputFile,
-			ImageWidth:         PlotImageWidth,
-			ImageHeight:        PlotImageHeight,
-			PlotLapsSeparately: PlotLapsSeparately,
-			FastestLapOnly:     PlotFastestLapOnly,
+		files := inputFiles()
+		outputFiles := []string{OutputFile}
+		if len(files) > 1 {
+			outputFiles = pkg.OutputFilesForInputs(OutputFile, files)
 		}
+		err := pkg.ForEachSessionData(ctx, dataConfig, files, func(i int, data *pkg.TrackData) error {
+			logInferredCircuit(data.TrackInformation)
 
-		err = pkg.Plot(data, config)
+			config := pkg.PlotConfig{
+				DataConfig:         dataConfig,
+				OutputFile:         outputFiles[i],
+				ImageWidth:         PlotImageWidth,
+				ImageHeight:        PlotImageHeight,
+				PlotLapsSeparately: PlotLapsSeparately,
+				FastestLapOnly:     PlotFastestLapOnly,
+			}
+			config.InputFile = files[i]
+			return pkg.Plot(data, config)
+		})
 		if err != nil {
 			log.Fatalf("encountered an error: %v", err)
 		}
@@ -73,13 +104,15 @@ var versionCmd = &cobra.Command{
 }
 
 func init() {
-	lapCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File (required)")
-	_ = lapCmd.MarkFlagRequired("inputFile")
+	rootCmd.PersistentFlags().StringVarP(&InputFormat, "input-format", "", "",
+		fmt.Sprintf("Format of the input files, one of %s, detected from the files by default", strings.Join(pkg.InputFormats(), ", ")))
+
+	addInputFilesFlag(lapCmd)
 	lapCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
 	lapCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS data with accelerometer information")
+	addTrackFlags(lapCmd)
 
-	plotCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File (required)")
-	_ = plotCmd.MarkFlagRequired("inputFile")
+	addInputFilesFlag(plotCmd)
 	plotCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (png)")
 	_ = plotCmd.MarkFlagRequired("outputFile")
 
@@ -89,12 +122,100 @@ func init() {
 	plotCmd.Flags().BoolVarP(&PlotLapsSeparately, "plot-each-lap", "", false, "If set, it will plot each lap in its own file by appending the lap number to the given outputfile name.")
 	plotCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
 	plotCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS location by kalman filtering using accelerometer data")
+	addTrackFlags(plotCmd)
 
 	rootCmd.AddCommand(lapCmd)
 	rootCmd.AddCommand(plotCmd)
 	rootCmd.AddCommand(versionCmd)
 }
 
+func newDataConfig() pkg.DataConfig {
+	config := pkg.DataConfig{
+		InputFile:          InputFile,
+		InputFormat:        InputFormat,
+		UseSmoothedGPSData: FilteringEnabled,
+		RecalculateLaps:    RecalculateLaps,
+		TrackName:          TrackName,
+		TrackDatabaseDir:   TrackDatabaseDir,
+	}
+
+	var err error
+	if StartGate != "" {
+		config.StartGate, err = pkg.ParseGate(StartGate)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+		// TrackAddict doesn't know about the gates, so the laps always have to be recalculated
+		config.RecalculateLaps = true
+	}
+	if FinishGate != "" {
+		if StartGate == "" {
+			log.Fatalf("a finish gate also needs a start gate")
+		}
+		config.FinishGate, err = pkg.ParseGate(FinishGate)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	}
+	if PitLane != "" {
+		config.PitLane, err = pkg.ParsePolygon(PitLane)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	}
+	return config
+}
+
+// addInputFilesFlag lets a command analyze several files at once, each can also be a directory or a glob pattern.
+func addInputFilesFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&InputFiles, "inputFile", "i", nil, "Input File, directory or glob pattern, can be given multiple times, - reads the standard input (required)")
+	_ = cmd.MarkFlagRequired("inputFile")
+}
+
+func inputFiles() []string {
+	files, err := pkg.ExpandInputFiles(InputFiles)
+	if err != nil {
+		log.Fatalf("encountered an error: %v", err)
+	}
+	return files
+}
+
+func logInferredCircuit(info *pkg.TrackInformation) {
+	if info != nil && info.InferredCircuit != nil {
+		log.Printf("The session has no start/finish point, inferred one with %.0f%% confidence",
+			info.InferredCircuit.Confidence*100)
+	}
+}
+
+func addTrackFlags(cmd *cobra.Command) {
+	addTrackDatabaseFlags(cmd)
+	cmd.Flags().StringVarP(&StartGate, "start-gate", "", "", "Start (or start/finish) gate as lat,lng,lat,lng of its end points with an optional driving direction in degrees, overrides the track database")
+	cmd.Flags().StringVarP(&FinishGate, "finish-gate", "", "", "Finish gate as lat,lng,lat,lng[,heading], times point-to-point runs from the start to the finish gate")
+	cmd.Flags().StringVarP(&PitLane, "pit-lane", "", "", "Polygon around the pit lane as lat,lng;lat,lng;..., overrides the one of the track database")
+}
+
+// addTrackDatabaseFlags only registers the flags to choose a track of the database, without the gates and pit lane.
+func addTrackDatabaseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&TrackName, "track", "", "", "Name of the track in the track database, by default the track is matched by the GPS position")
+	cmd.Flags().StringVarP(&TrackDatabaseDir, "tracks-dir", "", pkg.DefaultTrackDatabaseDir(), "Directory with additional track definitions as json or yaml files")
+}
+
+// interruptibleContext returns a context that is cancelled on Ctrl+C, so long running reads can stop cleanly.
+func interruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
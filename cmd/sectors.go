@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var sectorsCmd = &cobra.Command{
+	Use:   "sectors",
+	Short: "Prints the sector times of your laps using the sector gates of the track database",
+	Run: func(cmd *cobra.Command, args []string) {
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		sessions, err := pkg.ReadAllSessionLaps(ctx, dataConfig, inputFiles())
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		for _, session := range sessions {
+			var track *pkg.Track
+			if session.TrackInformation != nil {
+				track = session.TrackInformation.Track
+			}
+			if track == nil || len(track.Sectors) == 0 {
+				log.Fatalf("no track with sector gates found for %s, use --track or add one to --tracks-dir", session.InputFile)
+			}
+			log.Printf("Sectors of track %s in %s", track.Name, session.InputFile)
+			pkg.PrettyPrintSectors(session.Laps)
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(sectorsCmd)
+	sectorsCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will recalculate the laps using the start/finish gate of the track")
+	sectorsCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS data with accelerometer information")
+	addTrackFlags(sectorsCmd)
+
+	rootCmd.AddCommand(sectorsCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ServeAddr    string
+	ServeDataDir string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Starts an http server to upload and analyse sessions from any browser, with a json api",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		server, err := pkg.NewServer(pkg.ServerConfig{
+			DataConfig: newDataConfig(),
+			Addr:       ServeAddr,
+			DataDir:    ServeDataDir,
+		})
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		log.Printf("Serving on %s, uploads are kept in %s", ServeAddr, ServeDataDir)
+		if err := server.ListenAndServe(ctx); err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVarP(&ServeAddr, "addr", "", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVarP(&ServeDataDir, "data-dir", "", defaultUploadDir(), "Directory to keep the uploaded sessions in")
+	serveCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, laps are recalculated unless a request sets fixLaps")
+	serveCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, GPS data is smoothed unless a request sets smooth")
+	addTrackFlags(serveCmd)
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+func defaultUploadDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "trackaddict-cli-uploads")
+	}
+	return filepath.Join(home, ".trackaddict-cli", "uploads")
+}
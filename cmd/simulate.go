@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var (
+	SimulationCenterlineFile string
+	Simulation               = pkg.DefaultSimulationConfig()
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Generates a TrackAddict csv of a simulated session together with its ground truth",
+	Long: `Generates a TrackAddict csv of a simulated session together with its ground truth.
+The car drives on the centreline of the track, GPS fixes are taken with noise, latency and dropouts.
+The true laps are written to <output>.truth.json and the true position of every line to <output>.truth.positions.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := Simulation
+		config.OutputFile = OutputFile
+
+		var err error
+		if SimulationCenterlineFile != "" {
+			config.Centerline, err = pkg.ReadCenterline(SimulationCenterlineFile)
+		} else if InputFile != "" {
+			var data *pkg.TrackData
+			data, err = pkg.ReadData(newDataConfig())
+			if err == nil {
+				config.Centerline, err = pkg.CenterlineFromSession(data)
+			}
+		}
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		truth, err := pkg.Simulate(config)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		gate := truth.StartFinish
+		fmt.Printf("Simulated %d laps on a %.0fm track, the start/finish gate is %f,%f,%f,%f\n",
+			config.Laps, truth.LengthMeters, gate.A.Lat, gate.A.Lng, gate.B.Lat, gate.B.Lng)
+		pkg.PrettyPrintLaps(truth.Laps)
+	},
+}
+
+func init() {
+	simulateCmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (csv)")
+	_ = simulateCmd.MarkFlagRequired("outputFile")
+	simulateCmd.Flags().StringVarP(&SimulationCenterlineFile, "centerline", "", "", "File with one lat,lng per line along the track, defaults to a built-in circuit")
+	simulateCmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Uses the fastest lap of this session as centreline")
+	simulateCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, the laps of the input file are recalculated to find its fastest lap")
+	addTrackDatabaseFlags(simulateCmd)
+
+	flags := simulateCmd.Flags()
+	flags.IntVarP(&Simulation.Laps, "laps", "", Simulation.Laps, "Number of flying laps between the outlap and the inlap")
+	flags.Int64VarP(&Simulation.Seed, "seed", "", Simulation.Seed, "Seed of the random numbers, the same seed generates the same session")
+	flags.Float64VarP(&Simulation.RateHz, "rate", "", Simulation.RateHz, "Lines logged per second")
+	flags.Float64VarP(&Simulation.GPSRateHz, "gps-rate", "", Simulation.GPSRateHz, "GPS fixes per second")
+	flags.Float64VarP(&Simulation.MaxSpeedKph, "max-speed", "", Simulation.MaxSpeedKph, "Top speed of the car in km/h")
+	flags.Float64VarP(&Simulation.MaxLateralG, "lateral-g", "", Simulation.MaxLateralG, "Grip in corners in g")
+	flags.Float64VarP(&Simulation.MaxBrakingG, "braking-g", "", Simulation.MaxBrakingG, "Deceleration when braking in g")
+	flags.Float64VarP(&Simulation.MaxAccelerationG, "acceleration-g", "", Simulation.MaxAccelerationG, "Acceleration out of corners in g")
+	flags.Float64VarP(&Simulation.LapTimeVariation, "lap-variation", "", Simulation.LapTimeVariation, "Standard deviation of the driver's pace from lap to lap, as a fraction")
+	flags.Float64VarP(&Simulation.GPSNoiseMeters, "gps-noise", "", Simulation.GPSNoiseMeters, "Standard deviation of the GPS position error in meters")
+	flags.Float64VarP(&Simulation.GPSNoiseCorrelationSeconds, "gps-noise-correlation", "", Simulation.GPSNoiseCorrelationSeconds, "Seconds over which the GPS position error is correlated")
+	flags.Float64VarP(&Simulation.GPSLatencySeconds, "gps-latency", "", Simulation.GPSLatencySeconds, "Delay of the GPS fixes in seconds")
+	flags.Float64VarP(&Simulation.GPSDropoutProbability, "gps-dropout", "", Simulation.GPSDropoutProbability, "Chance of every GPS fix to start a dropout")
+	flags.Float64VarP(&Simulation.GPSDropoutSeconds, "gps-dropout-seconds", "", Simulation.GPSDropoutSeconds, "Length of a GPS dropout in seconds")
+	flags.Float64VarP(&Simulation.AccelerometerNoiseG, "accel-noise", "", Simulation.AccelerometerNoiseG, "Standard deviation of the accelerometer noise in g")
+
+	rootCmd.AddCommand(simulateCmd)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var (
+	SessionStoreDir string
+	Driver          string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Records sessions with their laps and sectors in the session store",
+	Run: func(cmd *cobra.Command, args []string) {
+		dataConfig := newDataConfig()
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		store := openSessionStore()
+		sessions, err := pkg.ReadAllSessionLaps(ctx, dataConfig, inputFiles())
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		for _, session := range sessions {
+			if Driver != "" {
+				session.Driver = Driver
+			}
+			stored, err := pkg.NewStoredSession(session)
+			if err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+			replaced, err := store.Import(stored)
+			if err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+
+			action := "Imported"
+			if replaced {
+				action = "Re-imported"
+			}
+			log.Printf("%s %s as a session of %s at %s with %d laps", action, session.InputFile, stored.Driver, stored.Track, len(stored.Laps))
+		}
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Prints the imported sessions and the progression of the personal best per track and driver",
+	Run: func(cmd *cobra.Command, args []string) {
+		pkg.PrettyPrintHistory(storedSessions())
+	},
+}
+
+var pbCmd = &cobra.Command{
+	Use:   "pb",
+	Short: "Prints the personal best lap and sectors per track and driver of all imported sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		pkg.PrettyPrintPersonalBests(storedSessions())
+	},
+}
+
+func init() {
+	addInputFilesFlag(importCmd)
+	importCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
+	importCmd.Flags().BoolVarP(&FilteringEnabled, "smooth", "", false, "If set, it will try to smooth the GPS data with accelerometer information")
+	importCmd.Flags().StringVarP(&Driver, "driver", "", "", "Driver of the sessions, by default the name of the directory of each file")
+	addTrackFlags(importCmd)
+	addSessionStoreFlag(importCmd)
+
+	for _, cmd := range []*cobra.Command{historyCmd, pbCmd} {
+		cmd.Flags().StringVarP(&TrackName, "track", "", "", "Only shows the sessions of this track")
+		cmd.Flags().StringVarP(&Driver, "driver", "", "", "Only shows the sessions of this driver")
+		addSessionStoreFlag(cmd)
+	}
+
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(pbCmd)
+}
+
+func addSessionStoreFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&SessionStoreDir, "store-dir", "", pkg.DefaultSessionStoreDir(), "Directory of the session store")
+}
+
+func openSessionStore() *pkg.SessionStore {
+	store, err := pkg.OpenSessionStore(SessionStoreDir)
+	if err != nil {
+		log.Fatalf("encountered an error: %v", err)
+	}
+	return store
+}
+
+func storedSessions() []*pkg.StoredSession {
+	sessions, err := openSessionStore().Sessions(pkg.SessionFilter{Track: TrackName, Driver: Driver})
+	if err != nil {
+		log.Fatalf("encountered an error: %v", err)
+	}
+	return sessions
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+)
+
+var (
+	TrimFrom string
+	TrimTo   string
+	TrimLaps string
+)
+
+var trimCmd = &cobra.Command{
+	Use:   "trim",
+	Short: "Cuts a session to a time or lap range and writes it as a TrackAddict csv",
+	Long: `Cuts a session to a time or lap range and writes it as a TrackAddict csv.
+The times are the session times as seconds, m:ss or h:mm:ss, the laps are numbered like the laps command does.
+Given both, the intersection is kept. The header comments and annotations are kept and the time starts at zero.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := newTrimConfig()
+		var err error
+		if TrimFrom != "" {
+			if config.FromSeconds, err = pkg.ParseSessionTime(TrimFrom); err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+		}
+		if TrimTo != "" {
+			if config.ToSeconds, err = pkg.ParseSessionTime(TrimTo); err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+		}
+		if TrimLaps != "" {
+			if config.Laps, err = pkg.ParseLapRange(TrimLaps); err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+		}
+
+		if err := pkg.Trim(config); err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Splits a session at its pit visits into one TrackAddict csv per outing",
+	Long: `Splits a session at its pit visits into one TrackAddict csv per outing.
+Pit visits are found from the Pit Lane Entry and Exit annotations, the pit lane of the track and long standstills, 
+annotated visits only count if the car was slow. The parts are written as <outputFile>_1.csv, <outputFile>_2.csv and 
+so on, driving that never got faster than the pit lane speed is left out.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := pkg.Split(newTrimConfig()); err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+	},
+}
+
+func newTrimConfig() pkg.TrimConfig {
+	return pkg.TrimConfig{DataConfig: newDataConfig(), OutputFile: OutputFile}
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{trimCmd, splitCmd} {
+		cmd.Flags().StringVarP(&InputFile, "inputFile", "i", "", "Input File, - reads the standard input (required)")
+		_ = cmd.MarkFlagRequired("inputFile")
+		cmd.Flags().StringVarP(&OutputFile, "outputFile", "o", "", "Output File (required)")
+		_ = cmd.MarkFlagRequired("outputFile")
+		cmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, it will heuristically recalculate the laps")
+		addTrackFlags(cmd)
+		rootCmd.AddCommand(cmd)
+	}
+	trimCmd.Flags().StringVarP(&TrimFrom, "from", "", "", "Session time to start at, as seconds, m:ss or h:mm:ss")
+	trimCmd.Flags().StringVarP(&TrimTo, "to", "", "", "Session time to end at, as seconds, m:ss or h:mm:ss")
+	trimCmd.Flags().StringVarP(&TrimLaps, "laps", "", "", "Laps to keep as printed by the laps command, for example 3-7, 3- or 5")
+}
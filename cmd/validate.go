@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/thomasjungblut/trackaddict-cli/pkg"
+	"log"
+	"os"
+)
+
+var ValidateJSON bool
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the data quality of sessions before analyzing them",
+	Long: `Checks the data quality of sessions before analyzing them: the sample rate and its jitter, the GPS update rate,
+the accuracy of the fixes, GPS dropouts, time gaps and timestamps that don't advance, sensors that are stuck while the
+car is moving, standstills and suspicious lap markers. Every check passes, warns or fails, the session gets the worst
+status of its checks. The command exits with 1 if any session failed, so it can guard uploads in scripts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := interruptibleContext()
+		defer cancel()
+
+		files := inputFiles()
+		reports, err := pkg.ValidateSessions(ctx, newDataConfig(), files)
+		if err != nil {
+			log.Fatalf("encountered an error: %v", err)
+		}
+
+		if ValidateJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(reports); err != nil {
+				log.Fatalf("encountered an error: %v", err)
+			}
+		} else {
+			for i, report := range reports {
+				if len(reports) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Println(report.InputFile)
+				}
+				pkg.PrettyPrintValidationReport(report)
+			}
+		}
+
+		for _, report := range reports {
+			if report.Status == pkg.ValidationFail {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	addInputFilesFlag(validateCmd)
+	validateCmd.Flags().BoolVarP(&ValidateJSON, "json", "", false, "If set, prints the reports as json instead of tables")
+	validateCmd.Flags().BoolVarP(&RecalculateLaps, "fix-laps", "", false, "If set, the lap markers are checked against recalculated laps")
+	addTrackFlags(validateCmd)
+
+	rootCmd.AddCommand(validateCmd)
+}
@@ -8,6 +8,7 @@ require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/golang/geo v0.0.0-20190507233405-a0e886e97a51
 	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/klauspost/compress v1.17.11
 	github.com/mattn/go-runewidth v0.0.4 // indirect
 	github.com/olekukonko/tablewriter v0.0.1
 	github.com/slobdell/basicMatrix v0.0.0-20170905162932-cdd8aabfc8a0
@@ -15,4 +16,5 @@ require (
 	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/tkrajina/gpxgo v1.0.1 // indirect
 	golang.org/x/image v0.0.0-20190523035834-f03afa92d3ff
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,485 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/fogleman/gg"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	AnimationFormatGIF = "gif"
+	AnimationFormatPNG = "png"
+	// animationHoldSeconds keeps the last frame on screen before a gif loops
+	animationHoldSeconds  = 2.0
+	animationMarginPixels = 30.0
+)
+
+// AnimationConfig configures the frames of the animate command.
+type AnimationConfig struct {
+	DataConfig
+	// InputFiles are the sessions the cars are taken from, the InputFile of the DataConfig is ignored.
+	InputFiles []string
+	OutputFile string
+	// Format is AnimationFormatGIF for a single animated gif or AnimationFormatPNG for numbered png frames.
+	Format string
+	// Laps are the numbers of the laps to animate as printed by the laps command, they apply to every input file.
+	// Without laps, a single session animates its two fastest valid laps and several sessions their fastest lap each.
+	Laps   []int
+	Width  int
+	Height int
+	FPS    float64
+	// Speed is the factor of the lap time to the animation time, 2 plays twice as fast.
+	Speed        float64
+	TrailSeconds float64
+}
+
+// animationCar is a lap that is animated, its path is already projected into pixels.
+type animationCar struct {
+	label          string
+	color          color.Color
+	seconds        []float64
+	x              []float64
+	y              []float64
+	distanceMeters []float64
+	speedKph       []float64
+	lapSeconds     float64
+	profile        *lapProfile
+}
+
+// animationState is where a car is at a given time of its lap.
+type animationState struct {
+	index          int
+	seconds        float64
+	x, y           float64
+	distanceMeters float64
+	speedKph       float64
+	finished       bool
+}
+
+// Animate renders the selected laps as cars moving along the track, the first car is the reference of the delta.
+func Animate(config AnimationConfig) error {
+	if config.FPS <= 0 || config.Speed <= 0 {
+		return fmt.Errorf("frames per second and speed have to be positive but were %f and %f", config.FPS, config.Speed)
+	}
+	if config.Format != AnimationFormatGIF && config.Format != AnimationFormatPNG {
+		return fmt.Errorf("unknown animation format '%s', expected gif or png", config.Format)
+	}
+
+	var track *Track
+	var laps []Lap
+	var measures [][]GPSMeasurement
+	var labels []string
+	for _, inputFile := range config.InputFiles {
+		fileConfig := config.DataConfig
+		fileConfig.InputFile = inputFile
+		data, err := ReadData(fileConfig)
+		if err != nil {
+			return err
+		}
+		if track == nil {
+			track = data.TrackInformation.Track
+		}
+
+		selected, numbers, err := selectAnimationLaps(data.Laps, config.Laps, len(config.InputFiles) > 1)
+		if err != nil {
+			return fmt.Errorf("%s: %v", inputFile, err)
+		}
+		for i, lap := range selected {
+			label := numbers[i]
+			if len(config.InputFiles) > 1 {
+				label = strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile)) + " " + label
+			}
+			laps = append(laps, lap)
+			measures = append(measures, data.Measures(fileConfig))
+			labels = append(labels, label)
+		}
+	}
+
+	var points []LatLng
+	for i, lap := range laps {
+		for _, m := range MeasuresForLap(lap, measures[i]) {
+			points = append(points, m.LatLng)
+		}
+	}
+	if len(points) == 0 {
+		return fmt.Errorf("the selected laps don't have any measurements")
+	}
+	size := math.Min(float64(config.Width), float64(config.Height))
+	projection := newMapProjection(points, size, animationMarginPixels)
+	projection.offset[0] += (float64(config.Width) - size) / 2
+	projection.offset[1] += (float64(config.Height) - size) / 2
+
+	var cars []*animationCar
+	longestSeconds := 0.0
+	for i, lap := range laps {
+		car := newAnimationCar(lap, measures[i], projection, labels[i], reportPalette[i%len(reportPalette)])
+		cars = append(cars, car)
+		longestSeconds = math.Max(longestSeconds, car.lapSeconds)
+	}
+
+	stepSeconds := config.Speed / config.FPS
+	numFrames := int(math.Ceil(longestSeconds/stepSeconds)) + 1
+	fmt.Printf("Animating %d laps in %d frames\n", len(cars), numFrames)
+
+	framePrefix := strings.TrimSuffix(config.OutputFile, ".png")
+	background := renderAnimationBackground(config, projection, track, cars)
+	quantizer := newAnimationQuantizer(animationPalette(cars), background)
+	animation := &gif.GIF{}
+	var previous *image.Paletted
+	for frame := 0; frame < numFrames; frame++ {
+		seconds := math.Min(float64(frame)*stepSeconds, longestSeconds)
+		img := renderAnimationFrame(config, background, cars, seconds)
+
+		if config.Format == AnimationFormatPNG {
+			outputFile := fmt.Sprintf("%s_%05d.png", framePrefix, frame+1)
+			if err := gg.SavePNG(outputFile, img); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the frames are drawn over each other, so only the part that changed since the frame before is kept
+		paletted := quantizer.quantize(img)
+		animation.Image = append(animation.Image, cropAnimationFrame(previous, paletted))
+		animation.Delay = append(animation.Delay, int(math.Round(100/config.FPS)))
+		animation.Disposal = append(animation.Disposal, gif.DisposalNone)
+		previous = paletted
+	}
+
+	if config.Format == AnimationFormatPNG {
+		fmt.Printf("Saved %s_%05d.png to %s_%05d.png\n", framePrefix, 1, framePrefix, numFrames)
+		return nil
+	}
+	animation.Delay[len(animation.Delay)-1] += int(animationHoldSeconds * 100)
+	return saveGIF(config.OutputFile, animation)
+}
+
+// selectAnimationLaps returns the laps with the given numbers and their labels, see AnimationConfig.Laps for the defaults.
+func selectAnimationLaps(laps []Lap, numbers []int, fastestOnly bool) ([]Lap, []string, error) {
+	if len(laps) == 0 {
+		return nil, nil, fmt.Errorf("the session doesn't have any laps")
+	}
+	indices := map[int]int{}
+	for i, lap := range laps {
+		indices[lap.MeasureStartIndex] = i
+	}
+
+	var selected []Lap
+	for _, number := range numbers {
+		index := number
+		if laps[0].Type == PointToPointRun {
+			index = number - 1
+		}
+		if index < 0 || index >= len(laps) {
+			return nil, nil, fmt.Errorf("there is no lap %d, the session has %d laps", number, len(laps))
+		}
+		selected = append(selected, laps[index])
+	}
+
+	if len(numbers) == 0 {
+		selected = ValidFlyingLaps(laps)
+		if len(selected) == 0 {
+			selected = append([]Lap(nil), laps...)
+		}
+		sort.SliceStable(selected, func(i, j int) bool {
+			return selected[i].Time < selected[j].Time
+		})
+		count := 2
+		if fastestOnly {
+			count = 1
+		}
+		if len(selected) > count {
+			selected = selected[:count]
+		}
+	}
+
+	labels := make([]string, len(selected))
+	for i, lap := range selected {
+		labels[i] = lapNumberFormat(indices[lap.MeasureStartIndex], lap)
+		if lap.Type != PointToPointRun {
+			labels[i] = "Lap " + labels[i]
+		}
+	}
+	return selected, labels, nil
+}
+
+func newAnimationCar(lap Lap, measures []GPSMeasurement, projection *mapProjection, label string, hex string) *animationCar {
+	car := &animationCar{
+		label:      label,
+		color:      parseHexColor(hex),
+		lapSeconds: lap.Time.Seconds(),
+		profile:    newLapProfile(lap, measures),
+	}
+	lapMeasures := MeasuresForLap(lap, measures)
+	distance := 0.0
+	for i, m := range lapMeasures {
+		if i > 0 {
+			distance += haversineDistance(lapMeasures[i-1].LatLng, m.LatLng)
+		}
+		x, y := projection.pixels(m.LatLng)
+		car.seconds = append(car.seconds, m.RelativeTime-lapMeasures[0].RelativeTime)
+		car.x = append(car.x, x)
+		car.y = append(car.y, y)
+		car.distanceMeters = append(car.distanceMeters, distance)
+		car.speedKph = append(car.speedKph, m.SpeedKph)
+	}
+	return car
+}
+
+// at interpolates the position of the car at the given time of its lap, after the finish it stays there.
+func (c *animationCar) at(seconds float64) animationState {
+	last := len(c.seconds) - 1
+	if seconds >= c.seconds[last] {
+		return animationState{index: last, seconds: c.seconds[last], x: c.x[last], y: c.y[last],
+			distanceMeters: c.distanceMeters[last], speedKph: c.speedKph[last], finished: true}
+	}
+	i := sort.SearchFloat64s(c.seconds, seconds)
+	if i == 0 {
+		return animationState{seconds: seconds, x: c.x[0], y: c.y[0], speedKph: c.speedKph[0]}
+	}
+	fraction := (seconds - c.seconds[i-1]) / (c.seconds[i] - c.seconds[i-1])
+	interpolate := func(values []float64) float64 {
+		return values[i-1] + fraction*(values[i]-values[i-1])
+	}
+	return animationState{index: i - 1, seconds: seconds, x: interpolate(c.x), y: interpolate(c.y),
+		distanceMeters: interpolate(c.distanceMeters), speedKph: interpolate(c.speedKph)}
+}
+
+// renderAnimationBackground draws what doesn't move: the driven lines and the gates of the track.
+func renderAnimationBackground(config AnimationConfig, projection *mapProjection, track *Track, cars []*animationCar) *image.RGBA {
+	dc := gg.NewContext(config.Width, config.Height)
+	dc.SetRGB(1, 1, 1)
+	dc.Clear()
+
+	dc.SetLineCapRound()
+	dc.SetLineJoinRound()
+	dc.SetRGB(0.85, 0.85, 0.85)
+	dc.SetLineWidth(10)
+	for _, car := range cars {
+		drawAnimationPath(dc, car.x, car.y)
+	}
+	dc.SetRGB(0.6, 0.6, 0.6)
+	dc.SetLineWidth(1)
+	for _, car := range cars {
+		drawAnimationPath(dc, car.x, car.y)
+	}
+
+	if track != nil {
+		gates := []Gate{track.StartFinish}
+		if track.Finish != nil {
+			gates = append(gates, *track.Finish)
+		}
+		for _, gate := range gates {
+			ax, ay := projection.pixels(gate.A)
+			bx, by := projection.pixels(gate.B)
+			dc.SetColor(Red)
+			dc.SetLineWidth(3)
+			dc.DrawLine(ax, ay, bx, by)
+			dc.Stroke()
+		}
+	}
+	return dc.Image().(*image.RGBA)
+}
+
+func renderAnimationFrame(config AnimationConfig, background *image.RGBA, cars []*animationCar, seconds float64) *image.RGBA {
+	dc := gg.NewContext(config.Width, config.Height)
+	dc.DrawImage(background, 0, 0)
+	dc.SetLineCapRound()
+	dc.SetLineJoinRound()
+
+	states := make([]animationState, len(cars))
+	for i, car := range cars {
+		states[i] = car.at(seconds)
+	}
+
+	// the trails first, so that no trail covers another car
+	for i, car := range cars {
+		state := states[i]
+		start := sort.SearchFloat64s(car.seconds, state.seconds-config.TrailSeconds)
+		if start > state.index {
+			start = state.index
+		}
+		x := append(append([]float64(nil), car.x[start:state.index+1]...), state.x)
+		y := append(append([]float64(nil), car.y[start:state.index+1]...), state.y)
+		dc.SetColor(car.color)
+		dc.SetLineWidth(4)
+		drawAnimationPath(dc, x, y)
+	}
+	for i := len(cars) - 1; i >= 0; i-- {
+		dc.DrawCircle(states[i].x, states[i].y, 7)
+		dc.SetColor(cars[i].color)
+		dc.FillPreserve()
+		dc.SetColor(Black)
+		dc.SetLineWidth(1.5)
+		dc.Stroke()
+	}
+
+	drawAnimationOverlay(dc, cars, states)
+	return dc.Image().(*image.RGBA)
+}
+
+// drawAnimationOverlay writes the lap time, the speed and the delta to the first car of every car into the top left corner.
+func drawAnimationOverlay(dc *gg.Context, cars []*animationCar, states []animationState) {
+	lineHeight := dc.FontHeight() + 6
+	lines := make([]string, len(cars))
+	width := 0.0
+	for i, car := range cars {
+		state := states[i]
+		lines[i] = fmt.Sprintf("%-12s %9s %4.0f km/h", car.label, formatAnimationSeconds(state.seconds), state.speedKph)
+		if i > 0 {
+			lines[i] += fmt.Sprintf(" %+7.3fs", animationDelta(cars[0], states[0], state))
+		}
+		textWidth, _ := dc.MeasureString(lines[i])
+		width = math.Max(width, textWidth)
+	}
+
+	dc.SetRGBA(1, 1, 1, 0.85)
+	dc.DrawRectangle(8, 8, width+40, float64(len(cars))*lineHeight+12)
+	dc.Fill()
+	for i, line := range lines {
+		y := 14 + float64(i)*lineHeight
+		dc.SetColor(cars[i].color)
+		dc.DrawRectangle(14, y+2, 12, 12)
+		dc.Fill()
+		dc.SetColor(Black)
+		dc.DrawStringAnchored(line, 32, y+lineHeight/2, 0, 0.5)
+	}
+}
+
+// animationDelta is the time the car lost to the reference car at the distance it drove, positive means it's behind.
+// Once both are across the line it is the difference of the lap times.
+func animationDelta(reference *animationCar, referenceState animationState, state animationState) float64 {
+	if state.finished && referenceState.finished {
+		return state.seconds - referenceState.seconds
+	}
+	return state.seconds - reference.profile.secondsAt(state.distanceMeters)
+}
+
+func drawAnimationPath(dc *gg.Context, x []float64, y []float64) {
+	if len(x) < 2 {
+		return
+	}
+	dc.MoveTo(x[0], y[0])
+	for i := 1; i < len(x); i++ {
+		dc.LineTo(x[i], y[i])
+	}
+	dc.Stroke()
+}
+
+func formatAnimationSeconds(seconds float64) string {
+	minutes := int(seconds / 60)
+	return fmt.Sprintf("%d:%06.3f", minutes, seconds-float64(minutes)*60)
+}
+
+// animationPalette is the web safe palette with grays and the colors of the cars, so those come out exactly.
+func animationPalette(cars []*animationCar) color.Palette {
+	p := append(color.Palette(nil), palette.WebSafe...)
+	for _, car := range cars {
+		if len(p) < 256 {
+			p = append(p, car.color)
+		}
+	}
+	for gray := 0; gray < 256 && len(p) < 256; gray += 8 {
+		p = append(p, color.Gray{Y: uint8(gray)})
+	}
+	return p
+}
+
+// animationQuantizer converts the frames into the gif palette. Most of a frame is the background, which is quantized
+// once, the colors of the other pixels are looked up in the palette once and then cached.
+type animationQuantizer struct {
+	palette    color.Palette
+	background *image.RGBA
+	quantized  *image.Paletted
+	indices    map[[4]uint8]uint8
+}
+
+func newAnimationQuantizer(p color.Palette, background *image.RGBA) *animationQuantizer {
+	q := &animationQuantizer{palette: p, background: background, indices: map[[4]uint8]uint8{}}
+	q.quantized = q.quantize(background)
+	return q
+}
+
+func (q *animationQuantizer) quantize(img *image.RGBA) *image.Paletted {
+	paletted := image.NewPaletted(img.Rect, q.palette)
+	for i := range paletted.Pix {
+		pixel := [4]uint8{img.Pix[4*i], img.Pix[4*i+1], img.Pix[4*i+2], img.Pix[4*i+3]}
+		if q.quantized != nil && pixel == [4]uint8{q.background.Pix[4*i], q.background.Pix[4*i+1],
+			q.background.Pix[4*i+2], q.background.Pix[4*i+3]} {
+			paletted.Pix[i] = q.quantized.Pix[i]
+			continue
+		}
+		index, ok := q.indices[pixel]
+		if !ok {
+			index = uint8(q.palette.Index(color.RGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: pixel[3]}))
+			q.indices[pixel] = index
+		}
+		paletted.Pix[i] = index
+	}
+	return paletted
+}
+
+// cropAnimationFrame copies the smallest rectangle of the frame that differs from the previous one, at least a pixel
+// since gif frames can't be empty. Without a previous frame the whole frame is kept.
+func cropAnimationFrame(previous *image.Paletted, frame *image.Paletted) *image.Paletted {
+	if previous == nil {
+		return frame
+	}
+	changed := image.Rectangle{}
+	bounds := frame.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		offset := frame.PixOffset(bounds.Min.X, y)
+		current, before := frame.Pix[offset:offset+bounds.Dx()], previous.Pix[offset:offset+bounds.Dx()]
+		for x := range current {
+			if current[x] != before[x] {
+				changed = changed.Union(image.Rect(bounds.Min.X+x, y, bounds.Min.X+x+1, y+1))
+			}
+		}
+	}
+	if changed.Empty() {
+		changed = image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1)
+	}
+
+	cropped := image.NewPaletted(changed, frame.Palette)
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		copy(cropped.Pix[cropped.PixOffset(changed.Min.X, y):], frame.Pix[frame.PixOffset(changed.Min.X, y):frame.PixOffset(changed.Max.X, y)])
+	}
+	return cropped
+}
+
+func parseHexColor(hex string) color.RGBA {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil {
+		return Black
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}
+}
+
+func saveGIF(outputFile string, animation *gif.GIF) error {
+	if !strings.HasSuffix(strings.ToLower(outputFile), ".gif") {
+		outputFile = outputFile + ".gif"
+	}
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(file, animation); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %s\n", outputFile)
+	return nil
+}
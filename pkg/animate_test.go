@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectAnimationLaps(t *testing.T) {
+	lap := func(start int, seconds int, lapType LapType, valid bool) Lap {
+		return Lap{MeasureStartIndex: start, Time: time.Duration(seconds) * time.Second, Type: lapType, Valid: valid}
+	}
+	laps := []Lap{
+		lap(0, 150, OutLap, false),
+		lap(10, 110, FlyingLap, true),
+		lap(20, 108, FlyingLap, true),
+		lap(30, 100, FlyingLap, false),
+		lap(40, 109, FlyingLap, true),
+		lap(50, 130, InLap, false),
+	}
+	runs := []Lap{lap(0, 60, PointToPointRun, true), lap(10, 58, PointToPointRun, true)}
+
+	tests := []struct {
+		name        string
+		laps        []Lap
+		numbers     []int
+		fastestOnly bool
+		labels      []string
+		error       string
+	}{
+		{"two fastest valid laps", laps, nil, false, []string{"Lap 2", "Lap 4"}, ""},
+		{"fastest valid lap", laps, nil, true, []string{"Lap 2"}, ""},
+		{"fastest without valid laps", laps[:1], nil, false, []string{"Lap 0"}, ""},
+		{"given laps in order", laps, []int{3, 0}, false, []string{"Lap 3", "Lap 0"}, ""},
+		{"runs are numbered from 1", runs, []int{1}, false, []string{"Run 1"}, ""},
+		{"unknown lap", laps, []int{6}, false, nil, "there is no lap 6, the session has 6 laps"},
+		{"unknown run", runs, []int{0}, false, nil, "there is no lap 0"},
+		{"no laps", nil, nil, false, nil, "the session doesn't have any laps"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, labels, err := selectAnimationLaps(test.laps, test.numbers, test.fastestOnly)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Errorf("expected an error with '%s', got %v", test.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(labels, test.labels) || len(selected) != len(labels) {
+				t.Errorf("expected the laps %v, got %v", test.labels, labels)
+			}
+		})
+	}
+}
+
+func TestAnimationCarAt(t *testing.T) {
+	car := &animationCar{
+		seconds:        []float64{0, 1, 3},
+		x:              []float64{0, 10, 30},
+		y:              []float64{5, 5, 25},
+		distanceMeters: []float64{0, 20, 60},
+		speedKph:       []float64{50, 70, 90},
+	}
+	tests := []struct {
+		name    string
+		seconds float64
+		state   animationState
+	}{
+		{"start", 0, animationState{x: 0, y: 5, speedKph: 50}},
+		{"between", 2, animationState{index: 1, seconds: 2, x: 20, y: 15, distanceMeters: 40, speedKph: 80}},
+		{"at a measurement", 1, animationState{index: 0, seconds: 1, x: 10, y: 5, distanceMeters: 20, speedKph: 70}},
+		{"finished", 5, animationState{index: 2, seconds: 3, x: 30, y: 25, distanceMeters: 60, speedKph: 90, finished: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if state := car.at(test.seconds); state != test.state {
+				t.Errorf("expected %+v, got %+v", test.state, state)
+			}
+		})
+	}
+}
+
+func TestAnimationFrames(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	red := color.RGBA{R: 250, G: 10, B: 10, A: 255}
+	p := color.Palette{color.RGBA{A: 255}, white, color.RGBA{R: 255, A: 255}}
+
+	background := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(background.Pix); i += 4 {
+		copy(background.Pix[i:], []uint8{white.R, white.G, white.B, white.A})
+	}
+	frame := image.NewRGBA(background.Rect)
+	copy(frame.Pix, background.Pix)
+	frame.SetRGBA(2, 3, red)
+	frame.SetRGBA(5, 4, red)
+
+	quantizer := newAnimationQuantizer(p, background)
+	first := quantizer.quantize(background)
+	second := quantizer.quantize(frame)
+	if second.ColorIndexAt(2, 3) != 2 || second.ColorIndexAt(5, 4) != 2 || second.ColorIndexAt(0, 0) != 1 {
+		t.Errorf("expected the red pixels on white, got %v", second.Pix)
+	}
+
+	if cropped := cropAnimationFrame(nil, first); cropped.Rect != first.Rect {
+		t.Errorf("expected the first frame to be kept whole, got %v", cropped.Rect)
+	}
+	cropped := cropAnimationFrame(first, second)
+	if cropped.Rect != image.Rect(2, 3, 6, 5) || cropped.ColorIndexAt(2, 3) != 2 || cropped.ColorIndexAt(3, 3) != 1 {
+		t.Errorf("expected the changed rectangle, got %v %v", cropped.Rect, cropped.Pix)
+	}
+	if unchanged := cropAnimationFrame(second, second); unchanged.Rect.Dx() != 1 || unchanged.Rect.Dy() != 1 {
+		t.Errorf("expected a single pixel for an unchanged frame, got %v", unchanged.Rect)
+	}
+}
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"sort"
+)
+
+const (
+	// MinValidLapTimeFactor and MaxValidLapTimeFactor bound the valid lap times relative to the median flying lap.
+	MinValidLapTimeFactor = 0.8
+	MaxValidLapTimeFactor = 1.3
+	// MinValidLapDistanceFactor is the fraction of the median flying lap distance (or the track length) that a lap has
+	// to cover, shorter laps cut the track.
+	MinValidLapDistanceFactor = 0.9
+)
+
+// ClassifyLaps sets the type and validity of the laps. The type depends on the pit visits: laps starting in the pit
+// lane are outlaps, laps ending in it are inlaps and laps that enter and leave it are pit-through laps. The first and
+// last lap of the session are always an out- and inlap. Only flying laps can be valid, they are invalid if they are much
+// shorter or longer than the median flying lap or if they didn't cover the whole track. Point-to-point runs are always
+// valid.
+func ClassifyLaps(laps []Lap, pitVisits []PitVisit, track *Track) []Lap {
+	for i := range laps {
+		if laps[i].Type == PointToPointRun {
+			laps[i].Valid = true
+			continue
+		}
+		laps[i].Type = lapType(i, laps, pitVisits)
+	}
+
+	var flyingTimes []float64
+	var flyingDistances []float64
+	for _, lap := range laps {
+		if lap.Type == FlyingLap {
+			flyingTimes = append(flyingTimes, lap.Time.Seconds())
+			flyingDistances = append(flyingDistances, lap.DistanceMeters)
+		}
+	}
+
+	referenceDistance := 0.0
+	if len(flyingDistances) > 0 {
+		referenceDistance = median(flyingDistances)
+	}
+	if track != nil && track.LengthMeters > 0 && len(flyingDistances) < 3 {
+		referenceDistance = track.LengthMeters
+	}
+
+	for i := range laps {
+		if laps[i].Type == PointToPointRun {
+			continue
+		}
+		laps[i].Valid = laps[i].Type == FlyingLap
+		laps[i].InvalidReason = ""
+		if !laps[i].Valid {
+			// out-, in- and pit-through laps are slower and shorter by nature, there is nothing to judge
+			continue
+		}
+		if referenceDistance > 0 && laps[i].DistanceMeters < referenceDistance*MinValidLapDistanceFactor {
+			laps[i].Valid = false
+			laps[i].InvalidReason = "track cut"
+		} else if len(flyingTimes) > 0 && laps[i].Time.Seconds() < median(flyingTimes)*MinValidLapTimeFactor {
+			laps[i].Valid = false
+			laps[i].InvalidReason = "too short"
+		} else if len(flyingTimes) > 0 && laps[i].Time.Seconds() > median(flyingTimes)*MaxValidLapTimeFactor {
+			laps[i].Valid = false
+			laps[i].InvalidReason = "too long"
+		}
+	}
+	return laps
+}
+
+func lapType(i int, laps []Lap, pitVisits []PitVisit) LapType {
+	lap := laps[i]
+	startsInPit := false
+	endsInPit := false
+	visitsPit := false
+	for _, visit := range pitVisits {
+		if visit.MeasureStartIndex >= lap.MeasureEndIndexExclusive || visit.MeasureEndIndexExclusive <= lap.MeasureStartIndex {
+			continue
+		}
+		visitsPit = true
+		if visit.MeasureStartIndex <= lap.MeasureStartIndex {
+			startsInPit = true
+		}
+		if visit.MeasureEndIndexExclusive >= lap.MeasureEndIndexExclusive {
+			endsInPit = true
+		}
+	}
+
+	switch {
+	case i == 0:
+		return OutLap
+	case i == len(laps)-1:
+		return InLap
+	case startsInPit && endsInPit:
+		return PitThroughLap
+	case startsInPit:
+		return OutLap
+	case endsInPit:
+		return InLap
+	case visitsPit:
+		return PitThroughLap
+	}
+	return FlyingLap
+}
+
+// ValidFlyingLaps returns the laps that count for the fastest lap and lap statistics, which are the valid flying laps
+// and point-to-point runs.
+func ValidFlyingLaps(laps []Lap) []Lap {
+	var result []Lap
+	for _, lap := range laps {
+		if lap.Valid {
+			result = append(result, lap)
+		}
+	}
+	return result
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	if len(sorted)%2 == 0 {
+		return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"testing"
+)
+
+// classifyTestLaps are consecutive laps of 100 measurements each with the given times and distances.
+func classifyTestLaps(seconds []float64, distances []float64) []Lap {
+	var laps []Lap
+	for i := range seconds {
+		laps = append(laps, Lap{
+			MeasureStartIndex:        i * 100,
+			MeasureEndIndexExclusive: (i + 1) * 100,
+			Time:                     secondsToDuration(seconds[i]),
+			DistanceMeters:           distances[i],
+		})
+	}
+	return laps
+}
+
+func TestClassifyLaps(t *testing.T) {
+	sameDistance := []float64{2000, 2000, 2000, 2000, 2000, 2000, 2000}
+	runs := classifyTestLaps([]float64{60, 90}, []float64{1000, 1000})
+	for i := range runs {
+		runs[i].Type = PointToPointRun
+	}
+
+	tests := []struct {
+		name      string
+		laps      []Lap
+		pitVisits []PitVisit
+		track     *Track
+		types     []LapType
+		// reasons are the invalid reasons of the flying laps, "valid" for valid ones and "" for the other laps
+		reasons []string
+	}{
+		{"out- and inlap of the session", classifyTestLaps([]float64{150, 100, 101, 120}, sameDistance), nil, nil,
+			[]LapType{OutLap, FlyingLap, FlyingLap, InLap}, []string{"", "valid", "valid", ""}},
+		{"pit visits",
+			classifyTestLaps([]float64{150, 100, 130, 140, 101, 160, 120}, sameDistance),
+			// an inlap into the pit and the outlap after it, a drive through, and a lap spent in the pit lane
+			[]PitVisit{{180, 220}, {320, 340}, {490, 610}}, nil,
+			[]LapType{OutLap, InLap, OutLap, PitThroughLap, InLap, PitThroughLap, InLap},
+			[]string{"", "", "", "", "", "", ""}},
+		{"pit visit at the session start", classifyTestLaps([]float64{150, 100, 101, 120}, sameDistance),
+			[]PitVisit{{0, 50}}, nil,
+			[]LapType{OutLap, FlyingLap, FlyingLap, InLap}, []string{"", "valid", "valid", ""}},
+		{"invalid laps",
+			classifyTestLaps([]float64{150, 100, 101, 102, 79, 131, 100, 120}, []float64{2000, 2000, 2000, 2000, 2000, 2000, 1700, 2000}),
+			nil, nil,
+			[]LapType{OutLap, FlyingLap, FlyingLap, FlyingLap, FlyingLap, FlyingLap, FlyingLap, InLap},
+			[]string{"", "valid", "valid", "valid", "too short", "too long", "track cut", ""}},
+		// with few flying laps, their median distance would be unreliable
+		{"track length", classifyTestLaps([]float64{150, 100, 101, 120}, []float64{2000, 2300, 2000, 2000}),
+			nil, &Track{LengthMeters: 2300},
+			[]LapType{OutLap, FlyingLap, FlyingLap, InLap}, []string{"", "valid", "track cut", ""}},
+		{"without track length", classifyTestLaps([]float64{150, 100, 101, 120}, []float64{2000, 2300, 2000, 2000}),
+			nil, nil,
+			[]LapType{OutLap, FlyingLap, FlyingLap, InLap}, []string{"", "valid", "valid", ""}},
+		{"point-to-point runs", runs, []PitVisit{{0, 200}}, nil,
+			[]LapType{PointToPointRun, PointToPointRun}, []string{"valid", "valid"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			laps := ClassifyLaps(test.laps, test.pitVisits, test.track)
+			for i, lap := range laps {
+				reason := lap.InvalidReason
+				if lap.Valid {
+					reason = "valid"
+				}
+				if lap.Type != test.types[i] || reason != test.reasons[i] {
+					t.Errorf("lap %d: expected %s %q, got %s %q", i, test.types[i], test.reasons[i], lap.Type, reason)
+				}
+			}
+			if valid := ValidFlyingLaps(laps); len(valid) != countValid(test.reasons) {
+				t.Errorf("expected %d valid laps, got %d", countValid(test.reasons), len(valid))
+			}
+		})
+	}
+}
+
+func countValid(reasons []string) int {
+	count := 0
+	for _, reason := range reasons {
+		if reason == "valid" {
+			count++
+		}
+	}
+	return count
+}
@@ -33,3 +33,50 @@ func stddev(measurement []GPSMeasurement, fnc GPSMeasureGetFunc) float64 {
 	mean = sum / float64(len(measurement))
 	return math.Sqrt(mean)
 }
+
+// runningStdDev computes the population standard deviation incrementally (Welford's algorithm).
+type runningStdDev struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (r *runningStdDev) add(x float64) {
+	r.n++
+	delta := x - r.mean
+	r.mean += delta / float64(r.n)
+	r.m2 += delta * (x - r.mean)
+}
+
+func (r *runningStdDev) stddev() float64 {
+	if r.n == 0 {
+		return 0
+	}
+	return math.Sqrt(r.m2 / float64(r.n))
+}
+
+// measureStatistics collects the session wide statistics that the smoothing and lap detection depend on.
+type measureStatistics struct {
+	accuracy      runningStdDev
+	xAcceleration runningStdDev
+	yAcceleration runningStdDev
+	// path is only collected if the start/finish gate has to be inferred, since it grows with the session.
+	path *circuitPath
+}
+
+func newMeasureStatistics() *measureStatistics {
+	return &measureStatistics{}
+}
+
+func (s *measureStatistics) add(m GPSMeasurement) {
+	s.accuracy.add(m.AccuracyMeters)
+	s.xAcceleration.add(m.Acceleration.X)
+	s.yAcceleration.add(m.Acceleration.Y)
+	if s.path != nil {
+		s.path.add(m)
+	}
+}
+
+func (s *measureStatistics) newKalmanSmoother(init GPSMeasurement) *KalmanSmoother {
+	return NewKalmanSmoother(init, s.accuracy.stddev(), s.xAcceleration.stddev(), s.yAcceleration.stddev())
+}
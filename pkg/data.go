@@ -2,11 +2,12 @@ package pkg
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -14,146 +15,317 @@ import (
 
 type GPSMeasureGetFunc func(measurement GPSMeasurement) float64
 
+var (
+	endPointRegex = regexp.MustCompile(`# End Point: ([0-9\.\-]+), ([0-9\.\-]+).*`)
+	lapEventRegex = regexp.MustCompile(`# Lap ([0-9]+): ([0-9]+):([0-9]+):([0-9\.]+)`)
+)
+
 func ReadData(config DataConfig) (*TrackData, error) {
-	trackInfo, measures, err := readTrackMeasures(config.InputFile)
+	raw, err := readTrackMeasures(config)
 	if err != nil {
 		return nil, err
 	}
 
-	filteredMeasures := PredictKalmanFilteredMeasures(measures)
-	data := &TrackData{TrackInformation: trackInfo, GPSMeasurement: measures, FilteredGPSMeasurement: filteredMeasures}
-	laps := extractLaps(config, data)
-	data.Laps = laps
-
+	data, err := NewTrackDataWithEvents(config, raw.TrackInformation, raw.GPSMeasurement, raw.Events)
+	if err != nil {
+		return nil, err
+	}
+	data.SessionInfo = raw.SessionInfo
 	return data, nil
 }
 
-func readTrackMeasures(inputFile string) (*TrackInformation, []GPSMeasurement, error) {
-
-	file, err := os.Open(inputFile)
+// readTrackMeasures reads the raw session without smoothing or laps.
+func readTrackMeasures(config DataConfig) (*TrackData, error) {
+	var trackInfo *TrackInformation
+	var sessionInfo *SessionInfo
+	var measures []GPSMeasurement
+	var events []Event
+	err := streamInputFile(context.Background(), config, StreamCallbacks{
+		TrackInformation: func(info *TrackInformation) error {
+			trackInfo = info
+			return nil
+		},
+		SessionInfo: func(info *SessionInfo) error {
+			sessionInfo = info
+			return nil
+		},
+		Measurement: func(index int, measure GPSMeasurement) error {
+			measures = append(measures, measure)
+			return nil
+		},
+		Event: func(event Event) error {
+			events = append(events, event)
+			return nil
+		},
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	defer file.Close()
 
-	trackInfo := TrackInformation{}
-	var measures []GPSMeasurement
-	scanner := bufio.NewScanner(file)
-	lineCount := 0
+	return &TrackData{TrackInformation: trackInfo, SessionInfo: sessionInfo, GPSMeasurement: measures, Events: events}, nil
+}
+
+// streamTrackAddict parses the raw TrackAddict csv and passes every measurement and annotation to the callbacks,
+// the Lap callback is never called since no laps are computed at this level.
+func streamTrackAddict(ctx context.Context, reader io.Reader, callbacks StreamCallbacks) error {
+	parser := &trackAddictParser{callbacks: callbacks, sessionInfo: newSessionInfo()}
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") {
-			if strings.HasPrefix(line, "# End Point") {
-				r := regexp.MustCompile(`# End Point: ([0-9\.]+), ([0-9\.]+).*`)
-
-				matches := r.FindAllStringSubmatch(line, -1)
-				if matches == nil || len(matches) != 1 || len(matches[0]) != 3 {
-					return nil, nil, errors.New("can't parse end point lat/lng")
-				}
-
-				trackInfo.startLatLng = []float64{mustParseFloat64(matches[0][1]), mustParseFloat64(matches[0][2])}
-				// fmt.Printf("Found Start/End GPS coordinate: [%f/%f]\n", trackInfo.startLatLng[0], trackInfo.startLatLng[1])
-			}
-		} else if strings.HasPrefix(line, "\"Time\"") {
-			// skip the header
-		} else {
-			split := strings.Split(line, ",")
-			if len(split) != 20 {
-				return nil, nil, fmt.Errorf("not enough columns in line %d", lineCount)
-			}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := parser.parseLine(scanner.Text()); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return parser.finish()
+}
+
+type trackAddictParser struct {
+	callbacks     StreamCallbacks
+	trackInfo     TrackInformation
+	sessionInfo   *SessionInfo
+	headerDone    bool
+	trackInfoSent bool
+	measureIndex  int
+	lineCount     int
+	// skipBrokenLines logs lines that can't be parsed instead of failing, live telemetry has some of them.
+	skipBrokenLines bool
+}
 
-			measures = append(measures, GPSMeasurement{
-				relativeTime:       mustParseFloat64(split[0]),
-				utcTimestamp:       mustParseFloat64(split[1]),
-				latLng:             []float64{mustParseFloat64(split[7]), mustParseFloat64(split[8])},
-				altitudeMeters:     mustParseFloat64(split[9]),
-				speedKph:           mustParseFloat64(split[11]),
-				headingDegrees:     mustParseFloat64(split[12]),
-				accuracyMeter:      mustParseFloat64(split[13]),
-				accelerationVector: []float64{mustParseFloat64(split[14]), mustParseFloat64(split[15]), mustParseFloat64(split[16])},
-				trackAddictLap:     mustParseInt(split[2]),
-			})
+func (p *trackAddictParser) parseLine(line string) error {
+	defer func() { p.lineCount++ }()
 
+	if strings.HasPrefix(line, "#") {
+		if !p.headerDone {
+			return p.parseHeaderComment(line)
 		}
-		lineCount++
+		event, err := parseEvent(line, p.measureIndex, p.lineCount)
+		if err != nil {
+			return p.brokenLine(err)
+		}
+		return p.emitEvent(event)
+	} else if strings.HasPrefix(line, "\"Time\"") {
+		p.sessionInfo.parseHeaderLine(line)
+		p.headerDone = true
+		return nil
+	} else if strings.TrimSpace(line) == "" {
+		return nil
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, nil, err
+	p.headerDone = true
+	split := strings.Split(line, ",")
+	if len(split) != 20 {
+		return p.brokenLine(fmt.Errorf("not enough columns in line %d", p.lineCount))
+	}
+
+	columns := &columnParser{fields: split, lineCount: p.lineCount}
+	measure := GPSMeasurement{
+		RelativeTime:   columns.float(0, "time"),
+		UTCTimestamp:   columns.float(1, "utc time"),
+		LatLng:         LatLng{Lat: columns.float(7, "latitude"), Lng: columns.float(8, "longitude")},
+		AltitudeMeters: columns.float(9, "altitude"),
+		SpeedKph:       columns.float(11, "speed"),
+		HeadingDegrees: columns.float(12, "heading"),
+		AccuracyMeters: columns.float(13, "accuracy"),
+		Acceleration:   Acceleration{X: columns.float(14, "accel x"), Y: columns.float(15, "accel y"), Z: columns.float(16, "accel z")},
+		TrackAddictLap: columns.int(2, "lap"),
+		GPSUpdate:      split[5] == "1",
+		Channels: TrackAddictChannels{
+			PredictedLapSeconds:       columns.float(3, "predicted lap time"),
+			PredictedVsBestLapSeconds: columns.float(4, "predicted vs best lap"),
+			GPSDelaySeconds:           columns.float(6, "gps delay"),
+			Brake:                     columns.float(17, "brake"),
+			BarometricPressureKPa:     columns.float(18, "barometric pressure"),
+			PressureAltitudeMeters:    columns.float(19, "pressure altitude"),
+		},
+	}
+	if columns.err != nil {
+		return p.brokenLine(columns.err)
+	}
+
+	if !p.trackInfoSent {
+		p.sessionInfo.StartTime = measure.Time()
+		if err := p.emitTrackInformation(); err != nil {
+			return err
+		}
 	}
 
-	return &trackInfo, measures, nil
+	index := p.measureIndex
+	p.measureIndex++
+	if p.callbacks.Measurement != nil {
+		return p.callbacks.Measurement(index, measure)
+	}
+	return nil
 }
 
-func PredictKalmanFilteredMeasures(measurement []GPSMeasurement) []GPSMeasurement {
-	init := measurement[0]
-
-	gpsErrorStdDevMeters := stddev(measurement,
-		func(measurement GPSMeasurement) float64 {
-			return measurement.accuracyMeter
-		})
-
-	xAccelerationStdDev := stddev(measurement,
-		func(measurement GPSMeasurement) float64 {
-			return measurement.accelerationVector[0]
-		})
-	latFilter := NewKalmanFilterFusedPositionAccelerometer(latToMeter(init.latLng[0]),
-		gpsErrorStdDevMeters, xAccelerationStdDev, init.utcTimestamp)
-
-	yAccelerationStdDev := stddev(measurement,
-		func(measurement GPSMeasurement) float64 {
-			return measurement.accelerationVector[1]
-		})
-	lngFilter := NewKalmanFilterFusedPositionAccelerometer(lngToMeter(init.latLng[1]),
-		gpsErrorStdDevMeters, yAccelerationStdDev, init.utcTimestamp)
+// brokenLine returns the parse error, unless broken lines are skipped.
+func (p *trackAddictParser) brokenLine(err error) error {
+	if p.skipBrokenLines {
+		log.Printf("Skipping line: %v", err)
+		return nil
+	}
+	return err
+}
 
-	// fmt.Printf("GPS Error stddev [%f], X Accelerator stddev [%f], y Accelerator stddev [%f] \n",
-	//	   gpsErrorStdDevMeters, xAccelerationStdDev, yAccelerationStdDev)
+func (p *trackAddictParser) parseHeaderComment(line string) error {
+	p.sessionInfo.parseHeaderLine(line)
+	if strings.HasPrefix(line, "# End Point") {
+		matches := endPointRegex.FindAllStringSubmatch(line, -1)
+		if matches == nil || len(matches) != 1 || len(matches[0]) != 3 {
+			return errors.New("can't parse end point lat/lng")
+		}
 
-	var output []GPSMeasurement
-	for i := 1; i < len(measurement); i++ {
-		data := measurement[i]
+		columns := &columnParser{fields: matches[0][1:], lineCount: p.lineCount}
+		start := LatLng{Lat: columns.float(0, "end point latitude"), Lng: columns.float(1, "end point longitude")}
+		if columns.err != nil {
+			return columns.err
+		}
+		p.trackInfo.StartLatLng = &start
+		// fmt.Printf("Found Start/End GPS coordinate: [%f/%f]\n", p.trackInfo.StartLatLng.Lat, p.trackInfo.StartLatLng.Lng)
+	}
+	return nil
+}
 
-		speedMetersPerSecond := data.speedKph / 3.6
-		xVel := speedMetersPerSecond * math.Cos(data.headingDegrees)
-		yVel := speedMetersPerSecond * math.Sin(data.headingDegrees)
+func (p *trackAddictParser) emitTrackInformation() error {
+	if p.trackInfoSent {
+		return nil
+	}
+	p.trackInfoSent = true
+	if p.callbacks.SessionInfo != nil {
+		if err := p.callbacks.SessionInfo(p.sessionInfo); err != nil {
+			return err
+		}
+	}
+	if p.callbacks.TrackInformation != nil {
+		info := p.trackInfo
+		return p.callbacks.TrackInformation(&info)
+	}
+	return nil
+}
 
-		latFilter.Predict(data.accelerationVector[0], init.utcTimestamp)
-		lngFilter.Predict(data.accelerationVector[1], init.utcTimestamp)
+func (p *trackAddictParser) emitEvent(event Event) error {
+	if p.callbacks.Event != nil {
+		return p.callbacks.Event(event)
+	}
+	return nil
+}
 
-		latFilter.Update(latToMeter(data.latLng[0]), xVel, &data.accuracyMeter, 0)
-		lngFilter.Update(lngToMeter(data.latLng[1]), yVel, &data.accuracyMeter, 0)
+func (p *trackAddictParser) finish() error {
+	return p.emitTrackInformation()
+}
 
-		point := metersToGeoPoint(latFilter.GetPredictedPosition(), lngFilter.GetPredictedPosition())
-		//fmt.Printf("[%f] vs. [%f]\n", data.latLng, point)
-		output = append(output, GPSMeasurement{
-			latLng:             point,
-			altitudeMeters:     data.altitudeMeters,
-			relativeTime:       data.relativeTime,
-			accelerationVector: data.accelerationVector,
-			speedKph:           data.speedKph,
-			utcTimestamp:       data.utcTimestamp,
-			trackAddictLap:     data.trackAddictLap,
-			accuracyMeter:      data.accuracyMeter,
-			headingDegrees:     data.headingDegrees,
-		})
+func parseEvent(line string, measureIndex int, lineCount int) (Event, error) {
+	event := Event{Type: UnknownEvent, MeasureIndex: measureIndex, Text: strings.TrimSpace(strings.TrimPrefix(line, "#"))}
+	switch {
+	case strings.HasPrefix(line, "# Lap "):
+		matches := lapEventRegex.FindStringSubmatch(line)
+		if matches != nil {
+			columns := &columnParser{fields: matches[1:], lineCount: lineCount}
+			lap := columns.int(0, "lap number")
+			seconds := float64(columns.int(1, "hours"))*3600 + float64(columns.int(2, "minutes"))*60 + columns.float(3, "seconds")
+			if columns.err != nil {
+				return event, columns.err
+			}
+			event.Type = LapEvent
+			event.LapNumber = lap
+			event.LapTime = secondsToDuration(seconds)
+		}
+	case strings.HasPrefix(line, "# Pit Lane Entry"):
+		event.Type = PitLaneEntryEvent
+	case strings.HasPrefix(line, "# Pit Lane Exit"):
+		event.Type = PitLaneExitEvent
+	case strings.HasPrefix(line, "# Session End"):
+		event.Type = SessionEndEvent
+	}
+	return event, nil
+}
+
+func PredictKalmanFilteredMeasures(measurement []GPSMeasurement) []GPSMeasurement {
+	if len(measurement) == 0 {
+		return nil
+	}
+
+	stats := newMeasureStatistics()
+	for _, m := range measurement {
+		stats.add(m)
+	}
+	smoother := stats.newKalmanSmoother(measurement[0])
+
+	var output []GPSMeasurement
+	for i := 1; i < len(measurement); i++ {
+		output = append(output, smoother.Smooth(measurement[i]))
 	}
 
 	return output
 }
 
-func mustParseFloat64(s string) float64 {
-	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		log.Fatalf("can't parse float: %s", s)
+// KalmanSmoother smoothes the GPS position of a sequence of measurements one at a time.
+type KalmanSmoother struct {
+	init      GPSMeasurement
+	latFilter *KalmanFilterFusedPositionAccelerometer
+	lngFilter *KalmanFilterFusedPositionAccelerometer
+}
+
+// NewKalmanSmoother creates a smoother starting at the given measurement, the standard deviations are usually
+// computed over the whole session.
+func NewKalmanSmoother(init GPSMeasurement, gpsErrorStdDevMeters float64, xAccelerationStdDev float64, yAccelerationStdDev float64) *KalmanSmoother {
+	// fmt.Printf("GPS Error stddev [%f], X Accelerator stddev [%f], y Accelerator stddev [%f] \n",
+	//	   gpsErrorStdDevMeters, xAccelerationStdDev, yAccelerationStdDev)
+	return &KalmanSmoother{
+		init: init,
+		latFilter: NewKalmanFilterFusedPositionAccelerometer(latToMeter(init.LatLng.Lat),
+			gpsErrorStdDevMeters, xAccelerationStdDev, init.UTCTimestamp),
+		lngFilter: NewKalmanFilterFusedPositionAccelerometer(lngToMeter(init.LatLng.Lng),
+			gpsErrorStdDevMeters, yAccelerationStdDev, init.UTCTimestamp),
 	}
+}
+
+// Smooth feeds the next measurement into the filter and returns a copy of it with the predicted position.
+func (s *KalmanSmoother) Smooth(data GPSMeasurement) GPSMeasurement {
+	speedMetersPerSecond := data.SpeedMetersPerSecond()
+	xVel := speedMetersPerSecond * math.Cos(data.HeadingDegrees)
+	yVel := speedMetersPerSecond * math.Sin(data.HeadingDegrees)
+
+	s.latFilter.Predict(data.Acceleration.X, s.init.UTCTimestamp)
+	s.lngFilter.Predict(data.Acceleration.Y, s.init.UTCTimestamp)
+
+	s.latFilter.Update(latToMeter(data.LatLng.Lat), xVel, &data.AccuracyMeters, 0)
+	s.lngFilter.Update(lngToMeter(data.LatLng.Lng), yVel, &data.AccuracyMeters, 0)
+
+	point := metersToGeoPoint(s.latFilter.GetPredictedPosition(), s.lngFilter.GetPredictedPosition())
+	//fmt.Printf("[%f] vs. [%f]\n", data.LatLng, point)
+	data.LatLng = point
+	return data
+}
+
+// columnParser parses the values of a line and keeps the first error, so that a line is checked once after all of
+// its values are read.
+type columnParser struct {
+	fields    []string
+	lineCount int
+	err       error
+}
+
+func (c *columnParser) float(index int, name string) float64 {
+	f, err := strconv.ParseFloat(c.fields[index], 64)
+	c.fail(name, err)
 	return f
 }
 
-func mustParseInt(s string) int {
-	i, err := strconv.ParseInt(s, 10, 32)
-	if err != nil {
-		log.Fatalf("can't parse int: %s", s)
-	}
+func (c *columnParser) int(index int, name string) int {
+	i, err := strconv.ParseInt(c.fields[index], 10, 32)
+	c.fail(name, err)
 	return int(i)
 }
+
+func (c *columnParser) fail(name string, err error) {
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("can't parse the %s in line %d: %v", name, c.lineCount, err)
+	}
+}
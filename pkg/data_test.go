@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTrackAddictHeader = `# RaceRender Data: TrackAddict 4.3.5 on Android 9 [samsung SM-N960F] (Mode: 0)
+# End Point: 51.99907, 13.68830  @ -1.00 deg
+"Time","UTC Time","Lap","Predicted Lap Time","Predicted vs Best Lap","GPS_Update","GPS_Delay","Latitude","Longitude","Altitude (m)","Altitude (ft)","Speed (Km/h)","Heading","Accuracy (m)","Accel X","Accel Y","Accel Z","Brake (calculated)","Barometric Pressure (kPa)","Pressure Altitude (m)"
+`
+
+func TestStreamTrackAddict(t *testing.T) {
+	csv := testTrackAddictHeader +
+		"0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n" +
+		"# Lap 0: 00:01:47.089\n" +
+		"0.050,1559734111.050,1,0,0,0,0.000,51.9993283,13.6881679,91.2,299,12.5,90.0,5.0,0.10,-0.20,0.30,1,100.44,74.1\n" +
+		"# Session End\n"
+
+	var info *TrackInformation
+	var measures []GPSMeasurement
+	var events []Event
+	err := streamTrackAddict(context.Background(), strings.NewReader(csv), StreamCallbacks{
+		TrackInformation: func(i *TrackInformation) error {
+			info = i
+			return nil
+		},
+		Measurement: func(index int, m GPSMeasurement) error {
+			measures = append(measures, m)
+			return nil
+		},
+		Event: func(event Event) error {
+			events = append(events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info == nil || info.StartLatLng == nil || *info.StartLatLng != (LatLng{Lat: 51.99907, Lng: 13.68830}) {
+		t.Errorf("expected the End Point as start, got %+v", info)
+	}
+	if len(measures) != 2 {
+		t.Fatalf("expected 2 measurements, got %d", len(measures))
+	}
+	m := measures[1]
+	if m.RelativeTime != 0.05 || m.TrackAddictLap != 1 || m.GPSUpdate || m.SpeedKph != 12.5 || m.HeadingDegrees != 90 ||
+		m.Acceleration != (Acceleration{X: 0.1, Y: -0.2, Z: 0.3}) {
+		t.Errorf("unexpected measurement %+v", m)
+	}
+	if len(events) != 2 || events[0].Type != LapEvent || events[0].LapNumber != 0 || events[0].MeasureIndex != 1 ||
+		events[0].LapTime != 107089*time.Millisecond || events[1].Type != SessionEndEvent {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestStreamTrackAddictErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		error string
+	}{
+		{"latitude", "0.000,1559734111.000,0,0,0,1,0.000,abc,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1",
+			"can't parse the latitude in line 3"},
+		{"lap", "0.000,1559734111.000,x,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1",
+			"can't parse the lap in line 3"},
+		{"columns", "0.000,1559734111.000,0,0,0,1", "not enough columns in line 3"},
+		{"lap annotation", "# Lap 0: 00:01:47.0.89", "can't parse the seconds in line 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := streamTrackAddict(context.Background(), strings.NewReader(testTrackAddictHeader+test.line+"\n"), StreamCallbacks{})
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("expected an error with '%s', got %v", test.error, err)
+			}
+		})
+	}
+}
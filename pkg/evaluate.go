@@ -0,0 +1,372 @@
+package pkg
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EvaluationMatchToleranceSeconds is how far a detected lap boundary may be off to still count for a true one.
+	EvaluationMatchToleranceSeconds = 3.0
+	// EvaluationMaxLagSeconds is the largest smoothing lag that is searched for.
+	EvaluationMaxLagSeconds = 3.0
+)
+
+type EvaluationConfig struct {
+	DataConfig
+	// TruthFile is the truth json written by Simulate, defaults to the one next to the input file. Without one,
+	// the "# Lap N:" annotations of the session are the truth.
+	TruthFile string
+}
+
+// Evaluation compares every smoother and lap detector against the truth of a session.
+type Evaluation struct {
+	// TruthSource describes where the truth came from.
+	TruthSource string
+	TruthLaps   []Lap
+	Smoothers   []SmootherEvaluation
+	Detectors   []DetectorEvaluation
+}
+
+// SmootherEvaluation is only available with true positions, which only simulated sessions have.
+type SmootherEvaluation struct {
+	Smoother           string
+	PositionRMSEMeters float64
+	// LagSeconds is the delay of the positions against the true ones, it includes the latency of the GPS receiver.
+	LagSeconds float64
+}
+
+type DetectorEvaluation struct {
+	Smoother string
+	Detector string
+	Laps     []Lap
+	// Missed are true lap boundaries without a detected one, Extra are detected boundaries without a true one.
+	Missed int
+	Extra  int
+	// LapErrorSeconds is the detected minus the true time of every true lap, NaN if one of its boundaries was missed.
+	LapErrorSeconds []float64
+}
+
+// MeanAbsoluteErrorSeconds is the average error over the laps whose boundaries were both detected.
+func (e DetectorEvaluation) MeanAbsoluteErrorSeconds() float64 {
+	sum, count := 0.0, 0
+	for _, err := range e.LapErrorSeconds {
+		if !math.IsNaN(err) {
+			sum += math.Abs(err)
+			count++
+		}
+	}
+	if count == 0 {
+		return math.NaN()
+	}
+	return sum / float64(count)
+}
+
+// MaxAbsoluteErrorSeconds is the worst error over the laps whose boundaries were both detected.
+func (e DetectorEvaluation) MaxAbsoluteErrorSeconds() float64 {
+	max := math.NaN()
+	for _, err := range e.LapErrorSeconds {
+		if !math.IsNaN(err) && (math.IsNaN(max) || math.Abs(err) > max) {
+			max = math.Abs(err)
+		}
+	}
+	return max
+}
+
+// truthPosition is a line of the positions file written by Simulate.
+type truthPosition struct {
+	seconds float64
+	latLng  LatLng
+}
+
+// Evaluate runs all smoothers and lap detectors on the input file and compares them against the truth.
+func Evaluate(config EvaluationConfig) (*Evaluation, error) {
+	truthFile := config.TruthFile
+	if truthFile == "" {
+		if candidate, _ := SimulationTruthFiles(config.InputFile); fileExists(candidate) {
+			truthFile = candidate
+		}
+	}
+
+	var truth *SimulationTruth
+	if truthFile != "" {
+		var err error
+		if truth, err = ReadSimulationTruth(truthFile); err != nil {
+			return nil, err
+		}
+		// the gate of the simulation is the one the truth was timed with
+		if config.StartGate == nil && config.TrackName == "" {
+			config.StartGate = &truth.StartFinish
+		}
+	}
+
+	config.RecalculateLaps = true
+	data, err := ReadData(config.DataConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := &Evaluation{}
+	var positions []truthPosition
+	if truth != nil {
+		evaluation.TruthSource = "simulation " + truthFile
+		evaluation.TruthLaps = truth.Laps
+		if positions, err = readTruthPositions(truth.PositionsFile); err != nil {
+			return nil, err
+		}
+		if len(positions) != len(data.GPSMeasurement) {
+			return nil, fmt.Errorf("the truth has %d positions but the session %d measurements", len(positions), len(data.GPSMeasurement))
+		}
+	} else {
+		evaluation.TruthSource = "lap annotations of the session"
+		evaluation.TruthLaps = annotatedLaps(data)
+		if len(evaluation.TruthLaps) == 0 {
+			return nil, errors.New("there is no truth, the session has no lap annotations and no simulation truth next to it")
+		}
+	}
+
+	smoothers := []struct {
+		name     string
+		measures []GPSMeasurement
+		// offset is the index of the first measure in the raw measurements
+		offset int
+	}{
+		{"none", data.GPSMeasurement, 0},
+		// the Kalman filter starts at the first measurement and only returns the ones after it
+		{"kalman", data.FilteredGPSMeasurement, 1},
+	}
+	for _, smoother := range smoothers {
+		if positions != nil {
+			evaluation.Smoothers = append(evaluation.Smoothers, evaluateSmoother(smoother.name, smoother.measures, smoother.offset, positions))
+		}
+		// TrackAddict's own laps are timed by the lap annotations, compared against them they can't be wrong
+		for _, detector := range evaluationDetectors(data.TrackInformation, smoother.measures, truth != nil) {
+			laps := detectLaps(detector.detector, smoother.measures, data.Events)
+			evaluation.Detectors = append(evaluation.Detectors, evaluateDetector(smoother.name, detector.name, laps, evaluation.TruthLaps, truth != nil))
+		}
+	}
+	return evaluation, nil
+}
+
+type namedLapDetector struct {
+	name     string
+	detector lapDetector
+}
+
+// evaluationDetectors are all lap detectors that work with the track information of the session, the one reading the
+// laps of TrackAddict only if withTrackAddict is set.
+func evaluationDetectors(trackInfo *TrackInformation, measures []GPSMeasurement, withTrackAddict bool) []namedLapDetector {
+	gpsErrorStdDevMeters := stddev(measures,
+		func(measurement GPSMeasurement) float64 {
+			return measurement.AccuracyMeters
+		})
+
+	var detectors []namedLapDetector
+	if withTrackAddict {
+		detectors = append(detectors, namedLapDetector{"trackaddict", newLapDetector(DataConfig{}, trackInfo, gpsErrorStdDevMeters)})
+	}
+	if trackInfo.StartLatLng != nil {
+		withoutTrack := *trackInfo
+		withoutTrack.Track = nil
+		detectors = append(detectors, namedLapDetector{"threshold", newLapDetector(DataConfig{RecalculateLaps: true}, &withoutTrack, gpsErrorStdDevMeters)})
+	}
+	if trackInfo.Track != nil {
+		detectors = append(detectors, namedLapDetector{"gate", newLapDetector(DataConfig{RecalculateLaps: true}, trackInfo, gpsErrorStdDevMeters)})
+	}
+	return detectors
+}
+
+// annotatedLaps are the laps TrackAddict wrote as "# Lap N: 00:01:48.011", the first one starts with the session.
+func annotatedLaps(data *TrackData) []Lap {
+	var laps []Lap
+	start := data.GPSMeasurement[0].RelativeTime
+	for _, event := range data.Events {
+		if event.Type != LapEvent {
+			continue
+		}
+		laps = append(laps, Lap{Time: event.LapTime, StartTimeSeconds: start, Type: FlyingLap})
+		start += event.LapTime.Seconds()
+	}
+	if len(laps) > 0 {
+		laps[0].Type = OutLap
+	}
+	return laps
+}
+
+func evaluateSmoother(name string, measures []GPSMeasurement, offset int, positions []truthPosition) SmootherEvaluation {
+	interval := (positions[len(positions)-1].seconds - positions[0].seconds) / float64(len(positions)-1)
+	maxShift := int(EvaluationMaxLagSeconds / interval)
+
+	rmse := func(shift int) float64 {
+		sum, count := 0.0, 0
+		for i, m := range measures {
+			truthIndex := i + offset - shift
+			if truthIndex < 0 || truthIndex >= len(positions) {
+				continue
+			}
+			distance := haversineDistance(m.LatLng, positions[truthIndex].latLng)
+			sum += distance * distance
+			count++
+		}
+		return math.Sqrt(sum / float64(count))
+	}
+
+	evaluation := SmootherEvaluation{Smoother: name, PositionRMSEMeters: rmse(0)}
+	best := evaluation.PositionRMSEMeters
+	for shift := 1; shift <= maxShift; shift++ {
+		if e := rmse(shift); e < best {
+			best = e
+			evaluation.LagSeconds = float64(shift) * interval
+		}
+	}
+	return evaluation
+}
+
+// lapBoundaries are the times at which the laps end, without the end of the session.
+func lapBoundaries(laps []Lap, includeLast bool) []float64 {
+	var boundaries []float64
+	for i, lap := range laps {
+		if i < len(laps)-1 || includeLast {
+			boundaries = append(boundaries, lap.StartTimeSeconds+lap.Time.Seconds())
+		}
+	}
+	return boundaries
+}
+
+// evaluateDetector matches the detected lap boundaries to the true ones. The last simulated lap ends with the session
+// like the last detected one, while the lap annotations only contain completed laps.
+func evaluateDetector(smoother string, detector string, laps []Lap, truthLaps []Lap, truthEndsWithSession bool) DetectorEvaluation {
+	evaluation := DetectorEvaluation{Smoother: smoother, Detector: detector, Laps: laps}
+	truthBoundaries := lapBoundaries(truthLaps, !truthEndsWithSession)
+	detected := lapBoundaries(laps, false)
+
+	// matches of the true boundaries to detected ones, in order
+	matched := make([]float64, len(truthBoundaries))
+	used := make([]bool, len(detected))
+	next := 0
+	for i, boundary := range truthBoundaries {
+		matched[i] = math.NaN()
+		best := -1
+		for j := next; j < len(detected); j++ {
+			if detected[j] > boundary+EvaluationMatchToleranceSeconds {
+				break
+			}
+			if math.Abs(detected[j]-boundary) <= EvaluationMatchToleranceSeconds &&
+				(best < 0 || math.Abs(detected[j]-boundary) < math.Abs(detected[best]-boundary)) {
+				best = j
+			}
+		}
+		if best < 0 {
+			evaluation.Missed++
+			continue
+		}
+		matched[i] = detected[best]
+		used[best] = true
+		next = best + 1
+	}
+	for _, u := range used {
+		if !u {
+			evaluation.Extra++
+		}
+	}
+
+	for i, lap := range truthLaps {
+		// the session starts and ends at the same time for the truth and the detection
+		start, end := lap.StartTimeSeconds, lap.StartTimeSeconds+lap.Time.Seconds()
+		if i > 0 {
+			start = matched[i-1]
+		}
+		if i < len(matched) {
+			end = matched[i]
+		}
+		evaluation.LapErrorSeconds = append(evaluation.LapErrorSeconds, end-start-lap.Time.Seconds())
+	}
+	return evaluation
+}
+
+func readTruthPositions(file string) ([]truthPosition, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var positions []truthPosition
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\"") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		split := strings.Split(line, ",")
+		if len(split) < 3 {
+			return nil, fmt.Errorf("invalid line in %s: %s", file, line)
+		}
+		var values [3]float64
+		for i := range values {
+			if values[i], err = strconv.ParseFloat(split[i], 64); err != nil {
+				return nil, fmt.Errorf("invalid line in %s: %s", file, line)
+			}
+		}
+		positions = append(positions, truthPosition{seconds: values[0], latLng: LatLng{Lat: values[1], Lng: values[2]}})
+	}
+	return positions, scanner.Err()
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+func PrettyPrintEvaluation(evaluation *Evaluation) {
+	fmt.Printf("Truth: %s with %d laps\n", evaluation.TruthSource, len(evaluation.TruthLaps))
+
+	if len(evaluation.Smoothers) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Smoother", "Position RMSE (m)", "Lag (s)"})
+		for _, s := range evaluation.Smoothers {
+			table.Append([]string{s.Smoother, fmt.Sprintf("%.2f", s.PositionRMSEMeters), fmt.Sprintf("%.2f", s.LagSeconds)})
+		}
+		table.Render()
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Smoother", "Lap Detector", "Laps", "Missed", "Extra", "Mean Lap Error (s)", "Max Lap Error (s)"})
+	for _, d := range evaluation.Detectors {
+		table.Append([]string{d.Smoother, d.Detector, strconv.Itoa(len(d.Laps)), strconv.Itoa(d.Missed), strconv.Itoa(d.Extra),
+			evaluationSecondsFormat(d.MeanAbsoluteErrorSeconds()), evaluationSecondsFormat(d.MaxAbsoluteErrorSeconds())})
+	}
+	table.Render()
+
+	header := []string{"Lap", "Type", "True Time"}
+	for _, d := range evaluation.Detectors {
+		header = append(header, d.Smoother+"/"+d.Detector)
+	}
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	for i, lap := range evaluation.TruthLaps {
+		row := []string{strconv.Itoa(i), lap.Type.String(), lap.Time.String()}
+		for _, d := range evaluation.Detectors {
+			if math.IsNaN(d.LapErrorSeconds[i]) {
+				row = append(row, "missed")
+			} else {
+				row = append(row, fmt.Sprintf("%+.3f", d.LapErrorSeconds[i]))
+			}
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
+
+func evaluationSecondsFormat(seconds float64) string {
+	if math.IsNaN(seconds) {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f", seconds)
+}
@@ -0,0 +1,365 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatRaceRender = "racerender"
+	ExportFormatCSV        = "csv"
+	// gForceWindowSeconds is the window of the derivatives for the computed g forces, it keeps the GPS noise down
+	gForceWindowSeconds = 1.0
+)
+
+// ExportConfig configures the conversion of a session into the formats of other tools.
+type ExportConfig struct {
+	DataConfig
+	OutputFile string
+	// Format is one of the ExportFormats.
+	Format string
+	// PointSpeeds adds a point with the speed for every GPS fix to the KML and GeoJSON export.
+	PointSpeeds bool
+	// SampleRateHz is the fixed rate of the MoTeC export, DefaultMoTeCSampleRateHz if it isn't set.
+	SampleRateHz float64
+}
+
+// exporter writes a session in one format, the extension is appended to output files that don't have it.
+type exporter struct {
+	extension string
+	write     func(data *TrackData, config ExportConfig, w io.Writer) error
+}
+
+var exporters = map[string]exporter{
+	ExportFormatRaceRender: {extension: ".csv", write: writeRaceRender},
+	ExportFormatCSV:        {extension: ".csv", write: writeExportCSV},
+	ExportFormatKML:        {extension: ".kml", write: writeKML},
+	ExportFormatGeoJSON:    {extension: ".geojson", write: writeGeoJSON},
+	ExportFormatVBO:        {extension: ".vbo", write: writeVBO},
+	ExportFormatMoTeC:      {extension: ".csv", write: writeMoTeC},
+}
+
+// ExportFormats returns the names of the supported export formats.
+func ExportFormats() []string {
+	var formats []string
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Export writes the session in the format of the config into the output file.
+func Export(data *TrackData, config ExportConfig) error {
+	exporter, ok := exporters[config.Format]
+	if !ok {
+		return fmt.Errorf("unknown export format '%s', expected one of %s", config.Format, strings.Join(ExportFormats(), ", "))
+	}
+
+	outputFile := config.OutputFile
+	if !strings.HasSuffix(strings.ToLower(outputFile), exporter.extension) {
+		outputFile = outputFile + exporter.extension
+	}
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	if err := WriteExport(data, config, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %s\n", outputFile)
+	return nil
+}
+
+// WriteExport writes the session in the format of the config into the writer.
+func WriteExport(data *TrackData, config ExportConfig, w io.Writer) error {
+	exporter, ok := exporters[config.Format]
+	if !ok {
+		return fmt.Errorf("unknown export format '%s', expected one of %s", config.Format, strings.Join(ExportFormats(), ", "))
+	}
+	buffered := bufio.NewWriter(w)
+	if err := exporter.write(data, config, buffered); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// writeRaceRender writes a TrackAddict csv that RaceRender and TrackAddict read. If the laps were recalculated, the
+// Lap column and the "# Lap N:" annotations are regenerated from them, otherwise the ones of the app are kept.
+func writeRaceRender(data *TrackData, config ExportConfig, w io.Writer) error {
+	measures := data.Measures(config.DataConfig)
+	return writeTrackAddictPart(data, config.DataConfig, SessionPart{MeasureEndIndexExclusive: len(measures)}, w)
+}
+
+// writeTrackAddictPart writes the measurements of the part like writeRaceRender, with the time relative to the start of
+// the part. Only the laps within the part are annotated, the other annotations are kept if they are within the part,
+// except for the annotation of a lap that began before the part.
+func writeTrackAddictPart(data *TrackData, config DataConfig, part SessionPart, w io.Writer) error {
+	measures := data.Measures(config)
+	// the lap times the app annotated are exact, they are only replaced by recalculated laps
+	regenerateLaps := config.RecalculateLaps
+	lapNumbers := exportLapNumbers(data.Laps, len(measures))
+
+	var comments []string
+	if data.SessionInfo != nil {
+		comments = data.SessionInfo.HeaderComments
+	}
+	if err := writeReplayLines(w, raceRenderHeader(comments, data.TrackInformation)); err != nil {
+		return err
+	}
+
+	// the annotations are written before the measurement they refer to, the lap annotations right after their last one
+	annotations := map[int][]string{}
+	for i, lap := range data.Laps {
+		if !regenerateLaps || lap.MeasureStartIndex < part.MeasureStartIndex || lap.MeasureEndIndexExclusive > part.MeasureEndIndexExclusive {
+			continue
+		}
+		annotations[lap.MeasureEndIndexExclusive] = append(annotations[lap.MeasureEndIndexExclusive],
+			fmt.Sprintf("# Lap %d: %s", exportLapNumber(i, lap), formatLapAnnotation(lap.Time)))
+	}
+	// the lap the part starts in began before it, its annotation would time it from there
+	partialLap := -1
+	if start := part.MeasureStartIndex; start > 0 && start < len(measures) &&
+		measures[start-1].TrackAddictLap == measures[start].TrackAddictLap {
+		partialLap = measures[start].TrackAddictLap
+	}
+	// a part that is cut from a session that was ended properly ends properly too
+	missingSessionEnd := false
+	for _, event := range data.Events {
+		index := processedMeasureIndex(config, event.MeasureIndex)
+		if event.Type == LapEvent {
+			// a lap annotation follows the last measurement of its lap
+			if !regenerateLaps && event.LapNumber != partialLap && index > part.MeasureStartIndex &&
+				index <= part.MeasureEndIndexExclusive {
+				annotations[index] = append(annotations[index], "# "+event.Text)
+			}
+			continue
+		}
+		// everything after the last measurement, like the end of the session, belongs to the last part
+		if index < part.MeasureStartIndex || (index >= part.MeasureEndIndexExclusive && part.MeasureEndIndexExclusive < len(measures)) {
+			missingSessionEnd = missingSessionEnd || event.Type == SessionEndEvent
+			continue
+		}
+		annotations[index] = append(annotations[index], "# "+event.Text)
+	}
+	if missingSessionEnd {
+		annotations[part.MeasureEndIndexExclusive] = append(annotations[part.MeasureEndIndexExclusive], "# Session End")
+	}
+
+	startSeconds := 0.0
+	if part.MeasureStartIndex > 0 && part.MeasureStartIndex < len(measures) {
+		startSeconds = measures[part.MeasureStartIndex].RelativeTime
+	}
+	for i := part.MeasureStartIndex; i < part.MeasureEndIndexExclusive && i < len(measures); i++ {
+		if err := writeReplayLines(w, annotations[i]); err != nil {
+			return err
+		}
+		m := measures[i]
+		if regenerateLaps {
+			m.TrackAddictLap = lapNumbers[i]
+		}
+		m.RelativeTime -= startSeconds
+		if err := writeReplayLines(w, []string{formatTrackAddictLine(m)}); err != nil {
+			return err
+		}
+	}
+	var trailing []int
+	for index := range annotations {
+		if index >= part.MeasureEndIndexExclusive {
+			trailing = append(trailing, index)
+		}
+	}
+	sort.Ints(trailing)
+	for _, index := range trailing {
+		if err := writeReplayLines(w, annotations[index]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raceRenderHeader keeps the header comments of the app, the end point is replaced by the start/finish of the laps.
+func raceRenderHeader(comments []string, info *TrackInformation) []string {
+	header := trackAddictHeader(info)
+	endPoint, columns := header[:len(header)-1], header[len(header)-1]
+
+	var lines []string
+	for _, comment := range comments {
+		if strings.HasPrefix(comment, "# End Point") {
+			lines = append(lines, endPoint...)
+			endPoint = nil
+			continue
+		}
+		lines = append(lines, comment)
+	}
+	if len(endPoint) > 0 {
+		// the end point follows the line that names the app, if there is one
+		position := 0
+		if len(lines) > 0 && strings.HasPrefix(lines[0], "# RaceRender Data") {
+			position = 1
+		}
+		lines = append(lines[:position], append(endPoint, lines[position:]...)...)
+	}
+	return append(lines, columns)
+}
+
+// writeExportCSV writes a plain csv with one row per measurement and the lap it belongs to, for spreadsheets and scripts.
+func writeExportCSV(data *TrackData, config ExportConfig, w io.Writer) error {
+	measures := data.Measures(config.DataConfig)
+	lapNumbers := exportLapNumbers(data.Laps, len(measures))
+	lapTypes := make([]string, len(measures))
+	lapDistances := make([]float64, len(measures))
+	for _, lap := range data.Laps {
+		distance := 0.0
+		for i := lap.MeasureStartIndex; i < lap.MeasureEndIndexExclusive && i < len(measures); i++ {
+			if i > lap.MeasureStartIndex {
+				distance += haversineDistance(measures[i-1].LatLng, measures[i].LatLng)
+			}
+			lapTypes[i] = lap.Type.String()
+			lapDistances[i] = distance
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{"time_s", "utc_time_s", "lap", "lap_type", "lap_distance_m", "latitude", "longitude",
+		"altitude_m", "speed_kph", "heading_deg", "accuracy_m", "accel_x_g", "accel_y_g", "accel_z_g", "gps_update"})
+	if err != nil {
+		return err
+	}
+	format := func(value float64, precision int) string {
+		return strconv.FormatFloat(value, 'f', precision, 64)
+	}
+	for i, m := range measures {
+		gpsUpdate := "0"
+		if m.GPSUpdate {
+			gpsUpdate = "1"
+		}
+		err := writer.Write([]string{format(m.RelativeTime, 3), format(m.UTCTimestamp, 3), strconv.Itoa(lapNumbers[i]),
+			lapTypes[i], format(lapDistances[i], 1), format(m.LatLng.Lat, 7), format(m.LatLng.Lng, 7),
+			format(m.AltitudeMeters, 1), format(m.SpeedKph, 1), format(m.HeadingDegrees, 1), format(m.AccuracyMeters, 1),
+			format(m.Acceleration.X, 3), format(m.Acceleration.Y, 3), format(m.Acceleration.Z, 3), gpsUpdate})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportLapNumbers numbers every measurement with its lap like TrackAddict does, starting with 0 for the outlap.
+// Point-to-point runs are numbered from 1 and the measurements outside of them get 0.
+func exportLapNumbers(laps []Lap, numMeasures int) []int {
+	numbers := make([]int, numMeasures)
+	end, last := 0, 0
+	for i, lap := range laps {
+		number := exportLapNumber(i, lap)
+		for j := lap.MeasureStartIndex; j < lap.MeasureEndIndexExclusive && j < numMeasures; j++ {
+			numbers[j] = number
+		}
+		end, last = lap.MeasureEndIndexExclusive, number
+		if lap.Type == PointToPointRun {
+			last = 0
+		}
+	}
+	// the measurements after the last lap still belong to it, unless that was a run
+	for j := end; j < numMeasures; j++ {
+		numbers[j] = last
+	}
+	return numbers
+}
+
+// exportLapNumber is the number of the lap as the laps command prints it.
+func exportLapNumber(i int, lap Lap) int {
+	if lap.Type == PointToPointRun {
+		return i + 1
+	}
+	return i
+}
+
+// formatLapAnnotation formats the lap time like TrackAddict does in its "# Lap N: 00:01:47.089" annotations.
+func formatLapAnnotation(d time.Duration) string {
+	milliseconds := int64(d / time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60,
+		milliseconds%1000)
+}
+
+// gpsGForces computes the longitudinal and lateral g at the given times from the speed and heading of the GPS fixes,
+// which are interpolated between the fixes and differentiated over gForceWindowSeconds. The exporters use these rather
+// than the accelerometer, whose axes depend on how the phone lies in the car. Lateral g is positive in right hand corners.
+func gpsGForces(measures []GPSMeasurement, seconds []float64) ([]float64, []float64) {
+	longitudinal := make([]float64, len(seconds))
+	lateral := make([]float64, len(seconds))
+	fixes := gpsFixes(measures)
+	if len(fixes) == 0 {
+		return longitudinal, lateral
+	}
+	headings := unwrapHeadings(fixes)
+	at := func(t float64) (float64, float64) {
+		next := sort.Search(len(fixes), func(i int) bool { return fixes[i].RelativeTime >= t })
+		previous := Max(0, next-1)
+		next = Min(next, len(fixes)-1)
+		a, b := fixes[previous], fixes[next]
+		fraction := 0.0
+		if b.RelativeTime > a.RelativeTime {
+			fraction = math.Max(0, math.Min(1, (t-a.RelativeTime)/(b.RelativeTime-a.RelativeTime)))
+		}
+		return a.SpeedKph + fraction*(b.SpeedKph-a.SpeedKph), headings[previous] + fraction*(headings[next]-headings[previous])
+	}
+
+	first, last := fixes[0].RelativeTime, fixes[len(fixes)-1].RelativeTime
+	for i, t := range seconds {
+		from, to := math.Max(first, t-gForceWindowSeconds/2), math.Min(last, t+gForceWindowSeconds/2)
+		if to <= from {
+			continue
+		}
+		speedFrom, headingFrom := at(from)
+		speedTo, headingTo := at(to)
+		speed, _ := at(t)
+		yawRate := degreesToRadians(headingTo-headingFrom) / (to - from)
+		longitudinal[i] = (speedTo - speedFrom) / 3.6 / (to - from) / gravityMetersPerSecond2
+		lateral[i] = speed / 3.6 * yawRate / gravityMetersPerSecond2
+	}
+	return longitudinal, lateral
+}
+
+// gpsFixes are the measurements with a GPS update, speed and heading only change with those. Sessions without the
+// updates flagged take all measurements as fixes.
+func gpsFixes(measures []GPSMeasurement) []GPSMeasurement {
+	var fixes []GPSMeasurement
+	for _, m := range measures {
+		if m.GPSUpdate {
+			fixes = append(fixes, m)
+		}
+	}
+	if len(fixes) == 0 {
+		return measures
+	}
+	return fixes
+}
+
+// unwrapHeadings removes the jumps across north so that the headings can be interpolated and differentiated.
+func unwrapHeadings(measures []GPSMeasurement) []float64 {
+	headings := make([]float64, len(measures))
+	for i, m := range measures {
+		if i == 0 {
+			headings[i] = m.HeadingDegrees
+			continue
+		}
+		delta := m.HeadingDegrees - measures[i-1].HeadingDegrees
+		headings[i] = headings[i-1] + delta - 360*math.Round(delta/360)
+	}
+	return headings
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+// writeTestSession writes the csv into a temporary file and returns its name.
+func writeTestSession(t *testing.T, csv string) string {
+	file, err := ioutil.TempFile("", "session-*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(csv); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestExportRaceRenderRoundTrip(t *testing.T) {
+	inputFile := writeTestSession(t, testTrackAddictHeader+
+		"0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n"+
+		"0.050,1559734111.050,0,107.089,-0.512,0,0.012,51.9993283,13.6881679,91.2,299,12.5,90.0,5.0,0.10,-0.20,0.30,0,100.42,75.6\n"+
+		"# Lap 0: 00:00:00.073\n"+
+		"0.100,1559734111.100,1,0,0,1,0.000,51.9993290,13.6881690,91.2,299,25.0,91.0,5.0,0.20,-0.10,0.30,1,100.43,75.0\n"+
+		"# Session End\n")
+	defer os.Remove(inputFile)
+
+	config := DataConfig{InputFile: inputFile}
+	raw, err := readTrackMeasures(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadData(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteExport(data, ExportConfig{DataConfig: config, Format: ExportFormatRaceRender}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var measures []GPSMeasurement
+	var events []Event
+	err = streamTrackAddict(context.Background(), &out, StreamCallbacks{
+		Measurement: func(index int, m GPSMeasurement) error {
+			measures = append(measures, m)
+			return nil
+		},
+		Event: func(event Event) error {
+			events = append(events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(measures) != len(raw.GPSMeasurement) {
+		t.Fatalf("expected %d measurements, got %d", len(raw.GPSMeasurement), len(measures))
+	}
+	for i, m := range measures {
+		if m != raw.GPSMeasurement[i] {
+			t.Errorf("measurement %d changed from %+v to %+v", i, raw.GPSMeasurement[i], m)
+		}
+	}
+	if len(events) != len(raw.Events) {
+		t.Fatalf("expected the events %+v, got %+v", raw.Events, events)
+	}
+	for i, event := range events {
+		if event != raw.Events[i] {
+			t.Errorf("event %d changed from %+v to %+v", i, raw.Events[i], event)
+		}
+	}
+}
+
+func TestGPSGForces(t *testing.T) {
+	tests := []struct {
+		name         string
+		speeds       []float64
+		headings     []float64
+		longitudinal float64
+		lateral      float64
+	}{
+		{"straight", []float64{36, 36, 36}, []float64{90, 90, 90}, 0, 0},
+		{"accelerating", []float64{0, 9.81 * 3.6, 2 * 9.81 * 3.6}, []float64{0, 0, 0}, 1, 0},
+		{"right hand corner across north", []float64{36, 36, 36}, []float64{350, 0, 10}, 0, 10 * degreesToRadians(10) / 9.81},
+		{"left hand corner", []float64{36, 36, 36}, []float64{100, 90, 80}, 0, -10 * degreesToRadians(10) / 9.81},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var measures []GPSMeasurement
+			for i := range test.speeds {
+				measures = append(measures, GPSMeasurement{RelativeTime: float64(i), SpeedKph: test.speeds[i],
+					HeadingDegrees: test.headings[i], GPSUpdate: true},
+					GPSMeasurement{RelativeTime: float64(i) + 0.5, SpeedKph: test.speeds[i], HeadingDegrees: test.headings[i]})
+			}
+			longitudinal, lateral := gpsGForces(measures, []float64{1})
+			if math.Abs(longitudinal[0]-test.longitudinal) > 1e-9 || math.Abs(lateral[0]-test.lateral) > 1e-9 {
+				t.Errorf("expected %.3f g longitudinal and %.3f g lateral, got %.3f g and %.3f g", test.longitudinal,
+					test.lateral, longitudinal[0], lateral[0])
+			}
+		})
+	}
+}
@@ -14,13 +14,13 @@ func radiansToDegrees(radians float64) float64 {
 	return float64(radians * 180.0 / math.Pi)
 }
 
-func getPointAhead(latLng []float64, distanceMeters float64, azimuth float64) []float64 {
+func getPointAhead(latLng LatLng, distanceMeters float64, azimuth float64) LatLng {
 	radiusFraction := float64(distanceMeters / EarthRadiusInMeters)
 
 	bearing := float64(degreesToRadians(azimuth))
 
-	lat1 := degreesToRadians(latLng[0])
-	lng1 := degreesToRadians(latLng[1])
+	lat1 := degreesToRadians(latLng.Lat)
+	lng1 := degreesToRadians(latLng.Lng)
 
 	lat2Part1 := math.Sin(lat1) * math.Cos(radiusFraction)
 	lat2Part2 := math.Cos(lat1) * math.Sin(radiusFraction) * math.Cos(bearing)
@@ -33,26 +33,26 @@ func getPointAhead(latLng []float64, distanceMeters float64, azimuth float64) []
 	lng2 := lng1 + math.Atan2(lng2Part1, lng2Part2)
 	lng2 = math.Mod(lng2+3*math.Pi, 2*math.Pi) - math.Pi
 
-	return []float64{radiansToDegrees(lat2), radiansToDegrees(lng2),}
+	return LatLng{Lat: radiansToDegrees(lat2), Lng: radiansToDegrees(lng2)}
 }
 
-func pointPlusDistanceEast(fromCoordinate []float64, distance float64) []float64 {
+func pointPlusDistanceEast(fromCoordinate LatLng, distance float64) LatLng {
 	return getPointAhead(fromCoordinate, distance, 90.0)
 }
 
-func pointPlusDistanceNorth(fromCoordinate []float64, distance float64) []float64 {
+func pointPlusDistanceNorth(fromCoordinate LatLng, distance float64) LatLng {
 	return getPointAhead(fromCoordinate, distance, 0.0)
 }
 
-func metersToGeoPoint(latAsMeters float64, lonAsMeters float64) []float64 {
-	point := []float64{0.0, 0.0}
+func metersToGeoPoint(latAsMeters float64, lonAsMeters float64) LatLng {
+	point := LatLng{}
 	pointEast := pointPlusDistanceEast(point, lonAsMeters)
 	pointNorthEast := pointPlusDistanceNorth(pointEast, latAsMeters)
 	return pointNorthEast
 }
 
 func latToMeter(latitude float64) float64 {
-	distance := haversineDistance([]float64{latitude, 0.0}, []float64{0.0, 0.0})
+	distance := haversineDistance(LatLng{Lat: latitude}, LatLng{})
 	if latitude < 0 {
 		distance *= -1
 	}
@@ -60,23 +60,45 @@ func latToMeter(latitude float64) float64 {
 }
 
 func lngToMeter(longitude float64) float64 {
-	distance := haversineDistance([]float64{longitude, 0.0}, []float64{0.0, 0.0})
+	distance := haversineDistance(LatLng{Lat: longitude}, LatLng{})
 	if longitude < 0 {
 		distance *= -1
 	}
 	return distance
 }
 
-func haversineDistance(aInit []float64, bInit []float64) float64 {
-	a := make([]float64, len(aInit))
-	copy(a, aInit)
-	b := make([]float64, len(bInit))
-	copy(b, bInit)
+func haversineDistance(a LatLng, b LatLng) float64 {
+	aLat := degreesToRadians(a.Lat)
+	aLng := degreesToRadians(a.Lng)
+	bLat := degreesToRadians(b.Lat)
+	bLng := degreesToRadians(b.Lng)
 
-	a[0] = a[0] / 180.0 * math.Pi
-	a[1] = a[1] / 180.0 * math.Pi
-	b[0] = b[0] / 180.0 * math.Pi
-	b[1] = b[1] / 180.0 * math.Pi
+	// rounding can push identical points slightly above one, which acos can't handle
+	cosAngle := math.Min(1.0, math.Sin(aLat)*math.Sin(bLat)+math.Cos(aLat)*math.Cos(bLat)*math.Cos(aLng-bLng))
+	return math.Acos(cosAngle) * EarthRadiusInMeters
+}
+
+// DistanceMeters returns the great circle distance between both coordinates.
+func (l LatLng) DistanceMeters(other LatLng) float64 {
+	return haversineDistance(l, other)
+}
+
+// bearingDegrees returns the initial bearing from a to b, clockwise from north in [0, 360).
+func bearingDegrees(a LatLng, b LatLng) float64 {
+	aLat := degreesToRadians(a.Lat)
+	bLat := degreesToRadians(b.Lat)
+	dLng := degreesToRadians(b.Lng - a.Lng)
 
-	return math.Acos(math.Sin(a[0])*math.Sin(b[0])+math.Cos(a[0])*math.Cos(b[0])*math.Cos(a[1]-b[1])) * EarthRadiusInMeters
+	y := math.Sin(dLng) * math.Cos(bLat)
+	x := math.Cos(aLat)*math.Sin(bLat) - math.Sin(aLat)*math.Cos(bLat)*math.Cos(dLng)
+	return math.Mod(radiansToDegrees(math.Atan2(y, x))+360.0, 360.0)
+}
+
+// headingDifference returns the smallest angle between both headings in degrees.
+func headingDifference(a float64, b float64) float64 {
+	diff := math.Mod(math.Abs(a-b), 360.0)
+	if diff > 180.0 {
+		diff = 360.0 - diff
+	}
+	return diff
 }
@@ -0,0 +1,242 @@
+package pkg
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ExportFormatKML     = "kml"
+	ExportFormatGeoJSON = "geojson"
+)
+
+// geoFeature is a lap, a gate or a point of the session in a format neutral way, the properties keep their order.
+type geoFeature struct {
+	// folder groups the features in KML: Laps, Gates or Points
+	folder     string
+	name       string
+	style      string
+	points     []LatLng
+	altitudes  []float64
+	line       bool
+	properties []geoProperty
+}
+
+type geoProperty struct {
+	name  string
+	value interface{}
+}
+
+// geoStyle is the color of a lap or gate as #rrggbb and the width of its line.
+type geoStyle struct {
+	id    string
+	color string
+	width float64
+}
+
+// sessionGeoFeatures returns the laps as lines, followed by the gates and with PointSpeeds by a point for every GPS fix.
+func sessionGeoFeatures(data *TrackData, config ExportConfig) ([]geoFeature, []geoStyle) {
+	measures := data.Measures(config.DataConfig)
+	var features []geoFeature
+	var styles []geoStyle
+	for i, lap := range data.Laps {
+		style := geoStyle{id: fmt.Sprintf("lap%d", i), color: reportPalette[i%len(reportPalette)], width: 3}
+		styles = append(styles, style)
+
+		feature := geoFeature{
+			folder: "Laps",
+			name:   lapNumberFormat(i, lap),
+			style:  style.id,
+			line:   true,
+			properties: []geoProperty{
+				{"lap", exportLapNumber(i, lap)},
+				{"type", lap.Type.String()},
+				{"timeSeconds", lap.Time.Seconds()},
+				{"time", lap.Time.String()},
+				{"topSpeedKph", lap.TopSpeedKph},
+				{"distanceMeters", lap.DistanceMeters},
+				{"valid", lap.Valid},
+			},
+		}
+		if lap.Type != PointToPointRun {
+			feature.name = "Lap " + feature.name
+		}
+		if lap.InvalidReason != "" {
+			feature.properties = append(feature.properties, geoProperty{"invalidReason", lap.InvalidReason})
+		}
+		for _, m := range MeasuresForLap(lap, measures) {
+			feature.points = append(feature.points, m.LatLng)
+			feature.altitudes = append(feature.altitudes, m.AltitudeMeters)
+		}
+		features = append(features, feature)
+	}
+
+	styles = append(styles, geoStyle{id: "startFinish", color: "#ff0000", width: 5}, geoStyle{id: "sector", color: "#000000", width: 4})
+	addGate := func(name string, style string, gate Gate) {
+		features = append(features, geoFeature{folder: "Gates", name: name, style: style, line: true, points: []LatLng{gate.A, gate.B},
+			properties: []geoProperty{{"gate", name}}})
+	}
+	if track := data.TrackInformation.Track; track != nil {
+		if track.Finish != nil {
+			addGate("Start", "startFinish", track.StartFinish)
+			addGate("Finish", "startFinish", *track.Finish)
+		} else {
+			addGate("Start/Finish", "startFinish", track.StartFinish)
+		}
+		for i, gate := range track.Sectors {
+			addGate(fmt.Sprintf("Sector %d", i+1), "sector", gate)
+		}
+	} else if start := data.TrackInformation.StartLatLng; start != nil {
+		features = append(features, geoFeature{folder: "Gates", name: "Start/Finish", style: "startFinish", points: []LatLng{*start},
+			properties: []geoProperty{{"gate", "Start/Finish"}}})
+	}
+
+	if config.PointSpeeds {
+		for i, lap := range data.Laps {
+			for _, m := range MeasuresForLap(lap, measures) {
+				if !m.GPSUpdate {
+					continue
+				}
+				features = append(features, geoFeature{
+					folder:    "Points",
+					name:      fmt.Sprintf("%.0f km/h", m.SpeedKph),
+					style:     fmt.Sprintf("lap%d", i),
+					points:    []LatLng{m.LatLng},
+					altitudes: []float64{m.AltitudeMeters},
+					properties: []geoProperty{
+						{"lap", exportLapNumber(i, lap)},
+						{"timeSeconds", m.RelativeTime - lap.StartTimeSeconds},
+						{"speedKph", m.SpeedKph},
+					},
+				})
+			}
+		}
+	}
+	return features, styles
+}
+
+// writeGeoJSON writes a FeatureCollection, the lines are styled with the simplestyle properties stroke and stroke-width.
+func writeGeoJSON(data *TrackData, config ExportConfig, w io.Writer) error {
+	features, styles := sessionGeoFeatures(data, config)
+	stylesByID := map[string]geoStyle{}
+	for _, style := range styles {
+		stylesByID[style.id] = style
+	}
+
+	type geometry struct {
+		Type        string      `json:"type"`
+		Coordinates interface{} `json:"coordinates"`
+	}
+	type feature struct {
+		Type       string                 `json:"type"`
+		Geometry   geometry               `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	}
+	collection := struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{Type: "FeatureCollection", Features: []feature{}}
+
+	for _, f := range features {
+		properties := map[string]interface{}{"name": f.name}
+		for _, p := range f.properties {
+			properties[p.name] = p.value
+		}
+		style := stylesByID[f.style]
+		var coordinates [][]float64
+		for i, p := range f.points {
+			coordinate := []float64{p.Lng, p.Lat}
+			if i < len(f.altitudes) {
+				coordinate = append(coordinate, f.altitudes[i])
+			}
+			coordinates = append(coordinates, coordinate)
+		}
+
+		g := geometry{Type: "Point", Coordinates: coordinates[0]}
+		if f.line {
+			g = geometry{Type: "LineString", Coordinates: coordinates}
+			properties["stroke"] = style.color
+			properties["stroke-width"] = style.width
+		} else {
+			properties["marker-color"] = style.color
+		}
+		collection.Features = append(collection.Features, feature{Type: "Feature", Geometry: g, Properties: properties})
+	}
+
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(collection)
+}
+
+// writeKML writes a document for Google Earth with a folder for the laps, the gates and optionally the points.
+func writeKML(data *TrackData, config ExportConfig, w io.Writer) error {
+	features, styles := sessionGeoFeatures(data, config)
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<kml xmlns="http://www.opengis.net/kml/2.2">` + "\n<Document>\n")
+	fmt.Fprintf(&b, "<name>%s</name>\n", kmlEscape(filepath.Base(config.InputFile)))
+	for _, style := range styles {
+		fmt.Fprintf(&b, "<Style id=\"%s\"><LineStyle><color>%s</color><width>%g</width></LineStyle>"+
+			"<IconStyle><color>%s</color><scale>0.5</scale></IconStyle></Style>\n",
+			style.id, kmlColor(style.color), style.width, kmlColor(style.color))
+	}
+
+	folder := ""
+	for _, f := range features {
+		if f.folder != folder {
+			if folder != "" {
+				b.WriteString("</Folder>\n")
+			}
+			fmt.Fprintf(&b, "<Folder><name>%s</name>\n", f.folder)
+			folder = f.folder
+		}
+
+		fmt.Fprintf(&b, "<Placemark><name>%s</name><styleUrl>#%s</styleUrl>\n<ExtendedData>", kmlEscape(f.name), f.style)
+		for _, p := range f.properties {
+			fmt.Fprintf(&b, "<Data name=\"%s\"><value>%s</value></Data>", p.name, kmlEscape(fmt.Sprint(p.value)))
+		}
+		b.WriteString("</ExtendedData>\n")
+
+		var coordinates []string
+		for i, p := range f.points {
+			altitude := 0.0
+			if i < len(f.altitudes) {
+				altitude = f.altitudes[i]
+			}
+			coordinates = append(coordinates, fmt.Sprintf("%.7f,%.7f,%.1f", p.Lng, p.Lat, altitude))
+		}
+		if f.line {
+			fmt.Fprintf(&b, "<LineString><tessellate>1</tessellate><coordinates>%s</coordinates></LineString>",
+				strings.Join(coordinates, " "))
+		} else {
+			fmt.Fprintf(&b, "<Point><coordinates>%s</coordinates></Point>", coordinates[0])
+		}
+		b.WriteString("</Placemark>\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+		b.Reset()
+	}
+	if folder != "" {
+		b.WriteString("</Folder>\n")
+	}
+	b.WriteString("</Document>\n</kml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// kmlColor converts #rrggbb into the aabbggrr of KML.
+func kmlColor(hex string) string {
+	c := parseHexColor(hex)
+	return fmt.Sprintf("ff%02x%02x%02x", c.B, c.G, c.R)
+}
+
+func kmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,255 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"math"
+	"os"
+	"sort"
+)
+
+const (
+	// InferenceMinSpeedKph ignores positions of a slow car, since paddock and pit lane driving don't form laps.
+	InferenceMinSpeedKph = 30.0
+	// InferenceGridCellMeters needs to be larger than the distance driven between two GPS updates.
+	InferenceGridCellMeters = 60.0
+	// InferenceMaxHeadingDifference is how much the driving direction may differ between two passes of a position.
+	InferenceMaxHeadingDifference = 45.0
+	// InferenceMinLapSeconds is the shortest lap that is considered for a circuit.
+	InferenceMinLapSeconds = 20.0
+	// InferenceMaxCandidates limits the path points that are tried as start/finish, each one is compared with all
+	// points of its neighbouring cells.
+	InferenceMaxCandidates = 1000
+	// InferredGateHalfWidthMeters is the distance from the center of an inferred gate to each of its end points.
+	InferredGateHalfWidthMeters = 25.0
+	// InferredTrackName is the name of the track that is created from an inferred start/finish gate.
+	InferredTrackName = "Inferred Circuit"
+)
+
+// CircuitInference is the start/finish gate that was inferred from the path of a session without a start/finish point.
+type CircuitInference struct {
+	StartFinish    Gate
+	HeadingDegrees float64
+	// NumLaps counts the laps including the partial ones before the first and after the last crossing.
+	NumLaps int
+	// Confidence is between zero and one, it grows with the number of passes and how regular the laps are.
+	Confidence float64
+}
+
+// Track returns a track that only consists of the inferred start/finish gate.
+func (c *CircuitInference) Track() *Track {
+	return &Track{Name: InferredTrackName, StartFinish: c.StartFinish}
+}
+
+// circuitPathPoint is a segment of the path between two GPS updates.
+type circuitPathPoint struct {
+	from     LatLng
+	fromTime float64
+	latLng   LatLng
+	time     float64
+	heading  float64
+}
+
+// circuitPath collects the distinct GPS positions of a moving car, which is only a fraction of all measurements since
+// the GPS updates much slower than the other sensors.
+type circuitPath struct {
+	points   []circuitPathPoint
+	previous *GPSMeasurement
+}
+
+func (p *circuitPath) add(measure GPSMeasurement) {
+	previous := p.previous
+	p.previous = &measure
+	if previous == nil || previous.LatLng == measure.LatLng || measure.SpeedKph < InferenceMinSpeedKph {
+		return
+	}
+
+	p.points = append(p.points, circuitPathPoint{
+		from:     previous.LatLng,
+		fromTime: previous.RelativeTime,
+		latLng:   measure.LatLng,
+		time:     measure.RelativeTime,
+		heading:  bearingDegrees(previous.LatLng, measure.LatLng),
+	})
+}
+
+// InferCircuit looks for the position that the car passed most often in the same direction and proposes a
+// start/finish gate across it. It returns an error if the path doesn't look like a closed circuit.
+func InferCircuit(measures []GPSMeasurement) (*CircuitInference, error) {
+	path := &circuitPath{}
+	for _, m := range measures {
+		path.add(m)
+	}
+	return path.inferCircuit()
+}
+
+func (p *circuitPath) inferCircuit() (*CircuitInference, error) {
+	if len(p.points) == 0 {
+		return nil, errors.New("the car never moved fast enough to drive a lap")
+	}
+
+	grid := newPathGrid(p.points, InferenceGridCellMeters)
+	bestCandidate := -1
+	var bestPasses []float64
+	// long sessions pass every position many times, so every few points are enough to find the best one
+	step := (len(p.points) + InferenceMaxCandidates - 1) / InferenceMaxCandidates
+	for candidate := 0; candidate < len(p.points); candidate += step {
+		passes := p.passes(grid, candidate)
+		if len(passes) > len(bestPasses) {
+			bestCandidate = candidate
+			bestPasses = passes
+		}
+	}
+
+	if len(bestPasses) < 2 {
+		return nil, errors.New("the car never returned to a position it already passed, this is no circuit")
+	}
+
+	return &CircuitInference{
+		StartFinish:    p.candidateGate(bestCandidate),
+		HeadingDegrees: p.points[bestCandidate].heading,
+		NumLaps:        len(bestPasses) + 1,
+		Confidence:     circuitConfidence(bestPasses),
+	}, nil
+}
+
+// candidateGate is a gate across the path at the end of the given segment.
+func (p *circuitPath) candidateGate(candidate int) Gate {
+	center := p.points[candidate].latLng
+	heading := p.points[candidate].heading
+	return Gate{
+		A:       getPointAhead(center, InferredGateHalfWidthMeters, heading-90),
+		B:       getPointAhead(center, InferredGateHalfWidthMeters, heading+90),
+		Heading: &heading,
+	}
+}
+
+// passes returns the times at which the car crossed the gate of the candidate in the candidate's direction.
+func (p *circuitPath) passes(grid *pathGrid, candidate int) []float64 {
+	c := p.points[candidate]
+	gate := p.candidateGate(candidate)
+	var times []float64
+	for _, i := range grid.neighbours(c.latLng) {
+		point := p.points[i]
+		if headingDifference(point.heading, c.heading) > InferenceMaxHeadingDifference {
+			continue
+		}
+		if fraction, ok := gate.crossingFraction(point.from, point.latLng); ok {
+			times = append(times, point.fromTime+fraction*(point.time-point.fromTime))
+		}
+	}
+	sort.Float64s(times)
+
+	// crossings caused by GPS jitter collapse into the first one
+	var passes []float64
+	for _, t := range times {
+		if len(passes) == 0 || t-passes[len(passes)-1] > InferenceMinLapSeconds {
+			passes = append(passes, t)
+		}
+	}
+	return passes
+}
+
+// circuitConfidence rates a circuit by the number of full laps (three are fully convincing) and the fraction of laps
+// that are within a quarter of the median lap time, since pit stops make some laps much longer.
+func circuitConfidence(passes []float64) float64 {
+	var lapTimes []float64
+	for i := 1; i < len(passes); i++ {
+		lapTimes = append(lapTimes, passes[i]-passes[i-1])
+	}
+	sort.Float64s(lapTimes)
+	median := lapTimes[len(lapTimes)/2]
+
+	regular := 0
+	for _, t := range lapTimes {
+		if math.Abs(t-median) <= median/4 {
+			regular++
+		}
+	}
+
+	lapEvidence := math.Min(1.0, float64(len(lapTimes))/3.0)
+	return lapEvidence * float64(regular) / float64(len(lapTimes))
+}
+
+// needsCircuitInference tells if inferMissingStartFinish will need the driven path, without changing the track
+// information.
+func needsCircuitInference(config DataConfig, trackInfo *TrackInformation, position LatLng) (bool, error) {
+	if !config.RecalculateLaps {
+		return false, nil
+	}
+	info := NewTrackInformation(nil)
+	if trackInfo != nil {
+		copied := *trackInfo
+		info = &copied
+	}
+	if err := resolveTrack(config, info, position); err != nil {
+		return false, err
+	}
+	return info.StartLatLng == nil && info.Track == nil, nil
+}
+
+// inferMissingStartFinish sets an inferred track if laps should be recalculated, but neither a start/finish point nor a
+// known track is available.
+func inferMissingStartFinish(config DataConfig, trackInfo *TrackInformation, path *circuitPath) error {
+	if !config.RecalculateLaps || trackInfo.StartLatLng != nil || trackInfo.Track != nil {
+		return nil
+	}
+
+	inference, err := path.inferCircuit()
+	if err != nil {
+		return fmt.Errorf("no start/finish point in the session and none could be inferred: %v", err)
+	}
+	center := inference.StartFinish.Center()
+	trackInfo.StartLatLng = &center
+	trackInfo.Track = inference.Track()
+	trackInfo.InferredCircuit = inference
+	return nil
+}
+
+// pathGrid buckets path points into square cells, so only the points of neighbouring cells have to be compared.
+type pathGrid struct {
+	cellSizeMeters float64
+	origin         LatLng
+	cells          map[[2]int][]int
+}
+
+func newPathGrid(points []circuitPathPoint, cellSizeMeters float64) *pathGrid {
+	grid := &pathGrid{cellSizeMeters: cellSizeMeters, origin: points[0].latLng, cells: map[[2]int][]int{}}
+	for i, p := range points {
+		cell := grid.cell(p.latLng)
+		grid.cells[cell] = append(grid.cells[cell], i)
+	}
+	return grid
+}
+
+func (g *pathGrid) cell(latLng LatLng) [2]int {
+	x := degreesToRadians(latLng.Lng-g.origin.Lng) * math.Cos(degreesToRadians(g.origin.Lat)) * EarthRadiusInMeters
+	y := degreesToRadians(latLng.Lat-g.origin.Lat) * EarthRadiusInMeters
+	return [2]int{int(math.Floor(x / g.cellSizeMeters)), int(math.Floor(y / g.cellSizeMeters))}
+}
+
+func (g *pathGrid) neighbours(latLng LatLng) []int {
+	center := g.cell(latLng)
+	var result []int
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			result = append(result, g.cells[[2]int{center[0] + dx, center[1] + dy}]...)
+		}
+	}
+	return result
+}
+
+func PrettyPrintCircuitInference(inference *CircuitInference) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Property", "Value"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	center := inference.StartFinish.Center()
+	table.Append([]string{"Start/Finish", fmt.Sprintf("%.6f, %.6f", center.Lat, center.Lng)})
+	table.Append([]string{"Gate", fmt.Sprintf("%.6f, %.6f - %.6f, %.6f",
+		inference.StartFinish.A.Lat, inference.StartFinish.A.Lng, inference.StartFinish.B.Lat, inference.StartFinish.B.Lng)})
+	table.Append([]string{"Heading", fmt.Sprintf("%.1f deg", inference.HeadingDegrees)})
+	table.Append([]string{"Laps", fmt.Sprintf("%d", inference.NumLaps)})
+	table.Append([]string{"Confidence", fmt.Sprintf("%.0f%%", inference.Confidence*100)})
+	table.Render()
+}
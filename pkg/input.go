@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	InputFormatTrackAddict = "trackaddict"
+	InputFormatVBO         = "vbo"
+	// StdinInputFile as input file reads the session from the standard input.
+	StdinInputFile = "-"
+)
+
+// inputReader parses a session log and passes its measurements and annotations to the callbacks like streamTrackAddict.
+type inputReader func(ctx context.Context, reader io.Reader, callbacks StreamCallbacks) error
+
+var inputReaders = map[string]inputReader{
+	InputFormatTrackAddict: streamTrackAddict,
+	InputFormatVBO:         streamVBO,
+	InputFormatRaceChrono:  streamRaceChrono,
+	InputFormatHarrys:      streamHarrys,
+}
+
+// inputExtensions are the files that are picked up when a directory of sessions is analyzed, also when compressed
+// with one of the compressionExtensions or as zip archive.
+var (
+	inputExtensions       = []string{".csv", ".vbo"}
+	compressionExtensions = []string{".gz", ".zst"}
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// stdin is spooled into a file the first time it is read, since sessions are often read twice.
+var (
+	stdinOnce  sync.Once
+	stdinSpool *os.File
+	stdinSize  int64
+	stdinErr   error
+)
+
+// inputDetectionBytes is how much of a file is looked at to detect its format.
+const inputDetectionBytes = 4096
+
+// InputFormats returns the names of the supported input formats.
+func InputFormats() []string {
+	var formats []string
+	for format := range inputReaders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// streamInputFile reads the input file of the config with the reader of its input format, which is detected from the
+// content of the file unless the config names it.
+func streamInputFile(ctx context.Context, config DataConfig, callbacks StreamCallbacks) error {
+	file, name, err := openInput(config.InputFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReaderSize(file, inputDetectionBytes)
+	format := config.InputFormat
+	if format == "" {
+		// an error while peeking shows up again when the reader reads the file
+		head, _ := buffered.Peek(inputDetectionBytes)
+		format = detectInputFormat(name, head)
+	}
+
+	reader, ok := inputReaders[format]
+	if !ok {
+		return fmt.Errorf("unknown input format '%s', expected one of %s", format, strings.Join(InputFormats(), ", "))
+	}
+	return reader(ctx, buffered, callbacks)
+}
+
+// detectInputFormat looks at the beginning of a file to find its format, the extension decides if that is inconclusive.
+func detectInputFormat(inputFile string, head []byte) string {
+	content := string(head)
+	switch {
+	case strings.Contains(content, "RaceRender Data") || strings.Contains(content, `"Time","UTC Time"`):
+		return InputFormatTrackAddict
+	case strings.Contains(content, "[header]") || strings.HasPrefix(content, "File created on"):
+		return InputFormatVBO
+	case strings.Contains(content, "RaceChrono") || strings.Contains(content, "Fragment ID"):
+		return InputFormatRaceChrono
+	case strings.Contains(content, "Harry") || strings.Contains(content, "LapTimer"):
+		return InputFormatHarrys
+	case strings.EqualFold(filepath.Ext(inputFile), ".vbo"):
+		return InputFormatVBO
+	}
+	return InputFormatTrackAddict
+}
+
+func isInputFile(path string) bool {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return true
+	}
+	path = trimCompressionExtension(path)
+	for _, extension := range inputExtensions {
+		if strings.EqualFold(filepath.Ext(path), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimCompressionExtension(path string) string {
+	for _, extension := range compressionExtensions {
+		if strings.EqualFold(filepath.Ext(path), extension) {
+			return path[:len(path)-len(extension)]
+		}
+	}
+	return path
+}
+
+// openInput opens an input file, StdinInputFile reads the standard input. Files compressed with gzip or zstd are
+// decompressed and of a zip archive the session inside is read, which may be compressed as well. The compression is
+// detected from the content, the returned name is the one of the session without the compression, so that its format
+// can be detected by extension.
+func openInput(path string) (io.ReadCloser, string, error) {
+	raw, size, closer, err := openRawInput(path)
+	if err != nil {
+		return nil, "", err
+	}
+	magic := make([]byte, len(zipMagic))
+	n, _ := raw.ReadAt(magic, 0)
+	if !bytes.HasPrefix(magic[:n], zipMagic) {
+		return decompressInput(io.NewSectionReader(raw, 0, size), path, closer)
+	}
+
+	entry, err := zipInputEntry(raw, size)
+	if err != nil {
+		closer.Close()
+		return nil, "", err
+	}
+	file, err := entry.Open()
+	if err != nil {
+		closer.Close()
+		return nil, "", err
+	}
+	return decompressInput(file, entry.Name, file, closer)
+}
+
+// decompressInput decompresses the reader if it starts with the magic bytes of gzip or zstd, in which case the name
+// loses its compression extension. The closers are closed together with the returned reader, also on errors.
+func decompressInput(reader io.Reader, name string, closers ...io.Closer) (io.ReadCloser, string, error) {
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+	buffered := bufio.NewReader(reader)
+	// an error while peeking shows up again when the session is read
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			closeAll()
+			return nil, "", err
+		}
+		return &inputReadCloser{Reader: decompressed, closers: append([]io.Closer{decompressed}, closers...)},
+			trimCompressionExtension(name), nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			closeAll()
+			return nil, "", err
+		}
+		decompressed := decoder.IOReadCloser()
+		return &inputReadCloser{Reader: decompressed, closers: append([]io.Closer{decompressed}, closers...)},
+			trimCompressionExtension(name), nil
+	}
+	return &inputReadCloser{Reader: buffered, closers: closers}, name, nil
+}
+
+// openRawInput opens the bytes of an input file, which may be compressed.
+func openRawInput(path string) (io.ReaderAt, int64, io.Closer, error) {
+	if path == StdinInputFile {
+		stdinOnce.Do(spoolStdin)
+		// the spool is shared by all reads of the standard input, so it stays open
+		return stdinSpool, stdinSize, io.NopCloser(stdinSpool), stdinErr
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, nil, err
+	}
+	return file, info.Size(), file, nil
+}
+
+// spoolStdin copies the standard input into a temporary file. It is removed right away, the open file keeps its
+// content until the process exits.
+func spoolStdin() {
+	stdinSpool, stdinErr = ioutil.TempFile("", "trackaddict-stdin-")
+	if stdinErr != nil {
+		return
+	}
+	_ = os.Remove(stdinSpool.Name())
+	stdinSize, stdinErr = io.Copy(stdinSpool, os.Stdin)
+	if stdinErr != nil {
+		stdinErr = fmt.Errorf("can't read the standard input: %v", stdinErr)
+	}
+}
+
+// zipInputEntry picks the session in a zip archive, preferring csv files if there are other logs as well.
+func zipInputEntry(raw io.ReaderAt, size int64) (*zip.File, error) {
+	archive, err := zip.NewReader(raw, size)
+	if err != nil {
+		return nil, err
+	}
+	var entries, csvEntries []*zip.File
+	for _, entry := range archive.File {
+		name := entry.Name
+		if entry.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(filepath.Base(name), ".") ||
+			!isInputFile(name) || strings.EqualFold(filepath.Ext(name), ".zip") {
+			continue
+		}
+		entries = append(entries, entry)
+		if strings.EqualFold(filepath.Ext(trimCompressionExtension(name)), ".csv") {
+			csvEntries = append(csvEntries, entry)
+		}
+	}
+	if len(csvEntries) > 0 {
+		entries = csvEntries
+	}
+	switch len(entries) {
+	case 0:
+		return nil, fmt.Errorf("the zip archive contains no session file")
+	case 1:
+		return entries[0], nil
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	return nil, fmt.Errorf("the zip archive contains several sessions, extract the one to analyze: %s", strings.Join(names, ", "))
+}
+
+// inputReadCloser closes the decompression together with the file.
+type inputReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *inputReadCloser) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenInput(t *testing.T) {
+	const session = testTrackAddictHeader + "0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n"
+	compress := map[string]func(w io.Writer) io.WriteCloser{
+		"": func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} },
+		".gz": func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		".zst": func(w io.Writer) io.WriteCloser {
+			encoder, _ := zstd.NewWriter(w)
+			return encoder
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "trackaddict-input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name        string
+		file        string
+		entry       string
+		compression string
+		sessionName string
+	}{
+		{"plain", "session.csv", "", "", "session.csv"},
+		{"gzip", "session.csv.gz", "", ".gz", "session.csv"},
+		{"zstd", "session.csv.zst", "", ".zst", "session.csv"},
+		{"zip", "session.zip", "log.vbo", "", "log.vbo"},
+		{"gzip in a zip", "session.zip", "log.csv.gz", ".gz", "log.csv"},
+		{"zstd in a zip", "session.zip", "log.csv.zst", ".zst", "log.csv"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			w := compress[test.compression](&compressed)
+			if _, err := io.WriteString(w, session); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			content := compressed.Bytes()
+			if test.entry != "" {
+				var archive bytes.Buffer
+				zipWriter := zip.NewWriter(&archive)
+				entry, err := zipWriter.Create(test.entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := entry.Write(content); err != nil {
+					t.Fatal(err)
+				}
+				if err := zipWriter.Close(); err != nil {
+					t.Fatal(err)
+				}
+				content = archive.Bytes()
+			}
+			path := filepath.Join(dir, test.file)
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, name, err := openInput(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			read, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(read) != session {
+				t.Errorf("expected the decompressed session, got %q", read)
+			}
+			if filepath.Base(name) != test.sessionName {
+				t.Errorf("expected the name %s, got %s", test.sessionName, name)
+			}
+		})
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
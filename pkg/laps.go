@@ -3,7 +3,6 @@ package pkg
 import (
 	"fmt"
 	"github.com/olekukonko/tablewriter"
-	"log"
 	"math"
 	"os"
 	"time"
@@ -11,100 +10,466 @@ import (
 
 const NumLapCooldownMeasures = 1000
 
+// GateCrossingCooldownSeconds suppresses repeated crossings of the same gate caused by GPS jitter.
+const GateCrossingCooldownSeconds = 10.0
+
 func MeasuresForLap(lap Lap, measures []GPSMeasurement) []GPSMeasurement {
-	return measures[lap.measureStartIndex:lap.measureEndIndexExclusive]
+	return measures[lap.MeasureStartIndex:lap.MeasureEndIndexExclusive]
 }
 
 func extractLaps(config DataConfig, data *TrackData) []Lap {
-	trackInfo := data.TrackInformation
-	measures := data.GPSMeasurement
-	if config.UseSmoothedGPSData {
-		measures = data.FilteredGPSMeasurement
+	measures := data.Measures(config)
+	if len(measures) == 0 {
+		return nil
 	}
 
-	if config.RecalculateLaps {
-		return calculateLapsWithThresholding(measures, trackInfo)
+	gpsErrorStdDevMeters := stddev(measures,
+		func(measurement GPSMeasurement) float64 {
+			return measurement.AccuracyMeters
+		})
+	return detectLaps(newLapDetector(config, data.TrackInformation, gpsErrorStdDevMeters), measures, data.Events)
+}
+
+// newLapDetector chooses how laps are detected: TrackAddict's own laps, unless they should be recalculated. Recalculated
+// laps use the gates of a known track and fall back to the distance to the start/finish point otherwise.
+func newLapDetector(config DataConfig, trackInfo *TrackInformation, gpsAccuracyStdDevMeters float64) lapDetector {
+	var detector lapDetector
+	if !config.RecalculateLaps {
+		detector = &trackAddictLapDetector{}
+	} else if trackInfo.Track != nil && trackInfo.Track.Finish != nil {
+		detector = &pointToPointDetector{startGate: trackInfo.Track.StartFinish, finishGate: *trackInfo.Track.Finish}
+	} else if trackInfo.Track != nil {
+		detector = &gateLapDetector{gate: trackInfo.Track.StartFinish}
 	} else {
-		numLaps := 0
-		for _, measure := range measures {
-			numLaps = Max(numLaps, measure.trackAddictLap)
-		}
+		detector = newThresholdLapDetector(trackInfo, gpsAccuracyStdDevMeters)
+	}
 
-		// +1 since trackaddict laps are zero indexed
-		laps := make([]Lap, numLaps+1)
-		for i := range laps {
-			laps[i].measureStartIndex = math.MaxInt32
-		}
-		for i, measure := range measures {
-			l := laps[measure.trackAddictLap]
-			laps[measure.trackAddictLap].measureStartIndex = Min(l.measureStartIndex, i)
-			laps[measure.trackAddictLap].measureEndIndexExclusive = Max(l.measureEndIndexExclusive, i)
+	if trackInfo.Track != nil && len(trackInfo.Track.Sectors) > 0 {
+		// the gates learn their heading, so they must not be shared with the track
+		gates := append([]Gate(nil), trackInfo.Track.Sectors...)
+		detector = &sectorLapDetector{lapDetector: detector, gates: gates}
+	}
+	return detector
+}
+
+func detectLaps(detector lapDetector, measures []GPSMeasurement, events []Event) []Lap {
+	for _, event := range events {
+		annotateLap(detector, event)
+	}
+	var laps []Lap
+	for i, measure := range measures {
+		laps = append(laps, detector.add(i, measure)...)
+	}
+	return append(laps, detector.finish()...)
+}
+
+// lapDetector splits a stream of measurements into laps, it only needs constant memory so it works on sessions of any size.
+type lapDetector interface {
+	// add feeds the next measurement and returns the laps that were completed by it.
+	add(index int, measure GPSMeasurement) []Lap
+	// finish returns the lap that was still in progress at the end of the session.
+	finish() []Lap
+}
+
+// lapAnnotator is implemented by the lap detectors that use the lap annotations of the log.
+type lapAnnotator interface {
+	// annotate passes an annotation of the log, at the latest before the measurement that starts the next lap.
+	annotate(event Event)
+}
+
+// annotateLap passes a lap annotation to the detector, if it uses them.
+func annotateLap(detector lapDetector, event Event) {
+	if annotator, ok := detector.(lapAnnotator); ok && event.Type == LapEvent {
+		annotator.annotate(event)
+	}
+}
+
+// lapInProgress keeps track of the first and last measurement of the current lap.
+type lapInProgress struct {
+	started        bool
+	startIndex     int
+	startTime      float64
+	lastIndex      int
+	lastTime       float64
+	lastLatLng     LatLng
+	distanceMeters float64
+	topSpeedKph    float64
+}
+
+func (l *lapInProgress) add(index int, measure GPSMeasurement) {
+	if !l.started {
+		l.started = true
+		l.startIndex = index
+		l.startTime = measure.RelativeTime
+	} else if l.lastLatLng != measure.LatLng {
+		l.distanceMeters += haversineDistance(l.lastLatLng, measure.LatLng)
+	}
+	l.lastIndex = index
+	l.lastTime = measure.RelativeTime
+	l.lastLatLng = measure.LatLng
+	l.topSpeedKph = math.Max(l.topSpeedKph, measure.SpeedKph)
+}
+
+// toLap returns the lap up to and including the last added measurement, timed between the given relative times.
+func (l *lapInProgress) toLap(startTime float64, endTime float64) Lap {
+	lap := newLapFromTimes(l.startIndex, l.lastIndex+1, startTime, endTime)
+	lap.DistanceMeters = l.distanceMeters
+	lap.TopSpeedKph = l.topSpeedKph
+	return lap
+}
+
+// complete returns the lap up to and including the last added measurement and starts a new one.
+func (l *lapInProgress) complete() []Lap {
+	if !l.started {
+		return nil
+	}
+	lap := l.toLap(l.startTime, l.lastTime)
+	*l = lapInProgress{}
+	return []Lap{lap}
+}
+
+// trackAddictLapDetector uses the lap numbers that TrackAddict wrote into every measurement. A lap lasts until the next
+// one starts, or as long as its "# Lap N:" annotation says, since TrackAddict times the laps at the start/finish while
+// the lap number only changes with the next measurement.
+type trackAddictLapDetector struct {
+	current   lapInProgress
+	lapNumber int
+	// lapStart is the end of the lap before, or the first measurement
+	lapStart       float64
+	annotatedTimes map[int]time.Duration
+}
+
+func (d *trackAddictLapDetector) annotate(event Event) {
+	if d.annotatedTimes == nil {
+		d.annotatedTimes = map[int]time.Duration{}
+	}
+	d.annotatedTimes[event.LapNumber] = event.LapTime
+}
+
+func (d *trackAddictLapDetector) add(index int, measure GPSMeasurement) []Lap {
+	var laps []Lap
+	if !d.current.started {
+		d.lapStart = measure.RelativeTime
+	} else if measure.TrackAddictLap != d.lapNumber {
+		end := measure.RelativeTime
+		if lapTime, ok := d.annotatedTimes[d.lapNumber]; ok {
+			// an annotation of a lap that began before the log can't end after the lap number changed
+			end = math.Min(d.lapStart+lapTime.Seconds(), measure.RelativeTime)
 		}
+		laps = []Lap{d.current.toLap(d.lapStart, end)}
+		d.current = lapInProgress{}
+		d.lapStart = end
+	}
+	d.lapNumber = measure.TrackAddictLap
+	d.current.add(index, measure)
+	return laps
+}
+
+func (d *trackAddictLapDetector) finish() []Lap {
+	if !d.current.started {
+		return nil
+	}
+	return []Lap{d.current.toLap(d.lapStart, d.current.lastTime)}
+}
+
+// thresholdLapDetector starts a new lap whenever a measurement comes close enough to the start/finish point.
+type thresholdLapDetector struct {
+	startLatLng          LatLng
+	gpsErrorStdDevMeters float64
+	// accuracy is only set if gpsErrorStdDevMeters has to be estimated from the measurements so far.
+	accuracy      *runningStdDev
+	current       lapInProgress
+	measuresInLap int
+}
 
-		// now just fill the lap times with the indices
-		for i, lap := range laps {
-			laps[i].timeSeconds = measures[lap.measureEndIndexExclusive-1].relativeTime - measures[lap.measureStartIndex].relativeTime
+func newThresholdLapDetector(trackInfo *TrackInformation, gpsAccuracyStdDevMeters float64) *thresholdLapDetector {
+	return &thresholdLapDetector{
+		startLatLng:          *trackInfo.StartLatLng,
+		gpsErrorStdDevMeters: gpsAccuracyStdDevMeters * 2.0,
+	}
+}
+
+func (d *thresholdLapDetector) add(index int, measure GPSMeasurement) []Lap {
+	if d.accuracy != nil {
+		d.accuracy.add(measure.AccuracyMeters)
+		d.gpsErrorStdDevMeters = d.accuracy.stddev() * 2.0
+	}
+	d.current.add(index, measure)
+	d.measuresInLap++
+
+	dist := haversineDistance(d.startLatLng, measure.LatLng)
+	//  fmt.Printf("%f\t%f\n", measure.RelativeTime, dist)
+	// simple thresholding algorithm with some cooldown period of measurements
+	if dist < d.gpsErrorStdDevMeters && d.measuresInLap > NumLapCooldownMeasures+1 {
+		d.measuresInLap = 0
+		return d.current.complete()
+	}
+	return nil
+}
+
+func (d *thresholdLapDetector) finish() []Lap {
+	// finish the outlap
+	return d.current.complete()
+}
+
+// gateLapDetector starts a new lap whenever the path between two measurements crosses the start/finish gate, the lap
+// times are interpolated between both measurements.
+type gateLapDetector struct {
+	gate             Gate
+	current          lapInProgress
+	previous         *GPSMeasurement
+	lastCrossingTime float64
+	crossed          bool
+}
+
+func (d *gateLapDetector) add(index int, measure GPSMeasurement) []Lap {
+	var laps []Lap
+	if d.previous != nil {
+		if fraction, ok := d.gate.crossing(d.previous.LatLng, measure.LatLng); ok {
+			crossingTime := d.previous.RelativeTime + fraction*(measure.RelativeTime-d.previous.RelativeTime)
+			if !d.crossed || crossingTime-d.lastCrossingTime > GateCrossingCooldownSeconds {
+				laps = d.completeLap(crossingTime)
+			}
 		}
+	}
 
-		return laps
+	d.current.add(index, measure)
+	d.previous = &measure
+	return laps
+}
+
+func (d *gateLapDetector) completeLap(crossingTime float64) []Lap {
+	startTime := d.current.startTime
+	if d.crossed {
+		startTime = d.lastCrossingTime
+	}
+	d.lastCrossingTime = crossingTime
+	d.crossed = true
+
+	if !d.current.started {
+		return nil
 	}
+	lap := d.current.toLap(startTime, crossingTime)
+	d.current = lapInProgress{}
+	return []Lap{lap}
 }
 
-func calculateLapsWithThresholding(measures []GPSMeasurement, trackInfo *TrackInformation) []Lap {
-	gpsErrorStdDevMeters := stddev(measures,
-		func(measurement GPSMeasurement) float64 {
-			return measurement.accuracyMeter
-		}) * 2.0
+func (d *gateLapDetector) finish() []Lap {
+	if !d.current.started {
+		return nil
+	}
+	startTime := d.current.startTime
+	if d.crossed {
+		startTime = d.lastCrossingTime
+	}
+	return []Lap{d.current.toLap(startTime, d.current.lastTime)}
+}
+
+// pointToPointDetector times runs from crossing the start gate to crossing the finish gate, measurements outside of a
+// run, like the way back to the start, don't belong to any lap.
+type pointToPointDetector struct {
+	startGate  Gate
+	finishGate Gate
+	previous   *GPSMeasurement
+	running    bool
+	run        lapInProgress
+	runStart   float64
+}
+
+func (d *pointToPointDetector) add(index int, measure GPSMeasurement) []Lap {
+	previous := d.previous
+	d.previous = &measure
+	if previous == nil {
+		return nil
+	}
 
 	var laps []Lap
-	currentLap := Lap{measureStartIndex: 0}
-	for i := 0; i < len(measures); i++ {
-		measure := measures[i]
-		dist := haversineDistance(trackInfo.startLatLng, measure.latLng)
-		//  fmt.Printf("%f\t%f\n", measure.relativeTime, dist)
-		// simple thresholding algorithm with some cooldown period of measurements
-		if dist < gpsErrorStdDevMeters && (i-currentLap.measureStartIndex) > NumLapCooldownMeasures {
-			currentLap.measureEndIndexExclusive = i + 1
-			currentLap.timeSeconds = measure.relativeTime - measures[currentLap.measureStartIndex].relativeTime
-			laps = append(laps, currentLap)
-			currentLap = Lap{measureStartIndex: currentLap.measureEndIndexExclusive}
+	if fraction, ok := d.finishGate.crossing(previous.LatLng, measure.LatLng); ok && d.running && d.run.started {
+		finishTime := previous.RelativeTime + fraction*(measure.RelativeTime-previous.RelativeTime)
+		lap := d.run.toLap(d.runStart, finishTime)
+		lap.Type = PointToPointRun
+		laps = append(laps, lap)
+		d.running = false
+	}
+
+	// crossing the start again restarts the run, eg. when driving back down a hillclimb on the same road
+	if fraction, ok := d.startGate.crossing(previous.LatLng, measure.LatLng); ok {
+		d.running = true
+		d.run = lapInProgress{}
+		d.runStart = previous.RelativeTime + fraction*(measure.RelativeTime-previous.RelativeTime)
+	}
+
+	if d.running {
+		d.run.add(index, measure)
+	}
+	return laps
+}
+
+func (d *pointToPointDetector) finish() []Lap {
+	// a run that never reached the finish has no time
+	return nil
+}
+
+type gateCrossing struct {
+	index int
+	gate  int
+	time  float64
+}
+
+// sectorLapDetector adds the sector times to the laps of another detector by watching the crossings of the sector gates.
+type sectorLapDetector struct {
+	lapDetector
+	gates     []Gate
+	previous  *GPSMeasurement
+	crossings []gateCrossing
+}
+
+func (d *sectorLapDetector) add(index int, measure GPSMeasurement) []Lap {
+	if d.previous != nil {
+		for gate := range d.gates {
+			if fraction, ok := d.gates[gate].crossing(d.previous.LatLng, measure.LatLng); ok {
+				crossingTime := d.previous.RelativeTime + fraction*(measure.RelativeTime-d.previous.RelativeTime)
+				d.crossings = append(d.crossings, gateCrossing{index: index, gate: gate, time: crossingTime})
+			}
 		}
 	}
+	d.previous = &measure
 
-	// finish the outlap
-	currentLap.measureEndIndexExclusive = len(measures)
-	currentLap.timeSeconds = measures[len(measures)-1].relativeTime - measures[currentLap.measureStartIndex].relativeTime
-	laps = append(laps, currentLap)
+	return d.addSectorTimes(d.lapDetector.add(index, measure))
+}
+
+func (d *sectorLapDetector) annotate(event Event) {
+	annotateLap(d.lapDetector, event)
+}
+
+func (d *sectorLapDetector) finish() []Lap {
+	return d.addSectorTimes(d.lapDetector.finish())
+}
+
+func (d *sectorLapDetector) addSectorTimes(laps []Lap) []Lap {
+	for i := range laps {
+		var lapCrossings []gateCrossing
+		var remaining []gateCrossing
+		for _, crossing := range d.crossings {
+			if crossing.index < laps[i].MeasureStartIndex {
+				// crossings between two point-to-point runs
+				continue
+			} else if crossing.index < laps[i].MeasureEndIndexExclusive {
+				lapCrossings = append(lapCrossings, crossing)
+			} else {
+				remaining = append(remaining, crossing)
+			}
+		}
+		d.crossings = remaining
+		lapEndTime := laps[i].StartTimeSeconds + laps[i].Time.Seconds()
+		laps[i].SectorTimes = sectorTimes(lapCrossings, len(d.gates), laps[i].StartTimeSeconds, lapEndTime)
+	}
 	return laps
 }
 
+// sectorTimes returns the time between the lap start, the first crossing of each gate in driving order and the lap end.
+// Laps that missed a gate don't have any sector times.
+func sectorTimes(crossings []gateCrossing, numGates int, lapStartTime float64, lapEndTime float64) []time.Duration {
+	var times []time.Duration
+	nextGate := 0
+	sectorStart := lapStartTime
+	for _, crossing := range crossings {
+		if nextGate < numGates && crossing.gate == nextGate {
+			times = append(times, secondsToDuration(crossing.time-sectorStart))
+			sectorStart = crossing.time
+			nextGate++
+		}
+	}
+
+	if nextGate != numGates {
+		return nil
+	}
+	return append(times, secondsToDuration(lapEndTime-sectorStart))
+}
+
 func PrettyPrintLaps(laps []Lap) {
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Lap Number", "Time (s)", "Measure Range"})
+	table.SetHeader([]string{"Lap Number", "Type", "Time (s)", "Valid", "Measure Range"})
 
 	for i, v := range laps {
-		duration := getLapDuration(v)
-
-		lapFormat := fmt.Sprintf("%d", i)
-		if i == 0 {
-			lapFormat = fmt.Sprintf("Outlap")
-		} else if i == len(laps)-1 {
-			lapFormat = fmt.Sprintf("Inlap")
-		}
-
 		table.Append([]string{
-			lapFormat,
-			duration.String(),
-			fmt.Sprintf("%d-%d", v.measureStartIndex, v.measureEndIndexExclusive),
+			lapNumberFormat(i, v),
+			v.Type.String(),
+			v.Time.String(),
+			lapValidityFormat(v),
+			fmt.Sprintf("%d-%d", v.MeasureStartIndex, v.MeasureEndIndexExclusive),
 		})
 	}
+
+	if valid := ValidFlyingLaps(laps); len(valid) > 0 {
+		best := valid[0].Time
+		var total time.Duration
+		for _, lap := range valid {
+			if lap.Time < best {
+				best = lap.Time
+			}
+			total += lap.Time
+		}
+		average := secondsToDuration(total.Seconds() / float64(len(valid)))
+		table.Append([]string{"Best", "", best.String(), "", ""})
+		table.Append([]string{"Average", "", average.String(), "", ""})
+	}
 	table.Render()
 }
 
-func getLapDuration(v Lap) time.Duration {
-	duration, err := time.ParseDuration(fmt.Sprintf("%fs", v.timeSeconds))
-	if err != nil {
-		log.Fatalf("encountered an error while parsing laptime %f, error was: %v", v.timeSeconds, err)
+func lapNumberFormat(i int, lap Lap) string {
+	if lap.Type == PointToPointRun {
+		return fmt.Sprintf("Run %d", i+1)
 	}
-	return duration
+	return fmt.Sprintf("%d", i)
+}
+
+func lapValidityFormat(lap Lap) string {
+	if lap.Type != FlyingLap && lap.Type != PointToPointRun {
+		return "-"
+	} else if !lap.Valid {
+		return fmt.Sprintf("no (%s)", lap.InvalidReason)
+	}
+	return "yes"
+}
+
+// PrettyPrintSectors prints the sector times of every lap, together with the best time of each sector and the
+// theoretical best lap that combines them.
+func PrettyPrintSectors(laps []Lap) {
+	numSectors := 0
+	for _, lap := range laps {
+		numSectors = Max(numSectors, len(lap.SectorTimes))
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"Lap Number"}
+	for i := 0; i < numSectors; i++ {
+		header = append(header, fmt.Sprintf("S%d", i+1))
+	}
+	table.SetHeader(append(header, "Time (s)"))
+
+	bestSectors := make([]time.Duration, numSectors)
+	for i, lap := range laps {
+		row := []string{fmt.Sprintf("%d", i)}
+		for s := 0; s < numSectors; s++ {
+			if s < len(lap.SectorTimes) {
+				row = append(row, lap.SectorTimes[s].String())
+				if bestSectors[s] == 0 || lap.SectorTimes[s] < bestSectors[s] {
+					bestSectors[s] = lap.SectorTimes[s]
+				}
+			} else {
+				row = append(row, "-")
+			}
+		}
+		table.Append(append(row, lap.Time.String()))
+	}
+
+	bestRow := []string{"Best"}
+	var theoreticalBest time.Duration
+	for _, best := range bestSectors {
+		bestRow = append(bestRow, best.String())
+		theoreticalBest += best
+	}
+	table.Append(append(bestRow, theoreticalBest.String()))
+	table.Render()
 }
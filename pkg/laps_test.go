@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackAddictLapDetector(t *testing.T) {
+	var measures []GPSMeasurement
+	for i, lap := range []int{0, 0, 0, 0, 1, 1, 2, 2} {
+		measures = append(measures, GPSMeasurement{RelativeTime: float64(i), TrackAddictLap: lap})
+	}
+
+	tests := []struct {
+		name   string
+		events []Event
+		times  []time.Duration
+		starts []float64
+	}{
+		{"until the next lap", nil,
+			[]time.Duration{4 * time.Second, 2 * time.Second, time.Second}, []float64{0, 4, 6}},
+		{"annotated", []Event{
+			{Type: LapEvent, LapNumber: 0, LapTime: 3500 * time.Millisecond},
+			{Type: PitLaneEntryEvent},
+			{Type: LapEvent, LapNumber: 1, LapTime: 2200 * time.Millisecond},
+		}, []time.Duration{3500 * time.Millisecond, 2200 * time.Millisecond, 1300 * time.Millisecond}, []float64{0, 3.5, 5.7}},
+		{"annotation longer than the lap", []Event{
+			{Type: LapEvent, LapNumber: 0, LapTime: 155 * time.Second},
+			{Type: LapEvent, LapNumber: 1, LapTime: 1500 * time.Millisecond},
+		}, []time.Duration{4 * time.Second, 1500 * time.Millisecond, 1500 * time.Millisecond}, []float64{0, 4, 5.5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			laps := detectLaps(&trackAddictLapDetector{}, measures, test.events)
+			if len(laps) != len(test.times) {
+				t.Fatalf("expected %d laps, got %+v", len(test.times), laps)
+			}
+			for i, lap := range laps {
+				if lap.Time != test.times[i] || secondsToDuration(lap.StartTimeSeconds) != secondsToDuration(test.starts[i]) {
+					t.Errorf("lap %d: expected %s from %.1f, got %s from %.1f", i, test.times[i], test.starts[i], lap.Time, lap.StartTimeSeconds)
+				}
+			}
+			if laps[1].MeasureStartIndex != 4 || laps[1].MeasureEndIndexExclusive != 6 {
+				t.Errorf("expected lap 1 to have the measures 4-6, got %d-%d", laps[1].MeasureStartIndex, laps[1].MeasureEndIndexExclusive)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// LiveSmoothingWarmupSeconds of driving are passed on unsmoothed while the statistics for the Kalman filter are
+	// collected, the acceleration of a car standing in the pits says nothing about the noise on track.
+	LiveSmoothingWarmupSeconds = 120.0
+	// LiveStatusIntervalSeconds is how often the status is reported between two lap completions.
+	LiveStatusIntervalSeconds = 1.0
+)
+
+// LiveConfig configures the live timing, the InputFile of the DataConfig is ignored and the laps are always recalculated.
+type LiveConfig struct {
+	DataConfig
+	// Listen is where the telemetry comes from: "tcp://host:port", "udp://host:port" or "-" for stdin.
+	Listen string
+	// Publish optionally sends every status as a json line to "tcp://host:port" or "udp://host:port".
+	Publish string
+}
+
+// LiveStatus is the timing of the car at a point in time.
+type LiveStatus struct {
+	UTCTime time.Time `json:"utcTime"`
+	// Lap is the number of the lap in progress, the outlap is lap 0.
+	Lap int `json:"lap"`
+	// LapCompleted is set for the status at the moment the previous lap was completed.
+	LapCompleted      bool    `json:"lapCompleted"`
+	CurrentLapSeconds float64 `json:"currentLapSeconds"`
+	LastLapSeconds    float64 `json:"lastLapSeconds,omitempty"`
+	BestLapSeconds    float64 `json:"bestLapSeconds,omitempty"`
+	// DeltaSeconds compares the current lap to the best lap at the same distance, negative is faster.
+	DeltaSeconds *float64 `json:"deltaSeconds,omitempty"`
+	SpeedKph     float64  `json:"speedKph"`
+	Position     LatLng   `json:"position"`
+}
+
+// LiveTimer times laps from measurements as they arrive, using the same gates and smoothing as the analysis of files.
+type LiveTimer struct {
+	config        DataConfig
+	onStatus      func(LiveStatus) error
+	trackInfo     *TrackInformation
+	stats         *measureStatistics
+	previousTime  float64
+	drivenSeconds float64
+	smoother      *KalmanSmoother
+	detector      lapDetector
+	index         int
+	lap           int
+	lapStart      float64
+	lastLatLng    LatLng
+	current       *lapProfile
+	best          *lapProfile
+	lastLap       time.Duration
+	bestLap       time.Duration
+	lastStatus    float64
+}
+
+// NewLiveTimer creates a timer that reports its status to the callback, at least every LiveStatusIntervalSeconds.
+func NewLiveTimer(config DataConfig, onStatus func(LiveStatus) error) *LiveTimer {
+	config.RecalculateLaps = true
+	return &LiveTimer{config: config, onStatus: onStatus, stats: newMeasureStatistics()}
+}
+
+// setTrackInformation uses the start/finish point of a TrackAddict header, if it arrives before the first measurement.
+func (t *LiveTimer) setTrackInformation(info *TrackInformation) {
+	if t.detector == nil {
+		t.trackInfo = info
+	}
+}
+
+// Add feeds the next measurement into the timer.
+func (t *LiveTimer) Add(measure GPSMeasurement) error {
+	if t.detector == nil {
+		if err := t.start(measure); err != nil {
+			return err
+		}
+	}
+
+	if t.config.UseSmoothedGPSData {
+		measure = t.smooth(measure)
+	}
+
+	index := t.index
+	t.index++
+	for _, lap := range t.detector.add(index, measure) {
+		if err := t.completeLap(lap, measure); err != nil {
+			return err
+		}
+	}
+
+	if measure.LatLng != t.lastLatLng || len(t.current.distanceMeters) == 0 {
+		distance := 0.0
+		if last := len(t.current.distanceMeters) - 1; last >= 0 {
+			distance = t.current.distanceMeters[last] + haversineDistance(t.lastLatLng, measure.LatLng)
+		}
+		t.current.distanceMeters = append(t.current.distanceMeters, distance)
+		t.current.seconds = append(t.current.seconds, measure.RelativeTime-t.lapStart)
+		t.current.speedKph = append(t.current.speedKph, measure.SpeedKph)
+		t.lastLatLng = measure.LatLng
+	}
+
+	if measure.RelativeTime-t.lastStatus >= LiveStatusIntervalSeconds {
+		t.lastStatus = measure.RelativeTime
+		return t.onStatus(t.status(measure, false))
+	}
+	return nil
+}
+
+func (t *LiveTimer) start(measure GPSMeasurement) error {
+	if t.trackInfo == nil {
+		t.trackInfo = NewTrackInformation(nil)
+	}
+	if err := resolveTrack(t.config, t.trackInfo, measure.LatLng); err != nil {
+		return err
+	}
+	if t.trackInfo.Track == nil && t.trackInfo.StartLatLng == nil {
+		return errors.New("live timing needs a start/finish gate, use --track, --start-gate or add the track to --tracks-dir")
+	}
+
+	t.detector = newLapDetector(t.config, t.trackInfo, 0)
+	if threshold, ok := t.detector.(*thresholdLapDetector); ok {
+		// unlike in a file the accuracy of the whole session isn't known in advance, so it is estimated as it arrives
+		threshold.accuracy = &runningStdDev{}
+	}
+	t.lapStart = measure.RelativeTime
+	t.lastStatus = measure.RelativeTime
+	t.previousTime = measure.RelativeTime
+	t.lastLatLng = measure.LatLng
+	t.current = &lapProfile{}
+	return nil
+}
+
+// smooth passes the measurements on as they are, until the car drove long enough to estimate the noise for the filter.
+func (t *LiveTimer) smooth(measure GPSMeasurement) GPSMeasurement {
+	if t.smoother != nil {
+		return t.smoother.Smooth(measure)
+	}
+	if measure.SpeedKph >= StandstillSpeedKph {
+		t.drivenSeconds += measure.RelativeTime - t.previousTime
+	}
+	t.previousTime = measure.RelativeTime
+	t.stats.add(measure)
+	if t.drivenSeconds >= LiveSmoothingWarmupSeconds {
+		t.smoother = t.stats.newKalmanSmoother(measure)
+		t.stats = nil
+	}
+	return measure
+}
+
+func (t *LiveTimer) completeLap(lap Lap, measure GPSMeasurement) error {
+	// the outlap from the start of the session doesn't count, runs of a point-to-point track always do
+	if lap.Type == PointToPointRun || t.lap > 0 {
+		t.lastLap = lap.Time
+		if t.bestLap == 0 || lap.Time < t.bestLap {
+			t.bestLap = lap.Time
+			t.best = t.current
+		}
+	}
+
+	t.lap++
+	t.lapStart = lap.StartTimeSeconds + lap.Time.Seconds()
+	t.current = &lapProfile{}
+	t.lastStatus = measure.RelativeTime
+	return t.onStatus(t.status(measure, true))
+}
+
+func (t *LiveTimer) status(measure GPSMeasurement, lapCompleted bool) LiveStatus {
+	elapsed := measure.RelativeTime - t.lapStart
+	status := LiveStatus{
+		UTCTime:           measure.Time(),
+		Lap:               t.lap,
+		LapCompleted:      lapCompleted,
+		CurrentLapSeconds: elapsed,
+		LastLapSeconds:    t.lastLap.Seconds(),
+		BestLapSeconds:    t.bestLap.Seconds(),
+		SpeedKph:          measure.SpeedKph,
+		Position:          measure.LatLng,
+	}
+
+	if t.best != nil && len(t.current.distanceMeters) > 0 {
+		distance := t.current.distanceMeters[len(t.current.distanceMeters)-1]
+		if distance <= t.best.distanceMeters[len(t.best.distanceMeters)-1] {
+			delta := elapsed - t.best.secondsAt(distance)
+			status.DeltaSeconds = &delta
+		}
+	}
+	return status
+}
+
+// RunLive reads telemetry from the configured source until it ends or the context is cancelled. Every line can either
+// be a TrackAddict csv line or an NMEA sentence.
+func RunLive(ctx context.Context, config LiveConfig, onStatus func(LiveStatus) error) error {
+	if config.Publish != "" {
+		publish, closer, err := newLivePublisher(config.Publish)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		report := onStatus
+		onStatus = func(status LiveStatus) error {
+			if err := publish(status); err != nil {
+				log.Printf("Can't publish the status: %v", err)
+			}
+			return report(status)
+		}
+	}
+
+	timer := NewLiveTimer(config.DataConfig, onStatus)
+	parser := &liveLineParser{
+		timer: timer,
+		nmea:  newNMEAParser(),
+		csv: &trackAddictParser{skipBrokenLines: true, sessionInfo: newSessionInfo(), callbacks: StreamCallbacks{
+			TrackInformation: func(info *TrackInformation) error {
+				timer.setTrackInformation(info)
+				return nil
+			},
+			Measurement: func(index int, measure GPSMeasurement) error {
+				return timer.Add(measure)
+			},
+		}},
+	}
+	return readLiveLines(ctx, config.Listen, parser.parseLine)
+}
+
+// liveLineParser skips broken lines instead of failing, since a car on a flaky connection sends some of them.
+type liveLineParser struct {
+	timer *LiveTimer
+	csv   *trackAddictParser
+	nmea  *nmeaParser
+}
+
+func (p *liveLineParser) parseLine(line string) error {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "$") {
+		measure, err := p.nmea.parseLine(line)
+		if err != nil {
+			log.Printf("Skipping sentence: %v", err)
+			return nil
+		}
+		if measure == nil {
+			return nil
+		}
+		return p.timer.Add(*measure)
+	}
+	return p.csv.parseLine(line)
+}
+
+// splitLiveAddress splits "tcp://host:port" into the network and the address.
+func splitLiveAddress(address string) (string, string, error) {
+	for _, network := range []string{"tcp", "udp"} {
+		if strings.HasPrefix(address, network+"://") {
+			return network, strings.TrimPrefix(address, network+"://"), nil
+		}
+	}
+	return "", "", fmt.Errorf("expected tcp://host:port or udp://host:port but got '%s'", address)
+}
+
+func readLiveLines(ctx context.Context, source string, fn func(line string) error) error {
+	if source == "-" {
+		return scanLines(ctx, os.Stdin, fn)
+	}
+
+	network, address, err := splitLiveAddress(source)
+	if err != nil {
+		return err
+	}
+	if network == "udp" {
+		return readUDPLines(ctx, address, fn)
+	}
+	return readTCPLines(ctx, address, fn)
+}
+
+// readTCPLines accepts one connection after the other, so the car can reconnect after losing the network.
+func readTCPLines(ctx context.Context, address string, fn func(line string) error) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, listener)()
+
+	log.Printf("Waiting for telemetry on tcp://%s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		log.Printf("Receiving telemetry from %s", conn.RemoteAddr())
+		stop := closeOnDone(ctx, conn)
+		err = scanLines(ctx, conn, fn)
+		stop()
+		conn.Close()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		log.Printf("Connection from %s closed", conn.RemoteAddr())
+	}
+}
+
+// readUDPLines reads datagrams of one or more lines.
+func readUDPLines(ctx context.Context, address string, fn func(line string) error) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, conn)()
+
+	log.Printf("Waiting for telemetry on udp://%s", conn.LocalAddr())
+	buffer := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func scanLines(ctx context.Context, reader io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// closeOnDone closes the closer when the context is cancelled, which unblocks pending reads. The returned function stops
+// waiting for the context and closes the closer as well.
+func closeOnDone(ctx context.Context, closer io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			closer.Close()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		closer.Close()
+	}
+}
+
+func newLivePublisher(address string) (func(LiveStatus) error, io.Closer, error) {
+	network, addr, err := splitLiveAddress(address)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// every status is a single write, so it ends up in its own datagram for udp
+	encoder := json.NewEncoder(conn)
+	return func(status LiveStatus) error {
+		return encoder.Encode(status)
+	}, conn, nil
+}
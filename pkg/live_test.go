@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLiveLineParserSkipsBrokenLines(t *testing.T) {
+	var statuses []LiveStatus
+	timer := NewLiveTimer(DataConfig{}, func(status LiveStatus) error {
+		statuses = append(statuses, status)
+		return nil
+	})
+	parser := &liveLineParser{
+		timer: timer,
+		nmea:  newNMEAParser(),
+		csv: &trackAddictParser{skipBrokenLines: true, sessionInfo: newSessionInfo(), callbacks: StreamCallbacks{
+			TrackInformation: func(info *TrackInformation) error {
+				timer.setTrackInformation(info)
+				return nil
+			},
+			Measurement: func(index int, measure GPSMeasurement) error {
+				return timer.Add(measure)
+			},
+		}},
+	}
+
+	lines := strings.Split(testTrackAddictHeader, "\n")
+	lines = append(lines,
+		"0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,50.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1",
+		"0.500,1559734111.500,0,0,0,1,0.000,51.99933x,13.6881675,91.1,299,50.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1",
+		"0.700,1559734111.700,0,0,0,1",
+		"# Lap 0: 00:01:47.0.89",
+		"1.000,1559734112.000,0,0,0,1,0.000,51.9994282,13.6881675,91.1,299,50.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1",
+	)
+	for _, line := range lines {
+		if err := parser.parseLine(line); err != nil {
+			t.Fatalf("expected broken lines to be skipped, got %v", err)
+		}
+	}
+
+	if len(statuses) != 1 || statuses[0].Position != (LatLng{Lat: 51.9994282, Lng: 13.6881675}) {
+		t.Errorf("expected one status at the last valid line, got %+v", statuses)
+	}
+}
@@ -0,0 +1,333 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	InputFormatRaceChrono = "racechrono"
+	InputFormatHarrys     = "harrys"
+)
+
+var (
+	raceChronoVersionRegex = regexp.MustCompile(`RaceChrono v?([0-9][0-9.]*[0-9])`)
+	harrysVersionRegex     = regexp.MustCompile(`LapTimer[^0-9]*([0-9][0-9.]*[0-9])`)
+	columnUnitRegex        = regexp.MustCompile(`^(.*?)\s*\(([^)]*)\)$`)
+)
+
+// loggerColumns maps the channels we read to the column names of the RaceChrono and Harry's LapTimer exports. The
+// names are compared without their unit in brackets and case insensitive, the unit decides about the conversion.
+var loggerColumns = map[string][]string{
+	"timestamp":  {"timestamp", "utc", "utc time", "unix time"},
+	"elapsed":    {"elapsed time", "time", "session time"},
+	"lap":        {"lap #", "lap", "lap number", "lap no"},
+	"lat":        {"latitude", "lat"},
+	"lng":        {"longitude", "lon", "long", "lng"},
+	"altitude":   {"altitude", "height", "elevation"},
+	"speed":      {"speed", "gps speed", "velocity"},
+	"heading":    {"bearing", "heading", "course"},
+	"accuracy":   {"accuracy", "gps accuracy", "horizontal accuracy", "hacc"},
+	"satellites": {"satellites", "sats", "satellites in use"},
+}
+
+// loggerColumn is where a channel is found and the factor that converts it into our unit.
+type loggerColumn struct {
+	index  int
+	factor float64
+}
+
+// loggerCSVParser reads the csv exports of RaceChrono and Harry's LapTimer. Both have a free form preamble followed by
+// a header with the channel names, RaceChrono adds rows with the units and sources that are skipped. Rows without a
+// position only carry other sensors, they keep the last position and are no GPS updates. The lap numbers of the app
+// become the TrackAddict lap numbers, together with a lap event whenever a lap is completed.
+type loggerCSVParser struct {
+	versionRegex  *regexp.Regexp
+	callbacks     StreamCallbacks
+	trackInfo     TrackInformation
+	sessionInfo   *SessionInfo
+	delimiter     string
+	columns       map[string]loggerColumn
+	unitsRead     bool
+	previous      *GPSMeasurement
+	firstUTC      float64
+	lap           int
+	lapStartTime  float64
+	trackInfoSent bool
+	measureIndex  int
+	lineCount     int
+}
+
+func streamRaceChrono(ctx context.Context, reader io.Reader, callbacks StreamCallbacks) error {
+	return streamLoggerCSV(ctx, reader, newLoggerCSVParser("RaceChrono", raceChronoVersionRegex, callbacks))
+}
+
+func streamHarrys(ctx context.Context, reader io.Reader, callbacks StreamCallbacks) error {
+	return streamLoggerCSV(ctx, reader, newLoggerCSVParser("Harry's LapTimer", harrysVersionRegex, callbacks))
+}
+
+func newLoggerCSVParser(app string, versionRegex *regexp.Regexp, callbacks StreamCallbacks) *loggerCSVParser {
+	p := &loggerCSVParser{versionRegex: versionRegex, callbacks: callbacks, sessionInfo: newSessionInfo()}
+	p.sessionInfo.App = app
+	return p
+}
+
+func streamLoggerCSV(ctx context.Context, reader io.Reader, parser *loggerCSVParser) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := parser.parseLine(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return parser.emitTrackInformation()
+}
+
+func (p *loggerCSVParser) parseLine(line string) error {
+	defer func() { p.lineCount++ }()
+	line = strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+	if line == "" {
+		return nil
+	}
+	if p.columns == nil {
+		return p.parsePreamble(line)
+	}
+
+	fields := p.split(line)
+	if !p.isDataRow(fields) {
+		// RaceChrono has a row with the units below the header, followed by one with the sources
+		if !p.unitsRead {
+			p.readUnits(fields)
+		}
+		return nil
+	}
+	return p.parseData(fields)
+}
+
+// readUnits takes the conversion of the columns from a units row, unless the header already had the unit in brackets.
+func (p *loggerCSVParser) readUnits(fields []string) {
+	p.unitsRead = true
+	for channel, column := range p.columns {
+		if column.index < len(fields) && column.factor == 1 {
+			column.factor = loggerUnitFactor(channel, strings.ToLower(fields[column.index]))
+			p.columns[channel] = column
+		}
+	}
+}
+
+// parsePreamble keeps the lines before the header as comments, the header is the first line naming both coordinates.
+func (p *loggerCSVParser) parsePreamble(line string) error {
+	if matches := p.versionRegex.FindStringSubmatch(line); matches != nil && p.sessionInfo.AppVersion == "" {
+		p.sessionInfo.AppVersion = matches[1]
+	}
+
+	p.delimiter = ","
+	if strings.Count(line, ";") > strings.Count(line, ",") {
+		p.delimiter = ";"
+	}
+	names := p.split(line)
+	columns := map[string]loggerColumn{}
+	for i, name := range names {
+		channel, factor := loggerChannel(name)
+		if _, ok := columns[channel]; channel != "" && !ok {
+			columns[channel] = loggerColumn{index: i, factor: factor}
+		}
+	}
+
+	_, hasLat := columns["lat"]
+	_, hasLng := columns["lng"]
+	if !hasLat || !hasLng {
+		p.sessionInfo.HeaderComments = append(p.sessionInfo.HeaderComments, "# "+line)
+		return nil
+	}
+	if _, ok := columns["timestamp"]; !ok {
+		if _, ok := columns["elapsed"]; !ok {
+			return fmt.Errorf("the %s csv has no time column", p.sessionInfo.App)
+		}
+	}
+	p.columns = columns
+	p.sessionInfo.Channels = names
+	return nil
+}
+
+func (p *loggerCSVParser) split(line string) []string {
+	fields := strings.Split(line, p.delimiter)
+	for i, field := range fields {
+		fields[i] = strings.Trim(strings.TrimSpace(field), `"`)
+	}
+	return fields
+}
+
+// isDataRow is true if the time column holds a number, which rules out the unit and source rows.
+func (p *loggerCSVParser) isDataRow(fields []string) bool {
+	column, ok := p.columns["timestamp"]
+	if !ok {
+		column = p.columns["elapsed"]
+	}
+	if column.index >= len(fields) {
+		return false
+	}
+	_, err := p.parseNumber(fields[column.index])
+	return err == nil
+}
+
+// parseNumber parses a value of a data row, the exports of locales that separate the columns by ; use a decimal comma.
+func (p *loggerCSVParser) parseNumber(field string) (float64, error) {
+	if p.delimiter == ";" {
+		field = strings.Replace(field, ",", ".", 1)
+	}
+	return strconv.ParseFloat(field, 64)
+}
+
+func (p *loggerCSVParser) parseData(fields []string) error {
+	values := map[string]float64{}
+	for channel, column := range p.columns {
+		if column.index >= len(fields) || fields[column.index] == "" {
+			continue
+		}
+		value, err := p.parseNumber(fields[column.index])
+		if err != nil {
+			return fmt.Errorf("can't parse the %s in line %d: %v", channel, p.lineCount, err)
+		}
+		values[channel] = value * column.factor
+	}
+
+	lat, hasLat := values["lat"]
+	lng, hasLng := values["lng"]
+	measure := GPSMeasurement{GPSUpdate: hasLat && hasLng}
+	if measure.GPSUpdate {
+		measure.LatLng = LatLng{Lat: lat, Lng: lng}
+		measure.AltitudeMeters = values["altitude"]
+		measure.SpeedKph = values["speed"]
+		measure.HeadingDegrees = values["heading"]
+		measure.AccuracyMeters = loggerAccuracy(values)
+	} else if p.previous != nil {
+		measure.LatLng = p.previous.LatLng
+		measure.AltitudeMeters = p.previous.AltitudeMeters
+		measure.SpeedKph = p.previous.SpeedKph
+		measure.HeadingDegrees = p.previous.HeadingDegrees
+		measure.AccuracyMeters = p.previous.AccuracyMeters
+	} else {
+		// nothing to place the sensor values at before the first fix
+		return nil
+	}
+
+	if timestamp, ok := values["timestamp"]; ok {
+		measure.UTCTimestamp = timestamp
+	} else {
+		measure.UTCTimestamp = values["elapsed"]
+	}
+	if p.measureIndex == 0 {
+		p.firstUTC = measure.UTCTimestamp
+	}
+	measure.RelativeTime = measure.UTCTimestamp - p.firstUTC
+
+	if !p.trackInfoSent {
+		p.sessionInfo.StartTime = measure.Time()
+		if err := p.emitTrackInformation(); err != nil {
+			return err
+		}
+	}
+
+	// before the first lap the apps leave the lap empty, which is our outlap 0
+	if lap, ok := values["lap"]; ok {
+		measure.TrackAddictLap = int(lap)
+	} else {
+		measure.TrackAddictLap = p.lap
+	}
+	if measure.TrackAddictLap != p.lap {
+		err := p.emitEvent(Event{Type: LapEvent, MeasureIndex: p.measureIndex, LapNumber: p.lap,
+			LapTime: secondsToDuration(measure.RelativeTime - p.lapStartTime),
+			Text:    fmt.Sprintf("Lap %d: %s", p.lap, formatLapAnnotation(secondsToDuration(measure.RelativeTime-p.lapStartTime)))})
+		if err != nil {
+			return err
+		}
+		p.lap = measure.TrackAddictLap
+		p.lapStartTime = measure.RelativeTime
+	}
+
+	p.previous = &measure
+	index := p.measureIndex
+	p.measureIndex++
+	if p.callbacks.Measurement != nil {
+		return p.callbacks.Measurement(index, measure)
+	}
+	return nil
+}
+
+func (p *loggerCSVParser) emitEvent(event Event) error {
+	if p.callbacks.Event != nil {
+		return p.callbacks.Event(event)
+	}
+	return nil
+}
+
+func (p *loggerCSVParser) emitTrackInformation() error {
+	if p.trackInfoSent {
+		return nil
+	}
+	p.trackInfoSent = true
+	if p.callbacks.SessionInfo != nil {
+		if err := p.callbacks.SessionInfo(p.sessionInfo); err != nil {
+			return err
+		}
+	}
+	if p.callbacks.TrackInformation != nil {
+		info := p.trackInfo
+		return p.callbacks.TrackInformation(&info)
+	}
+	return nil
+}
+
+// loggerChannel finds the channel of a column and the factor that converts its unit, unknown columns map to "".
+func loggerChannel(column string) (string, float64) {
+	name, unit := strings.ToLower(strings.TrimSpace(column)), ""
+	if matches := columnUnitRegex.FindStringSubmatch(name); matches != nil {
+		name, unit = matches[1], strings.TrimSpace(matches[2])
+	}
+	for channel, aliases := range loggerColumns {
+		for _, alias := range aliases {
+			if name == alias {
+				return channel, loggerUnitFactor(channel, unit)
+			}
+		}
+	}
+	return "", 0
+}
+
+// loggerUnitFactor converts speeds into km/h and altitudes into meters, the apps use different units by locale.
+func loggerUnitFactor(channel string, unit string) float64 {
+	switch {
+	case channel == "speed" && unit == "m/s":
+		return 3.6
+	case channel == "speed" && unit == "mph":
+		return 1.609344
+	case channel == "speed" && unit == "kn":
+		return knotsToKph
+	case channel == "altitude" && unit == "ft":
+		return 0.3048
+	}
+	return 1
+}
+
+// loggerAccuracy takes the accuracy of the fix if the app logged it, otherwise it is estimated from the satellites.
+func loggerAccuracy(values map[string]float64) float64 {
+	if accuracy, ok := values["accuracy"]; ok && accuracy > 0 {
+		return accuracy
+	}
+	if satellites, ok := values["satellites"]; ok && satellites > 0 {
+		return VBOSatelliteAccuracyMeters / math.Floor(satellites)
+	}
+	return NMEAUserEquivalentRangeErrorMeters
+}
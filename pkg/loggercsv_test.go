@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamLoggerCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		format   string
+		version  string
+		measures []GPSMeasurement
+		laps     []time.Duration
+	}{
+		{"RaceChrono v3", `This file is created using RaceChrono v7.4.4 ( http://racechrono.com/ ).
+Format,3
+Session title,"Spreewaldring"
+Session type,Lap timing
+Track name,"Spreewaldring"
+Created,01/01/2020,12:00
+
+Timestamp,Fragment ID,Lap #,Elapsed time,Distance traveled,Accuracy,Altitude,Bearing,Latitude,Longitude,Satellites,Speed
+unix time,,,s,m,m,m,deg,deg,deg,sats,m/s
+,,,,,,,gps,gps,gps,gps,gps
+1577880000.000,0,,0.000,,3.4,100.0,127.4,51.9993282,13.6881675,,10.0
+1577880000.040,0,,0.040,,,,,,,,
+1577880001.000,0,1,1.000,,3.0,100.5,128.0,51.9993000,13.6882000,,20.0
+1577880002.500,0,2,2.500,,3.0,101.0,129.0,51.9992000,13.6883000,,30.0
+`, InputFormatRaceChrono, "7.4.4", []GPSMeasurement{
+			{RelativeTime: 0, LatLng: LatLng{Lat: 51.9993282, Lng: 13.6881675}, AltitudeMeters: 100, SpeedKph: 36, HeadingDegrees: 127.4, AccuracyMeters: 3.4, GPSUpdate: true},
+			{RelativeTime: 0.04, LatLng: LatLng{Lat: 51.9993282, Lng: 13.6881675}, AltitudeMeters: 100, SpeedKph: 36, HeadingDegrees: 127.4, AccuracyMeters: 3.4},
+			{RelativeTime: 1, LatLng: LatLng{Lat: 51.9993, Lng: 13.6882}, AltitudeMeters: 100.5, SpeedKph: 72, HeadingDegrees: 128, AccuracyMeters: 3, GPSUpdate: true, TrackAddictLap: 1},
+			{RelativeTime: 2.5, LatLng: LatLng{Lat: 51.9992, Lng: 13.6883}, AltitudeMeters: 101, SpeedKph: 108, HeadingDegrees: 129, AccuracyMeters: 3, GPSUpdate: true, TrackAddictLap: 2},
+		}, []time.Duration{time.Second, 1500 * time.Millisecond}},
+		{"Harry's with a decimal comma", `Harry's LapTimer Petrolhead 23.1
+Database export;Spreewaldring
+
+Time (s);UTC;Lap;Latitude;Longitude;Altitude (ft);Speed (mph);Heading;Satellites
+0,000;1577880000,000;0;51,9993282;13,6881675;328,084;10,0;127,4;10
+1,000;1577880001,000;1;51,9993000;13,6882000;328,084;20,0;128,0;5
+`, InputFormatHarrys, "23.1", []GPSMeasurement{
+			{RelativeTime: 0, LatLng: LatLng{Lat: 51.9993282, Lng: 13.6881675}, AltitudeMeters: 100, SpeedKph: 16.09344, HeadingDegrees: 127.4, AccuracyMeters: VBOSatelliteAccuracyMeters / 10, GPSUpdate: true},
+			{RelativeTime: 1, LatLng: LatLng{Lat: 51.9993, Lng: 13.6882}, AltitudeMeters: 100, SpeedKph: 32.18688, HeadingDegrees: 128, AccuracyMeters: VBOSatelliteAccuracyMeters / 5, GPSUpdate: true, TrackAddictLap: 1},
+		}, []time.Duration{time.Second}},
+		{"Harry's", `Harry's LapTimer Petrolhead 23.1
+Database export,Spreewaldring
+
+Time (s),UTC,Lap,Latitude,Longitude,Altitude (m),Speed (km/h),Heading,Accuracy
+0.000,1577880000.000,0,51.9993282,13.6881675,100.0,10.0,127.4,4.0
+`, InputFormatHarrys, "23.1", []GPSMeasurement{
+			{RelativeTime: 0, LatLng: LatLng{Lat: 51.9993282, Lng: 13.6881675}, AltitudeMeters: 100, SpeedKph: 10, HeadingDegrees: 127.4, AccuracyMeters: 4, GPSUpdate: true},
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format := detectInputFormat("session.csv", []byte(test.csv))
+			if format != test.format {
+				t.Fatalf("expected the format %s, got %s", test.format, format)
+			}
+
+			var info *SessionInfo
+			var measures []GPSMeasurement
+			var laps []time.Duration
+			err := inputReaders[format](context.Background(), strings.NewReader(test.csv), StreamCallbacks{
+				SessionInfo: func(i *SessionInfo) error {
+					info = i
+					return nil
+				},
+				Measurement: func(index int, m GPSMeasurement) error {
+					measures = append(measures, m)
+					return nil
+				},
+				Event: func(event Event) error {
+					if event.Type == LapEvent {
+						laps = append(laps, event.LapTime)
+					}
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info == nil || info.AppVersion != test.version {
+				t.Errorf("expected the app version %s, got %+v", test.version, info)
+			}
+			if len(measures) != len(test.measures) {
+				t.Fatalf("expected %d measurements, got %d", len(test.measures), len(measures))
+			}
+			for i, m := range measures {
+				expected := test.measures[i]
+				if !closeTo(m.RelativeTime, expected.RelativeTime) || !closeTo(m.LatLng.Lat, expected.LatLng.Lat) ||
+					!closeTo(m.LatLng.Lng, expected.LatLng.Lng) || !closeTo(m.AltitudeMeters, expected.AltitudeMeters) ||
+					!closeTo(m.SpeedKph, expected.SpeedKph) || !closeTo(m.HeadingDegrees, expected.HeadingDegrees) ||
+					!closeTo(m.AccuracyMeters, expected.AccuracyMeters) || m.GPSUpdate != expected.GPSUpdate ||
+					m.TrackAddictLap != expected.TrackAddictLap {
+					t.Errorf("measurement %d: expected %+v, got %+v", i, expected, m)
+				}
+			}
+			if len(laps) != len(test.laps) {
+				t.Fatalf("expected the laps %v, got %v", test.laps, laps)
+			}
+			for i, lap := range laps {
+				if lap != test.laps[i] {
+					t.Errorf("lap %d: expected %s, got %s", i, test.laps[i], lap)
+				}
+			}
+		})
+	}
+}
+
+func closeTo(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
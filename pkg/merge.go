@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MergeConfig configures the merge of partial logs of one session, the InputFile of the DataConfig is ignored.
+type MergeConfig struct {
+	DataConfig
+	InputFiles []string
+	OutputFile string
+}
+
+// mergePart is one of the partial logs of a session.
+type mergePart struct {
+	inputFile    string
+	data         *TrackData
+	sessionEnded bool
+	// gapSeconds is the time since the end of the log before, negative if they overlap
+	gapSeconds float64
+	// dropped are the measurements that overlap with the logs before
+	dropped int
+}
+
+// MergeData joins partial logs of one session, like the ones left behind when the app crashed and was restarted, into
+// a single session. The logs are ordered by their UTC time, measurements that overlap with an earlier log are dropped
+// and the time is relative to the start of the first log. The lap numbers continue across the logs: if a log ended
+// without "# Session End", the lap it was in continues in the next log, otherwise the next log starts a new lap.
+func MergeData(config DataConfig, inputFiles []string) (*TrackData, error) {
+	data, _, err := mergeData(config, inputFiles)
+	return data, err
+}
+
+func mergeData(config DataConfig, inputFiles []string) (*TrackData, []*mergePart, error) {
+	var parts []*mergePart
+	for _, inputFile := range inputFiles {
+		fileConfig := config
+		fileConfig.InputFile = inputFile
+		raw, err := readTrackMeasures(fileConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", inputFile, err)
+		}
+		if len(raw.GPSMeasurement) == 0 {
+			continue
+		}
+		part := &mergePart{inputFile: inputFile, data: raw}
+		for _, event := range raw.Events {
+			part.sessionEnded = part.sessionEnded || event.Type == SessionEndEvent
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, nil, fmt.Errorf("none of the logs has measurements")
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].data.GPSMeasurement[0].UTCTimestamp < parts[j].data.GPSMeasurement[0].UTCTimestamp
+	})
+
+	startUTC := parts[0].data.GPSMeasurement[0].UTCTimestamp
+	var measures []GPSMeasurement
+	var events []Event
+	// lapStartUTC is where the lap in progress started, to time a lap that continues in the next log
+	lapStartUTC := startUTC
+	for p, part := range parts {
+		raw := part.data.GPSMeasurement
+		base := len(measures)
+		lapOffset := 0
+		if p > 0 {
+			previous := measures[len(measures)-1]
+			part.gapSeconds = raw[0].UTCTimestamp - previous.UTCTimestamp
+			lapOffset = previous.TrackAddictLap
+			if parts[p-1].sessionEnded {
+				lapOffset++
+				lapStartUTC = raw[0].UTCTimestamp
+			}
+		}
+
+		// keptBefore counts the kept measurements before every raw index, to move the events to the merged indices
+		keptBefore := make([]int, len(raw)+1)
+		for i, m := range raw {
+			keptBefore[i] = len(measures) - base
+			if len(measures) > 0 && m.UTCTimestamp <= measures[len(measures)-1].UTCTimestamp {
+				part.dropped++
+				continue
+			}
+			m.RelativeTime = m.UTCTimestamp - startUTC
+			m.TrackAddictLap += lapOffset
+			measures = append(measures, m)
+		}
+		keptBefore[len(raw)] = len(measures) - base
+
+		// the lap annotations are timed from the end of the lap before, the first lap of a log starts with the log
+		lapEndUTC := raw[0].UTCTimestamp
+		for _, event := range part.data.Events {
+			if event.Type == SessionEndEvent && p < len(parts)-1 {
+				continue
+			}
+			event.MeasureIndex = base + keptBefore[Max(0, Min(event.MeasureIndex, len(raw)))]
+			if event.Type == LapEvent {
+				lapEndUTC += event.LapTime.Seconds()
+				event.LapNumber += lapOffset
+				event.LapTime = secondsToDuration(lapEndUTC - lapStartUTC)
+				event.Text = fmt.Sprintf("Lap %d: %s", event.LapNumber, formatLapAnnotation(event.LapTime))
+				lapStartUTC = lapEndUTC
+			}
+			events = append(events, event)
+		}
+	}
+
+	data, err := NewTrackDataWithEvents(config, parts[0].data.TrackInformation, measures, events)
+	if err != nil {
+		return nil, nil, err
+	}
+	data.SessionInfo = parts[0].data.SessionInfo
+	return data, parts, nil
+}
+
+// Merge joins the partial logs of the config with MergeData, writes the session as a TrackAddict csv and returns it.
+func Merge(config MergeConfig) (*TrackData, error) {
+	data, parts, err := mergeData(config.DataConfig, config.InputFiles)
+	if err != nil {
+		return nil, err
+	}
+	for p, part := range parts {
+		switch {
+		case p == 0:
+			fmt.Printf("Started with %s\n", part.inputFile)
+		case part.gapSeconds < 0:
+			fmt.Printf("Joined %s, which overlapped by %s, dropped %d measurements\n", part.inputFile,
+				secondsToDuration(-part.gapSeconds), part.dropped)
+		default:
+			fmt.Printf("Joined %s after a gap of %s\n", part.inputFile, secondsToDuration(part.gapSeconds))
+		}
+	}
+
+	outputFile := trackAddictOutputFile(config.OutputFile)
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewWriter(file)
+	err = writeTrackAddict(data, buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Saved %s\n", outputFile)
+	return data, nil
+}
+
+// writeTrackAddict writes the raw measurements with the lap numbers and annotations as they are, unlike
+// writeRaceRender which regenerates them from the laps.
+func writeTrackAddict(data *TrackData, w io.Writer) error {
+	var comments []string
+	if data.SessionInfo != nil {
+		comments = data.SessionInfo.HeaderComments
+	}
+	if err := writeReplayLines(w, raceRenderHeader(comments, data.TrackInformation)); err != nil {
+		return err
+	}
+
+	nextEvent := 0
+	writeEvents := func(index int) error {
+		for ; nextEvent < len(data.Events) && data.Events[nextEvent].MeasureIndex <= index; nextEvent++ {
+			text := strings.TrimSpace(data.Events[nextEvent].Text)
+			if err := writeReplayLines(w, []string{"# " + text}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, m := range data.GPSMeasurement {
+		if err := writeEvents(i); err != nil {
+			return err
+		}
+		if err := writeReplayLines(w, []string{formatTrackAddictLine(m)}); err != nil {
+			return err
+		}
+	}
+	return writeEvents(len(data.GPSMeasurement))
+}
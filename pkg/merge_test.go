@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// mergeTestLine is a measurement of a partial log at the UTC time in the lap.
+func mergeTestLine(utc float64, lap int) string {
+	return fmt.Sprintf("%.3f,%.3f,%d,0,0,1,0.000,51.9993282,13.6881675,91.1,299,50.0,90.0,5.0,0.00,0.00,0.00,0,100.44,74.1\n",
+		utc-100, utc, lap)
+}
+
+func TestMergeData(t *testing.T) {
+	second := testTrackAddictHeader +
+		mergeTestLine(101.5, 0) +
+		mergeTestLine(103, 0) +
+		"# Lap 0: 00:00:01.000\n" +
+		mergeTestLine(104, 1) +
+		"# Session End\n"
+
+	tests := []struct {
+		name   string
+		first  string
+		utc    []float64
+		laps   []int
+		events []Event
+	}{
+		{"crashed log continues the lap", testTrackAddictHeader +
+			mergeTestLine(100, 0) +
+			mergeTestLine(101, 0) +
+			"# Lap 0: 00:00:01.500\n" +
+			mergeTestLine(102, 1),
+			[]float64{100, 101, 102, 103, 104}, []int{0, 0, 1, 1, 2}, []Event{
+				{Type: LapEvent, LapNumber: 0, LapTime: 1500 * time.Millisecond, MeasureIndex: 2},
+				{Type: LapEvent, LapNumber: 1, LapTime: time.Second, MeasureIndex: 4},
+				{Type: SessionEndEvent, MeasureIndex: 5},
+			}},
+		{"ended log starts a new lap", testTrackAddictHeader +
+			mergeTestLine(100, 0) +
+			mergeTestLine(101, 0) +
+			"# Lap 0: 00:00:01.500\n" +
+			mergeTestLine(102, 1) +
+			"# Session End\n",
+			[]float64{100, 101, 102, 103, 104}, []int{0, 0, 1, 2, 3}, []Event{
+				{Type: LapEvent, LapNumber: 0, LapTime: 1500 * time.Millisecond, MeasureIndex: 2},
+				{Type: LapEvent, LapNumber: 2, LapTime: time.Second, MeasureIndex: 4},
+				{Type: SessionEndEvent, MeasureIndex: 5},
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			firstFile := writeTestSession(t, test.first)
+			defer os.Remove(firstFile)
+			secondFile := writeTestSession(t, second)
+			defer os.Remove(secondFile)
+
+			// the order of the files doesn't matter, the logs are sorted by their time
+			data, parts, err := mergeData(DataConfig{}, []string{secondFile, firstFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(parts) != 2 || parts[1].dropped != 1 || parts[1].gapSeconds != -0.5 {
+				t.Errorf("expected the second log to overlap by 0.5s with one dropped measurement, got %+v", parts)
+			}
+			measures := data.GPSMeasurement
+			if len(measures) != len(test.utc) {
+				t.Fatalf("expected %d measurements, got %d", len(test.utc), len(measures))
+			}
+			for i, m := range measures {
+				if m.UTCTimestamp != test.utc[i] || m.RelativeTime != test.utc[i]-100 || m.TrackAddictLap != test.laps[i] {
+					t.Errorf("measurement %d: expected lap %d at %.1f, got lap %d at %.1f (%.1f)", i, test.laps[i],
+						test.utc[i], m.TrackAddictLap, m.UTCTimestamp, m.RelativeTime)
+				}
+			}
+			if len(data.Events) != len(test.events) {
+				t.Fatalf("expected the events %+v, got %+v", test.events, data.Events)
+			}
+			for i, event := range data.Events {
+				expected := test.events[i]
+				if event.Type != expected.Type || event.LapNumber != expected.LapNumber || event.LapTime != expected.LapTime ||
+					event.MeasureIndex != expected.MeasureIndex {
+					t.Errorf("event %d: expected %+v, got %+v", i, expected, event)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatMoTeC = "motec"
+	// DefaultMoTeCSampleRateHz is the rate the MoTeC export resamples to, MoTeC expects a fixed rate.
+	DefaultMoTeCSampleRateHz = 20.0
+)
+
+// motecChannel is a column of the MoTeC csv.
+type motecChannel struct {
+	name      string
+	unit      string
+	precision int
+	values    []float64
+}
+
+// writeMoTeC writes the csv that MoTeC i2 imports: a header block with the session, beacon markers at the lap boundaries
+// and the channels resampled to a fixed rate. Besides the GPS channels it has the distance and the lateral and
+// longitudinal g computed from the GPS speed and heading.
+func writeMoTeC(data *TrackData, config ExportConfig, w io.Writer) error {
+	measures := data.Measures(config.DataConfig)
+	if len(measures) == 0 {
+		return fmt.Errorf("the session has no measurements")
+	}
+	rate := config.SampleRateHz
+	if rate <= 0 {
+		rate = DefaultMoTeCSampleRateHz
+	}
+
+	startSeconds := measures[0].RelativeTime
+	duration := measures[len(measures)-1].RelativeTime - startSeconds
+	numSamples := int(math.Floor(duration*rate)) + 1
+	channels := resampleMoTeCChannels(measures, data.Laps, rate, numSamples)
+
+	distance := channels[1].values
+	venue := ""
+	if track := data.TrackInformation.Track; track != nil {
+		venue = track.Name
+	}
+	device := "TrackAddict"
+	if data.SessionInfo != nil && data.SessionInfo.App != "" {
+		device = data.SessionInfo.App
+	}
+	start := measures[0].Time()
+
+	lines := [][]string{
+		{"Format", "MoTeC CSV File", "", "", "Workbook", ""},
+		{"Venue", venue, "", "", "Worksheet", ""},
+		{"Vehicle", "", "", "", "Vehicle Desc", ""},
+		{"Driver", DriverName(config.InputFile), "", "", "Engine ID", ""},
+		{"Device", device, "", "", "Session", "1"},
+		{"Comment", "", "", "", "Origin Time", "0.000", "s"},
+		{"Log Date", start.Format("02/01/2006"), "", "", "Start Time", "0.000", "s"},
+		{"Log Time", start.Format("15:04:05"), "", "", "End Time", fmt.Sprintf("%.3f", duration), "s"},
+		{"Sample Rate", fmt.Sprintf("%.3f", rate), "Hz", "", "Start Distance", "0", "m"},
+		{"Duration", fmt.Sprintf("%.3f", duration), "s", "", "End Distance", fmt.Sprintf("%.0f", distance[len(distance)-1]), "m"},
+		{"Range", "entire outing", "", "", "", "", ""},
+		{"Beacon Markers", formatMoTeCBeacons(data.Laps, startSeconds, duration)},
+		{},
+		{},
+	}
+	var names, units []string
+	for _, channel := range channels {
+		names = append(names, channel.name)
+		units = append(units, channel.unit)
+	}
+	lines = append(lines, names, units, []string{}, []string{})
+	for _, line := range lines {
+		if err := writeMoTeCLine(w, line); err != nil {
+			return err
+		}
+	}
+
+	row := make([]string, len(channels))
+	for i := 0; i < numSamples; i++ {
+		for c, channel := range channels {
+			row[c] = strconv.FormatFloat(channel.values[i], 'f', channel.precision, 64)
+		}
+		if err := writeMoTeCLine(w, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resampleMoTeCChannels interpolates the measurements linearly at the fixed rate and computes the derived channels.
+func resampleMoTeCChannels(measures []GPSMeasurement, laps []Lap, rate float64, numSamples int) []*motecChannel {
+	newChannel := func(name string, unit string, precision int) *motecChannel {
+		return &motecChannel{name: name, unit: unit, precision: precision, values: make([]float64, numSamples)}
+	}
+	timeChannel := newChannel("Time", "s", 3)
+	distance := newChannel("Distance", "m", 1)
+	lapNumber := newChannel("Lap Number", "", 0)
+	lapTime := newChannel("Lap Time", "s", 3)
+	latitude := newChannel("GPS Latitude", "deg", 7)
+	longitude := newChannel("GPS Longitude", "deg", 7)
+	altitude := newChannel("GPS Altitude", "m", 1)
+	speed := newChannel("GPS Speed", "km/h", 2)
+	heading := newChannel("GPS Heading", "deg", 1)
+	accuracy := newChannel("GPS Accuracy", "m", 1)
+	lateral := newChannel("G Force Lat", "G", 3)
+	longitudinal := newChannel("G Force Long", "G", 3)
+	accelX := newChannel("Accel X", "G", 3)
+	accelY := newChannel("Accel Y", "G", 3)
+	accelZ := newChannel("Accel Z", "G", 3)
+
+	// speed and heading only change with GPS fixes, so they are interpolated between those to avoid steps
+	fixes := gpsFixes(measures)
+	fixHeadings := unwrapHeadings(fixes)
+
+	startSeconds := measures[0].RelativeTime
+	seconds := make([]float64, numSamples)
+	measureCursor := &motecCursor{measures: measures}
+	fixCursor := &motecCursor{measures: fixes}
+	for i := 0; i < numSamples; i++ {
+		seconds[i] = startSeconds + float64(i)/rate
+		a, b, interpolate := measureCursor.at(seconds[i])
+		fixA, fixB, interpolateFix := fixCursor.at(seconds[i])
+
+		unwrapped := interpolateFix(fixHeadings[fixCursor.previous], fixHeadings[fixCursor.next])
+		speed.values[i] = interpolateFix(fixA.SpeedKph, fixB.SpeedKph)
+		timeChannel.values[i] = seconds[i] - startSeconds
+		latitude.values[i] = interpolate(a.LatLng.Lat, b.LatLng.Lat)
+		longitude.values[i] = interpolate(a.LatLng.Lng, b.LatLng.Lng)
+		altitude.values[i] = interpolate(a.AltitudeMeters, b.AltitudeMeters)
+		heading.values[i] = math.Mod(math.Mod(unwrapped, 360)+360, 360)
+		accuracy.values[i] = interpolate(a.AccuracyMeters, b.AccuracyMeters)
+		accelX.values[i] = interpolate(a.Acceleration.X, b.Acceleration.X)
+		accelY.values[i] = interpolate(a.Acceleration.Y, b.Acceleration.Y)
+		accelZ.values[i] = interpolate(a.Acceleration.Z, b.Acceleration.Z)
+		if i > 0 {
+			distance.values[i] = distance.values[i-1] + haversineDistance(
+				LatLng{Lat: latitude.values[i-1], Lng: longitude.values[i-1]},
+				LatLng{Lat: latitude.values[i], Lng: longitude.values[i]})
+		}
+
+		for l, lap := range laps {
+			if seconds[i] >= lap.StartTimeSeconds && seconds[i] < lap.StartTimeSeconds+lap.Time.Seconds() {
+				lapNumber.values[i] = float64(exportLapNumber(l, lap))
+				lapTime.values[i] = seconds[i] - lap.StartTimeSeconds
+				break
+			}
+		}
+	}
+
+	longitudinal.values, lateral.values = gpsGForces(measures, seconds)
+
+	return []*motecChannel{timeChannel, distance, lapNumber, lapTime, latitude, longitude, altitude, speed, heading,
+		accuracy, lateral, longitudinal, accelX, accelY, accelZ}
+}
+
+// motecCursor walks through the measurements in time order and interpolates between the two around a given time.
+type motecCursor struct {
+	measures []GPSMeasurement
+	previous int
+	next     int
+}
+
+func (c *motecCursor) at(seconds float64) (GPSMeasurement, GPSMeasurement, func(float64, float64) float64) {
+	for c.next < len(c.measures)-1 && c.measures[c.next].RelativeTime < seconds {
+		c.next++
+	}
+	c.previous = Max(0, c.next-1)
+	a, b := c.measures[c.previous], c.measures[c.next]
+	fraction := 0.0
+	if b.RelativeTime > a.RelativeTime {
+		fraction = math.Max(0, math.Min(1, (seconds-a.RelativeTime)/(b.RelativeTime-a.RelativeTime)))
+	}
+	return a, b, func(x float64, y float64) float64 {
+		return x + fraction*(y-x)
+	}
+}
+
+// formatMoTeCBeacons lists the times at which laps start, relative to the start of the session. A lap ends where the
+// next one starts, so the start of every lap after the first is the one beacon of that boundary.
+func formatMoTeCBeacons(laps []Lap, startSeconds float64, duration float64) string {
+	var beacons []float64
+	for _, lap := range laps {
+		seconds := lap.StartTimeSeconds - startSeconds
+		if seconds > 0.001 && seconds < duration-0.001 {
+			beacons = append(beacons, seconds)
+		}
+	}
+	sort.Float64s(beacons)
+
+	var formatted []string
+	for i, seconds := range beacons {
+		if i > 0 && seconds-beacons[i-1] < 0.001 {
+			continue
+		}
+		formatted = append(formatted, fmt.Sprintf("%.3f", seconds))
+	}
+	return strings.Join(formatted, " ")
+}
+
+// writeMoTeCLine quotes every field like MoTeC does, empty fields stay empty.
+func writeMoTeCLine(w io.Writer, fields []string) error {
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		if field != "" {
+			quoted[i] = `"` + strings.Replace(field, `"`, `""`, -1) + `"`
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(quoted, ",")+"\n")
+	return err
+}
@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatMoTeCBeacons(t *testing.T) {
+	tests := []struct {
+		name     string
+		laps     []Lap
+		start    float64
+		duration float64
+		beacons  string
+	}{
+		{"no laps", nil, 0, 100, ""},
+		{"one beacon per boundary", []Lap{
+			{StartTimeSeconds: 0, Time: 30 * time.Second},
+			{StartTimeSeconds: 30.05, Time: 40 * time.Second},
+			{StartTimeSeconds: 70.1, Time: 20 * time.Second},
+		}, 0, 100, "30.050 70.100"},
+		{"relative to the start", []Lap{
+			{StartTimeSeconds: 110, Time: 30 * time.Second},
+			{StartTimeSeconds: 140, Time: 40 * time.Second},
+		}, 100, 100, "10.000 40.000"},
+		{"outside of the session", []Lap{
+			{StartTimeSeconds: 50, Time: 30 * time.Second},
+			{StartTimeSeconds: 150, Time: 40 * time.Second},
+		}, 0, 100, "50.000"},
+		{"duplicate starts", []Lap{
+			{StartTimeSeconds: 20, Time: 0},
+			{StartTimeSeconds: 20, Time: 30 * time.Second},
+		}, 0, 100, "20.000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if beacons := formatMoTeCBeacons(test.laps, test.start, test.duration); beacons != test.beacons {
+				t.Errorf("expected the beacons '%s', got '%s'", test.beacons, beacons)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NMEAUserEquivalentRangeErrorMeters converts the HDOP of a GGA sentence into an accuracy in meters, it is the typical
+// range error of a consumer GPS receiver.
+const NMEAUserEquivalentRangeErrorMeters = 5.0
+
+const knotsToKph = 1.852
+
+// nmeaParser turns NMEA sentences into measurements. Every valid RMC sentence is a measurement, GGA sentences add the
+// altitude and accuracy of the fix.
+type nmeaParser struct {
+	startTime      float64
+	started        bool
+	altitudeMeters float64
+	accuracyMeters float64
+}
+
+func newNMEAParser() *nmeaParser {
+	return &nmeaParser{accuracyMeters: NMEAUserEquivalentRangeErrorMeters}
+}
+
+// parseLine returns the measurement of an RMC sentence and nil for all other sentences.
+func (p *nmeaParser) parseLine(line string) (*GPSMeasurement, error) {
+	sentence, err := verifyNMEAChecksum(strings.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Split(sentence, ",")
+	if len(fields[0]) < 5 {
+		return nil, fmt.Errorf("invalid NMEA sentence %s", line)
+	}
+	// the first two letters are the talker, like GP for GPS or GN for multiple constellations
+	switch fields[0][len(fields[0])-3:] {
+	case "GGA":
+		return nil, p.parseGGA(fields)
+	case "RMC":
+		return p.parseRMC(fields)
+	}
+	return nil, nil
+}
+
+// verifyNMEAChecksum strips the leading $ and the checksum, sentences without a checksum are accepted as is.
+func verifyNMEAChecksum(line string) (string, error) {
+	if !strings.HasPrefix(line, "$") {
+		return "", fmt.Errorf("NMEA sentences start with $ but got %s", line)
+	}
+	sentence := line[1:]
+	star := strings.LastIndex(sentence, "*")
+	if star < 0 {
+		return sentence, nil
+	}
+
+	expected, err := strconv.ParseUint(sentence[star+1:], 16, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid NMEA checksum in %s", line)
+	}
+	var checksum byte
+	for i := 0; i < star; i++ {
+		checksum ^= sentence[i]
+	}
+	if checksum != byte(expected) {
+		return "", fmt.Errorf("NMEA checksum mismatch in %s", line)
+	}
+	return sentence[:star], nil
+}
+
+func (p *nmeaParser) parseGGA(fields []string) error {
+	// $GPGGA,time,lat,N,lng,E,quality,satellites,hdop,altitude,M,...
+	if len(fields) < 10 || fields[6] == "0" {
+		return nil
+	}
+	if hdop, err := strconv.ParseFloat(fields[8], 64); err == nil {
+		p.accuracyMeters = hdop * NMEAUserEquivalentRangeErrorMeters
+	}
+	if altitude, err := strconv.ParseFloat(fields[9], 64); err == nil {
+		p.altitudeMeters = altitude
+	}
+	return nil
+}
+
+func (p *nmeaParser) parseRMC(fields []string) (*GPSMeasurement, error) {
+	// $GPRMC,time,status,lat,N,lng,E,speed knots,course,date,...
+	if len(fields) < 10 {
+		return nil, fmt.Errorf("RMC sentence needs at least 10 fields but got %d", len(fields))
+	}
+	if fields[2] != "A" {
+		// no fix
+		return nil, nil
+	}
+
+	timestamp, err := time.Parse("020106150405.999999999", fields[9]+fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RMC date/time %s %s", fields[9], fields[1])
+	}
+	lat, err := parseNMEACoordinate(fields[3], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	lng, err := parseNMEACoordinate(fields[5], fields[6])
+	if err != nil {
+		return nil, err
+	}
+	speedKnots, _ := strconv.ParseFloat(fields[7], 64)
+	course, _ := strconv.ParseFloat(fields[8], 64)
+
+	utc := float64(timestamp.UnixNano()) / 1e9
+	if !p.started {
+		p.started = true
+		p.startTime = utc
+	}
+	return &GPSMeasurement{
+		LatLng:         LatLng{Lat: lat, Lng: lng},
+		RelativeTime:   utc - p.startTime,
+		UTCTimestamp:   utc,
+		AltitudeMeters: p.altitudeMeters,
+		SpeedKph:       speedKnots * knotsToKph,
+		AccuracyMeters: p.accuracyMeters,
+		HeadingDegrees: course,
+		GPSUpdate:      true,
+	}, nil
+}
+
+// parseNMEACoordinate converts "ddmm.mmmm" (or "dddmm.mmmm" for longitudes) and the hemisphere into degrees.
+func parseNMEACoordinate(value string, hemisphere string) (float64, error) {
+	dot := strings.Index(value, ".")
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return 0, fmt.Errorf("invalid NMEA coordinate %s", value)
+	}
+	degrees, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %s", value)
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %s", value)
+	}
+
+	coordinate := degrees + minutes/60
+	if hemisphere == "S" || hemisphere == "W" {
+		coordinate = -coordinate
+	}
+	return coordinate, nil
+}
+
+// formatNMEA turns a measurement into a GGA and an RMC sentence, the inverse of the nmeaParser.
+func formatNMEA(m GPSMeasurement) []string {
+	t := m.Time().UTC()
+	utc := t.Format("150405.000")
+	lat, ns := formatNMEACoordinate(m.LatLng.Lat, "N", "S", 2)
+	lng, ew := formatNMEACoordinate(m.LatLng.Lng, "E", "W", 3)
+	return []string{
+		withNMEAChecksum(fmt.Sprintf("GPGGA,%s,%s,%s,%s,%s,1,08,%.1f,%.1f,M,0.0,M,,",
+			utc, lat, ns, lng, ew, m.AccuracyMeters/NMEAUserEquivalentRangeErrorMeters, m.AltitudeMeters)),
+		withNMEAChecksum(fmt.Sprintf("GPRMC,%s,A,%s,%s,%s,%s,%.2f,%.1f,%s,,,A",
+			utc, lat, ns, lng, ew, m.SpeedKph/knotsToKph, m.HeadingDegrees, t.Format("020106"))),
+	}
+}
+
+func withNMEAChecksum(sentence string) string {
+	var checksum byte
+	for i := 0; i < len(sentence); i++ {
+		checksum ^= sentence[i]
+	}
+	return fmt.Sprintf("$%s*%02X", sentence, checksum)
+}
+
+// formatNMEACoordinate converts degrees into "ddmm.mmmm" with the given number of degree digits and the hemisphere.
+func formatNMEACoordinate(coordinate float64, positive string, negative string, degreeDigits int) (string, string) {
+	hemisphere := positive
+	if coordinate < 0 {
+		hemisphere = negative
+		coordinate = -coordinate
+	}
+	degrees := int(coordinate)
+	minutes := (coordinate - float64(degrees)) * 60
+	return fmt.Sprintf("%0*d%07.4f", degreeDigits, degrees, minutes), hemisphere
+}
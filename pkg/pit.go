@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PitLaneMaxSpeedKph is the speed the car has to stay below, on median, for a pit lane annotation to count as a visit.
+	// The apps annotate the pit lane by a GPS zone, so a noisy position on the track next to it can trigger it too.
+	PitLaneMaxSpeedKph = 60.0
+	// StandstillSpeedKph is the speed below which the car counts as stopped.
+	StandstillSpeedKph = 5.0
+	// PitStopMinStandstillSeconds is how long the car has to stand still to count as a pit stop without any annotation.
+	PitStopMinStandstillSeconds = 20.0
+)
+
+// ParsePolygon parses a polygon given as "lat,lng;lat,lng;..." with at least three corners.
+func ParsePolygon(s string) ([]LatLng, error) {
+	var polygon []LatLng
+	for _, corner := range strings.Split(s, ";") {
+		split := strings.Split(corner, ",")
+		if len(split) != 2 {
+			return nil, fmt.Errorf("a polygon corner needs to be lat,lng but got '%s'", corner)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(split[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse polygon latitude '%s': %v", split[0], err)
+		}
+		lng, err := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse polygon longitude '%s': %v", split[1], err)
+		}
+		polygon = append(polygon, LatLng{Lat: lat, Lng: lng})
+	}
+	if len(polygon) < 3 {
+		return nil, fmt.Errorf("a polygon needs at least three corners but got %d", len(polygon))
+	}
+	return polygon, nil
+}
+
+// pointInPolygon uses ray casting, which is fine for the small polygons around a pit lane.
+func pointInPolygon(point LatLng, polygon []LatLng) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a := polygon[i]
+		b := polygon[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) &&
+			point.Lng < (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// speedHistogram allows a median speed of arbitrarily long intervals with constant memory.
+type speedHistogram struct {
+	buckets [400]int
+	n       int
+}
+
+func (h *speedHistogram) add(speedKph float64) {
+	bucket := Max(0, Min(len(h.buckets)-1, int(speedKph)))
+	h.buckets[bucket]++
+	h.n++
+}
+
+func (h *speedHistogram) median() float64 {
+	count := 0
+	for speed, c := range h.buckets {
+		count += c
+		if count*2 >= h.n {
+			return float64(speed)
+		}
+	}
+	return float64(len(h.buckets))
+}
+
+// pitDetector finds the pit visits of a session from the pit lane annotations, a pit lane polygon and long standstills.
+type pitDetector struct {
+	polygon         []LatLng
+	annotatedInPit  bool
+	candidate       *speedHistogram
+	candidateStart  int
+	standstill      bool
+	standstillStart int
+	standstillTime  float64
+	lastIndex       int
+	lastTime        float64
+}
+
+func newPitDetector(config DataConfig, track *Track) *pitDetector {
+	detector := &pitDetector{polygon: config.PitLane, lastIndex: -1}
+	detector.setTrack(track)
+	return detector
+}
+
+// setTrack uses the pit lane of the track unless one is configured.
+func (d *pitDetector) setTrack(track *Track) {
+	if d.polygon == nil && track != nil {
+		d.polygon = track.PitLane
+	}
+}
+
+func (d *pitDetector) event(event Event) {
+	switch event.Type {
+	case PitLaneEntryEvent:
+		d.annotatedInPit = true
+	case PitLaneExitEvent:
+		d.annotatedInPit = false
+	}
+}
+
+// add returns the pit visits that ended with the measurement before the given one.
+func (d *pitDetector) add(index int, measure GPSMeasurement) []PitVisit {
+	var visits []PitVisit
+	inPit := d.annotatedInPit || (len(d.polygon) >= 3 && pointInPolygon(measure.LatLng, d.polygon))
+	if inPit && d.candidate == nil {
+		d.candidate = &speedHistogram{}
+		d.candidateStart = index
+	} else if !inPit && d.candidate != nil {
+		visits = append(visits, d.closeCandidate(index)...)
+	}
+
+	if d.candidate != nil {
+		d.candidate.add(measure.SpeedKph)
+	}
+
+	stopped := measure.SpeedKph < StandstillSpeedKph
+	if stopped && !d.standstill {
+		d.standstill = true
+		d.standstillStart = index
+		d.standstillTime = measure.RelativeTime
+	} else if !stopped && d.standstill {
+		visits = append(visits, d.closeStandstill(index)...)
+	}
+
+	d.lastIndex = index
+	d.lastTime = measure.RelativeTime
+	return visits
+}
+
+func (d *pitDetector) finish() []PitVisit {
+	var visits []PitVisit
+	if d.candidate != nil {
+		visits = append(visits, d.closeCandidate(d.lastIndex+1)...)
+	}
+	if d.standstill {
+		visits = append(visits, d.closeStandstill(d.lastIndex+1)...)
+	}
+	return visits
+}
+
+func (d *pitDetector) closeCandidate(endIndexExclusive int) []PitVisit {
+	candidate := d.candidate
+	d.candidate = nil
+	if d.standstill {
+		// only the part of a standstill after the visit can become a visit of its own
+		d.standstillStart = endIndexExclusive
+		d.standstillTime = d.lastTime
+	}
+	if candidate.median() >= PitLaneMaxSpeedKph {
+		return nil
+	}
+	return []PitVisit{{MeasureStartIndex: d.candidateStart, MeasureEndIndexExclusive: endIndexExclusive}}
+}
+
+func (d *pitDetector) closeStandstill(endIndexExclusive int) []PitVisit {
+	d.standstill = false
+	// standing still within an annotated visit is part of that visit already
+	if d.candidate != nil || d.lastTime-d.standstillTime < PitStopMinStandstillSeconds {
+		return nil
+	}
+	return []PitVisit{{MeasureStartIndex: d.standstillStart, MeasureEndIndexExclusive: endIndexExclusive}}
+}
+
+// detectPitVisits runs the pit detection on the measurements the laps were computed on.
+func detectPitVisits(config DataConfig, data *TrackData) []PitVisit {
+	detector := newPitDetector(config, data.TrackInformation.Track)
+	measures := data.Measures(config)
+
+	var visits []PitVisit
+	nextEvent := 0
+	for i, measure := range measures {
+		for nextEvent < len(data.Events) && processedMeasureIndex(config, data.Events[nextEvent].MeasureIndex) <= i {
+			detector.event(data.Events[nextEvent])
+			nextEvent++
+		}
+		visits = append(visits, detector.add(i, measure)...)
+	}
+	return mergePitVisits(append(visits, detector.finish()...))
+}
+
+// processedMeasureIndex converts the index of a raw measurement to the one of the smoothed measurements, which lack the
+// first measurement that only initialized the filter.
+func processedMeasureIndex(config DataConfig, rawIndex int) int {
+	if config.UseSmoothedGPSData {
+		return Max(0, rawIndex-1)
+	}
+	return rawIndex
+}
+
+// mergePitVisits sorts the visits and joins the overlapping ones.
+func mergePitVisits(visits []PitVisit) []PitVisit {
+	sort.Slice(visits, func(i, j int) bool {
+		return visits[i].MeasureStartIndex < visits[j].MeasureStartIndex
+	})
+
+	var merged []PitVisit
+	for _, visit := range visits {
+		last := len(merged) - 1
+		if last >= 0 && visit.MeasureStartIndex <= merged[last].MeasureEndIndexExclusive {
+			merged[last].MeasureEndIndexExclusive = Max(merged[last].MeasureEndIndexExclusive, visit.MeasureEndIndexExclusive)
+		} else {
+			merged = append(merged, visit)
+		}
+	}
+	return merged
+}
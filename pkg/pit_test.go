@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pitTestPolygon is a square around pitTestInside, pitTestOutside is on the track next to it.
+var (
+	pitTestPolygon = []LatLng{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 1}, {Lat: 1, Lng: 1}, {Lat: 1, Lng: 0}}
+	pitTestInside  = LatLng{Lat: 0.5, Lng: 0.5}
+	pitTestOutside = LatLng{Lat: 2, Lng: 2}
+)
+
+// pitTestSession is a session with one measurement per second, the speed and position of measurement i come from
+// the functions.
+func pitTestSession(n int, speed func(i int) float64, inPolygon func(i int) bool, events []Event) *TrackData {
+	data := &TrackData{TrackInformation: &TrackInformation{}, Events: events}
+	for i := 0; i < n; i++ {
+		m := GPSMeasurement{RelativeTime: float64(i), SpeedKph: speed(i), LatLng: pitTestOutside}
+		if inPolygon(i) {
+			m.LatLng = pitTestInside
+		}
+		data.GPSMeasurement = append(data.GPSMeasurement, m)
+	}
+	return data
+}
+
+// between returns a function that is true for the indices in [from, to).
+func between(from, to int) func(i int) bool {
+	return func(i int) bool {
+		return i >= from && i < to
+	}
+}
+
+// speeds drives at 100 km/h, except for the indices in [from, to) where it drives at the given speed.
+func speeds(from, to int, speed float64) func(i int) float64 {
+	return func(i int) float64 {
+		if between(from, to)(i) {
+			return speed
+		}
+		return 100
+	}
+}
+
+func TestDetectPitVisits(t *testing.T) {
+	annotated := []Event{{Type: PitLaneEntryEvent, MeasureIndex: 10}, {Type: PitLaneExitEvent, MeasureIndex: 20}}
+	never := between(0, 0)
+
+	tests := []struct {
+		name     string
+		data     *TrackData
+		config   DataConfig
+		track    *Track
+		expected []PitVisit
+	}{
+		{"annotated visit", pitTestSession(60, speeds(10, 20, 40), never, annotated), DataConfig{}, nil,
+			[]PitVisit{{10, 20}}},
+		// a noisy position on the track next to the pit lane triggers the annotation at racing speed
+		{"annotated at racing speed", pitTestSession(60, speeds(0, 0, 0), never, annotated), DataConfig{}, nil, nil},
+		{"configured polygon", pitTestSession(60, speeds(30, 45, 50), between(30, 45), nil),
+			DataConfig{PitLane: pitTestPolygon}, nil, []PitVisit{{30, 45}}},
+		{"polygon of the track", pitTestSession(60, speeds(30, 45, 50), between(30, 45), nil),
+			DataConfig{}, &Track{PitLane: pitTestPolygon}, []PitVisit{{30, 45}}},
+		{"polygon at racing speed", pitTestSession(60, speeds(0, 0, 0), between(30, 45), nil),
+			DataConfig{PitLane: pitTestPolygon}, nil, nil},
+		{"polygon until the end", pitTestSession(60, speeds(50, 60, 30), between(50, 60), nil),
+			DataConfig{PitLane: pitTestPolygon}, nil, []PitVisit{{50, 60}}},
+		{"long standstill", pitTestSession(60, speeds(20, 45, 0), never, nil), DataConfig{}, nil,
+			[]PitVisit{{20, 45}}},
+		{"short standstill", pitTestSession(60, speeds(20, 35, 0), never, nil), DataConfig{}, nil, nil},
+		{"standstill in an annotated visit", pitTestSession(60, speeds(5, 35, 0), never,
+			[]Event{{Type: PitLaneEntryEvent, MeasureIndex: 0}, {Type: PitLaneExitEvent, MeasureIndex: 40}}),
+			DataConfig{}, nil, []PitVisit{{0, 40}}},
+		// only the part of the standstill after the annotated exit counts, it is merged with the visit
+		{"standstill after an annotated visit", pitTestSession(60, speeds(15, 50, 0), never, annotated),
+			DataConfig{}, nil, []PitVisit{{10, 50}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.data.TrackInformation.Track = test.track
+			visits := detectPitVisits(test.config, test.data)
+			if !reflect.DeepEqual(visits, test.expected) {
+				t.Errorf("expected the visits %v, got %v", test.expected, visits)
+			}
+		})
+	}
+}
+
+func TestMergePitVisits(t *testing.T) {
+	tests := []struct {
+		name     string
+		visits   []PitVisit
+		expected []PitVisit
+	}{
+		{"none", nil, nil},
+		{"separate", []PitVisit{{30, 40}, {10, 20}}, []PitVisit{{10, 20}, {30, 40}}},
+		{"overlapping", []PitVisit{{10, 30}, {20, 40}}, []PitVisit{{10, 40}}},
+		{"adjacent", []PitVisit{{20, 40}, {10, 20}}, []PitVisit{{10, 40}}},
+		{"contained", []PitVisit{{10, 40}, {15, 20}, {35, 50}}, []PitVisit{{10, 50}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if merged := mergePitVisits(test.visits); !reflect.DeepEqual(merged, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, merged)
+			}
+		})
+	}
+}
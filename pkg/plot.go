@@ -1,10 +1,12 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
 	sm "github.com/flopp/go-staticmaps"
 	"github.com/fogleman/gg"
 	"github.com/golang/geo/s2"
+	"image"
 	"image/color"
 	"math/rand"
 	"strings"
@@ -21,18 +23,19 @@ func Plot(data *TrackData, config PlotConfig) error {
 	laps := data.Laps
 	if config.FastestLapOnly {
 		// this method is guaranteed to only have a single lap
-		laps = filterFastestLap(laps)
-		fmt.Printf("Plotting the fastest Lap [%s]\n", getLapDuration(laps[0]).String())
+		var err error
+		laps, err = filterFastestLap(laps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Plotting the fastest Lap [%s]\n", laps[0].Time.String())
 	}
 
-	measures := data.GPSMeasurement
-	if config.UseSmoothedGPSData {
-		measures = data.FilteredGPSMeasurement
-	}
+	measures := data.Measures(config.DataConfig)
 
 	gpsErrorStdDevMeters := stddev(measures,
 		func(measurement GPSMeasurement) float64 {
-			return measurement.accuracyMeter
+			return measurement.AccuracyMeters
 		})
 
 	outputFile := config.OutputFile
@@ -40,17 +43,23 @@ func Plot(data *TrackData, config PlotConfig) error {
 	ctx := newPlotContext(config, "")
 	for lapNum := 0; lapNum < len(laps); lapNum++ {
 		if config.PlotLapsSeparately {
-			ctx = newPlotContext(config, fmt.Sprintf("Lap Time: %s", getLapDuration(laps[lapNum]).String()))
+			ctx = newPlotContext(config, fmt.Sprintf("Lap Time: %s", laps[lapNum].Time.String()))
 		} else {
 			pathColor = color.RGBA{R: uint8(rand.Intn(255)), G: uint8(rand.Intn(255)), B: uint8(rand.Intn(255)), A: 0xff}
 		}
 
-		addStartEndZone(ctx, data.TrackInformation.startLatLng, gpsErrorStdDevMeters)
+		if data.TrackInformation.Track != nil {
+			addTrackGates(ctx, data.TrackInformation.Track)
+		} else {
+			addStartEndZone(ctx, data.TrackInformation.StartLatLng, gpsErrorStdDevMeters)
+		}
 		addLapPathToContext(laps[lapNum], measures, ctx, pathColor)
 
 		if config.PlotLapsSeparately {
 			outFileLap := fmt.Sprintf("%s_lap_%d.png", outputFile, lapNum)
-			if lapNum == 0 {
+			if laps[lapNum].Type == PointToPointRun {
+				outFileLap = fmt.Sprintf("%s_run_%d.png", outputFile, lapNum+1)
+			} else if lapNum == 0 {
 				outFileLap = fmt.Sprintf("%s_outlap.png", outputFile)
 			} else if lapNum == len(laps)-1 {
 				outFileLap = fmt.Sprintf("%s_inlap.png", outputFile)
@@ -71,6 +80,30 @@ func Plot(data *TrackData, config PlotConfig) error {
 	return nil
 }
 
+// RenderPlot draws the given laps of the session into a single map image, like Plot does without PlotLapsSeparately.
+func RenderPlot(data *TrackData, config PlotConfig, laps []Lap) (image.Image, error) {
+	measures := data.Measures(config.DataConfig)
+	ctx := newPlotContext(config, "")
+	if data.TrackInformation.Track != nil {
+		addTrackGates(ctx, data.TrackInformation.Track)
+	} else {
+		gpsErrorStdDevMeters := stddev(measures,
+			func(measurement GPSMeasurement) float64 {
+				return measurement.AccuracyMeters
+			})
+		addStartEndZone(ctx, data.TrackInformation.StartLatLng, gpsErrorStdDevMeters)
+	}
+
+	for _, lap := range laps {
+		pathColor := Black
+		if len(laps) > 1 {
+			pathColor = color.RGBA{R: uint8(rand.Intn(255)), G: uint8(rand.Intn(255)), B: uint8(rand.Intn(255)), A: 0xff}
+		}
+		addLapPathToContext(lap, measures, ctx, pathColor)
+	}
+	return ctx.Render()
+}
+
 func renderAndSave(ctx *sm.Context, outputFile string) error {
 	img, err := ctx.Render()
 	if err != nil {
@@ -93,37 +126,57 @@ func addLapPathToContext(lap Lap, measures []GPSMeasurement, ctx *sm.Context, co
 	lapSet := MeasuresForLap(lap, measures)
 	positions := make([]s2.LatLng, len(lapSet))
 	for i := 0; i < len(lapSet); i++ {
-		// fmt.Printf("[%f, %f]\n", lapSet[i].latLng[0], lapSet[i].latLng[1])
-		positions[i] = s2LatLngFromSlice(lapSet[i].latLng)
+		// fmt.Printf("[%f, %f]\n", lapSet[i].LatLng.Lat, lapSet[i].LatLng.Lng)
+		positions[i] = s2LatLng(lapSet[i].LatLng)
 	}
 	lapPath := sm.NewPath(positions, color, 2.0)
 	ctx.AddPath(lapPath)
 }
 
-func addStartEndZone(ctx *sm.Context, startLatLng []float64, radius float64) {
+func addStartEndZone(ctx *sm.Context, startLatLng *LatLng, radius float64) {
+	if startLatLng == nil {
+		return
+	}
 	ctx.AddCircle(&sm.Circle{
-		Position: s2LatLngFromSlice(startLatLng),
+		Position: s2LatLng(*startLatLng),
 		Radius:   radius,
 		Color:    Red,
 		Fill:     Transparent,
 		Weight:   2})
 }
 
-func filterFastestLap(laps []Lap) []Lap {
+func addTrackGates(ctx *sm.Context, track *Track) {
+	ctx.AddPath(sm.NewPath([]s2.LatLng{s2LatLng(track.StartFinish.A), s2LatLng(track.StartFinish.B)}, Red, 3.0))
+	if track.Finish != nil {
+		ctx.AddPath(sm.NewPath([]s2.LatLng{s2LatLng(track.Finish.A), s2LatLng(track.Finish.B)}, Red, 3.0))
+	}
+	for _, gate := range track.Sectors {
+		ctx.AddPath(sm.NewPath([]s2.LatLng{s2LatLng(gate.A), s2LatLng(gate.B)}, Black, 3.0))
+	}
+}
+
+// filterFastestLap only considers the valid flying laps, unless there are none.
+func filterFastestLap(laps []Lap) ([]Lap, error) {
+	if len(laps) == 0 {
+		return nil, errors.New("the session has no laps")
+	}
+	if valid := ValidFlyingLaps(laps); len(valid) > 0 {
+		laps = valid
+	}
 	fastestIndex := 0
-	min := laps[fastestIndex].timeSeconds
+	min := laps[fastestIndex].Time
 	for i, lap := range laps {
-		if lap.timeSeconds < min {
+		if lap.Time < min {
 			fastestIndex = i
-			min = lap.timeSeconds
+			min = lap.Time
 		}
 	}
 	laps = []Lap{laps[fastestIndex]}
-	return laps
+	return laps, nil
 }
 
-func s2LatLngFromSlice(slice []float64) s2.LatLng {
-	return s2.LatLngFromDegrees(slice[0], slice[1])
+func s2LatLng(latLng LatLng) s2.LatLng {
+	return s2.LatLngFromDegrees(latLng.Lat, latLng.Lng)
 }
 
 func newPlotContext(config PlotConfig, attributionHackString string) *sm.Context {
@@ -0,0 +1,31 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilterFastestLap(t *testing.T) {
+	tests := []struct {
+		name    string
+		laps    []Lap
+		fastest time.Duration
+		err     bool
+	}{
+		{"no laps", nil, 0, true},
+		{"valid laps only", []Lap{{Time: 50 * time.Second}, {Time: 90 * time.Second, Valid: true}, {Time: 80 * time.Second, Valid: true}},
+			80 * time.Second, false},
+		{"no valid laps", []Lap{{Time: 90 * time.Second}, {Time: 70 * time.Second}}, 70 * time.Second, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			laps, err := filterFastestLap(test.laps)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error=%v, got %v", test.err, err)
+			}
+			if err == nil && (len(laps) != 1 || laps[0].Time != test.fastest) {
+				t.Errorf("expected the lap of %s, got %+v", test.fastest, laps)
+			}
+		})
+	}
+}
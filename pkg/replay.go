@@ -0,0 +1,379 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReplayFormatCSV  = "csv"
+	ReplayFormatNMEA = "nmea"
+	ReplayFormatJSON = "json"
+)
+
+// ReplayConfig configures the replay of a recorded session.
+type ReplayConfig struct {
+	DataConfig
+	// Target is where the lines are sent to: "-" for stdout, "tcp://host:port" or "udp://host:port".
+	Target string
+	// Format of the lines, one of ReplayFormatCSV, ReplayFormatNMEA or ReplayFormatJSON.
+	Format string
+	// Speed is the factor of the session time to the wall time, 2 replays twice as fast.
+	Speed float64
+	// SeekSeconds skips the beginning of the session.
+	SeekSeconds float64
+	// Loop starts over at the end of the session, the timestamps keep counting up.
+	Loop bool
+	// Controls optionally reads commands while replaying: "pause" (or an empty line) toggles the pause,
+	// "seek 120" jumps to a session time, "seek +30" or "seek -30" relative to the current one and "speed 4" changes the speed.
+	Controls io.Reader
+}
+
+// replayRecord is a measurement in the json format.
+type replayRecord struct {
+	RelativeSeconds float64 `json:"relativeSeconds"`
+	UTCTimestamp    float64 `json:"utcTimestamp"`
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	AltitudeMeters  float64 `json:"altitudeMeters"`
+	SpeedKph        float64 `json:"speedKph"`
+	HeadingDegrees  float64 `json:"headingDegrees"`
+	AccuracyMeters  float64 `json:"accuracyMeters"`
+	AccelerationX   float64 `json:"accelerationX"`
+	AccelerationY   float64 `json:"accelerationY"`
+	AccelerationZ   float64 `json:"accelerationZ"`
+	GPSUpdate       bool    `json:"gpsUpdate"`
+}
+
+var errReplayRestart = errors.New("replay restarts after seeking backwards")
+
+// Replay streams the input file of the config to the target, honoring the relative time of the measurements.
+func Replay(ctx context.Context, config ReplayConfig, stdout io.Writer) error {
+	if config.Speed <= 0 {
+		return fmt.Errorf("the replay speed has to be positive but was %f", config.Speed)
+	}
+	format, err := newReplayFormatter(config.Format)
+	if err != nil {
+		return err
+	}
+
+	out := stdout
+	if config.Target != "-" {
+		network, address, err := splitLiveAddress(config.Target)
+		if err != nil {
+			return err
+		}
+		conn, err := net.Dial(network, address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		out = conn
+	}
+
+	clock := newReplayClock(config.Speed, config.SeekSeconds)
+	if config.Controls != nil {
+		go clock.readControls(ctx, config.Controls)
+	}
+
+	headerWritten := false
+	var comments []string
+	// offsetSeconds keeps the timestamps increasing when looping, so the receiver sees one long session
+	offsetSeconds := 0.0
+	firstSeconds, lastSeconds, intervalSeconds := 0.0, 0.0, 0.0
+	for {
+		err := StreamData(ctx, config.DataConfig, StreamCallbacks{
+			SessionInfo: func(info *SessionInfo) error {
+				comments = info.HeaderComments
+				return nil
+			},
+			TrackInformation: func(info *TrackInformation) error {
+				if headerWritten || config.Format != ReplayFormatCSV {
+					return nil
+				}
+				headerWritten = true
+				return writeReplayLines(out, raceRenderHeader(comments, info))
+			},
+			Measurement: func(index int, measure GPSMeasurement) error {
+				if index == 0 {
+					firstSeconds = measure.RelativeTime
+				} else {
+					intervalSeconds = measure.RelativeTime - lastSeconds
+				}
+				lastSeconds = measure.RelativeTime
+
+				emit, err := clock.wait(ctx, measure.RelativeTime)
+				if err != nil || !emit {
+					return err
+				}
+				measure.RelativeTime += offsetSeconds
+				measure.UTCTimestamp += offsetSeconds
+				lines, err := format(measure)
+				if err != nil {
+					return err
+				}
+				return writeReplayLines(out, lines)
+			},
+		})
+		if err == errReplayRestart {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !config.Loop {
+			return nil
+		}
+		log.Printf("Replay reached the end of the session, starting over")
+		// the next loop starts one sample after the end of this one
+		offsetSeconds += lastSeconds - firstSeconds + intervalSeconds
+		clock.rewind()
+	}
+}
+
+// writeReplayLines writes every line on its own, so that each ends up in its own datagram for udp.
+func writeReplayLines(w io.Writer, lines []string) error {
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newReplayFormatter(format string) (func(GPSMeasurement) ([]string, error), error) {
+	switch format {
+	case ReplayFormatCSV:
+		return func(m GPSMeasurement) ([]string, error) {
+			return []string{formatTrackAddictLine(m)}, nil
+		}, nil
+	case ReplayFormatNMEA:
+		return func(m GPSMeasurement) ([]string, error) {
+			// NMEA only knows GPS fixes, the measurements in between only carry accelerometer data
+			if !m.GPSUpdate {
+				return nil, nil
+			}
+			return formatNMEA(m), nil
+		}, nil
+	case ReplayFormatJSON:
+		return func(m GPSMeasurement) ([]string, error) {
+			line, err := json.Marshal(replayRecord{
+				RelativeSeconds: m.RelativeTime,
+				UTCTimestamp:    m.UTCTimestamp,
+				Lat:             m.LatLng.Lat,
+				Lng:             m.LatLng.Lng,
+				AltitudeMeters:  m.AltitudeMeters,
+				SpeedKph:        m.SpeedKph,
+				HeadingDegrees:  m.HeadingDegrees,
+				AccuracyMeters:  m.AccuracyMeters,
+				AccelerationX:   m.Acceleration.X,
+				AccelerationY:   m.Acceleration.Y,
+				AccelerationZ:   m.Acceleration.Z,
+				GPSUpdate:       m.GPSUpdate,
+			})
+			return []string{string(line)}, err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown replay format '%s', expected csv, nmea or json", format)
+}
+
+// trackAddictHeader are the header lines the trackAddictParser needs, including the start/finish point if known.
+func trackAddictHeader(info *TrackInformation) []string {
+	var lines []string
+	if info != nil && info.StartLatLng != nil {
+		lines = append(lines, fmt.Sprintf("# End Point: %.5f, %.5f  @ -1.00 deg", info.StartLatLng.Lat, info.StartLatLng.Lng))
+	}
+	return append(lines, `"Time","UTC Time","Lap","Predicted Lap Time","Predicted vs Best Lap","GPS_Update","GPS_Delay",`+
+		`"Latitude","Longitude","Altitude (m)","Altitude (ft)","Speed (Km/h)","Heading","Accuracy (m)","Accel X","Accel Y",`+
+		`"Accel Z","Brake (calculated)","Barometric Pressure (kPa)","Pressure Altitude (m)"`)
+}
+
+// formatTrackAddictLine writes the 20 columns of a TrackAddict csv line, the channels of other loggers are zero.
+func formatTrackAddictLine(m GPSMeasurement) string {
+	gpsUpdate := 0
+	if m.GPSUpdate {
+		gpsUpdate = 1
+	}
+	channels := m.Channels
+	return fmt.Sprintf("%.3f,%.3f,%d,%s,%s,%d,%.3f,%.7f,%.7f,%.1f,%.0f,%.1f,%.1f,%.1f,%.2f,%.2f,%.2f,%s,%.2f,%.1f",
+		m.RelativeTime, m.UTCTimestamp, m.TrackAddictLap, formatChannel(channels.PredictedLapSeconds),
+		formatChannel(channels.PredictedVsBestLapSeconds), gpsUpdate, channels.GPSDelaySeconds, m.LatLng.Lat, m.LatLng.Lng,
+		m.AltitudeMeters, m.AltitudeMeters*3.28084, m.SpeedKph, m.HeadingDegrees, m.AccuracyMeters,
+		m.Acceleration.X, m.Acceleration.Y, m.Acceleration.Z, formatChannel(channels.Brake),
+		channels.BarometricPressureKPa, channels.PressureAltitudeMeters)
+}
+
+// formatChannel writes a value with as few digits as needed, TrackAddict writes zero without any decimals.
+func formatChannel(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// replayClock maps the wall time to the session time, it can be paused, sped up and moved around while replaying.
+type replayClock struct {
+	mu sync.Mutex
+	// changed is closed and replaced whenever the clock is changed, to wake up a waiting replay
+	changed chan struct{}
+	// positionSeconds is the session time at the anchor
+	positionSeconds float64
+	anchor          time.Time
+	speed           float64
+	paused          bool
+	skipUntil       float64
+	lastEmitted     float64
+	restart         bool
+}
+
+func newReplayClock(speed float64, seekSeconds float64) *replayClock {
+	return &replayClock{
+		changed:         make(chan struct{}),
+		positionSeconds: seekSeconds,
+		anchor:          time.Now(),
+		speed:           speed,
+		skipUntil:       seekSeconds,
+	}
+}
+
+func (c *replayClock) nowLocked() float64 {
+	if c.paused {
+		return c.positionSeconds
+	}
+	return c.positionSeconds + time.Since(c.anchor).Seconds()*c.speed
+}
+
+func (c *replayClock) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait blocks until the session time reached the given one. It returns false for measurements that were skipped by
+// seeking forward and errReplayRestart if the session has to be read again after seeking backwards.
+func (c *replayClock) wait(ctx context.Context, seconds float64) (bool, error) {
+	for {
+		c.mu.Lock()
+		if c.restart {
+			c.restart = false
+			c.mu.Unlock()
+			return false, errReplayRestart
+		}
+		if seconds < c.skipUntil {
+			c.mu.Unlock()
+			return false, nil
+		}
+		now := c.nowLocked()
+		if !c.paused && seconds <= now {
+			c.lastEmitted = seconds
+			c.mu.Unlock()
+			return true, nil
+		}
+		changed := c.changed
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !c.paused {
+			timer = time.NewTimer(time.Duration((seconds - now) / c.speed * float64(time.Second)))
+			expired = timer.C
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (c *replayClock) togglePause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.anchor = time.Now()
+		log.Printf("Replay resumed at %.1fs", c.positionSeconds)
+	} else {
+		c.positionSeconds = c.nowLocked()
+		log.Printf("Replay paused at %.1fs", c.positionSeconds)
+	}
+	c.paused = !c.paused
+	c.notifyLocked()
+}
+
+func (c *replayClock) seek(seconds float64, relative bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if relative {
+		seconds += c.nowLocked()
+	}
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds < c.lastEmitted {
+		c.restart = true
+	}
+	c.positionSeconds = seconds
+	c.anchor = time.Now()
+	c.skipUntil = seconds
+	c.lastEmitted = seconds
+	log.Printf("Replay continues at %.1fs", seconds)
+	c.notifyLocked()
+}
+
+func (c *replayClock) setSpeed(speed float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.positionSeconds = c.nowLocked()
+	c.anchor = time.Now()
+	c.speed = speed
+	log.Printf("Replay speed is now %gx", speed)
+	c.notifyLocked()
+}
+
+// rewind starts the session over when looping, it keeps the pause and speed.
+func (c *replayClock) rewind() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.positionSeconds = 0
+	c.anchor = time.Now()
+	c.skipUntil = 0
+	c.lastEmitted = 0
+	c.restart = false
+}
+
+func (c *replayClock) readControls(ctx context.Context, controls io.Reader) {
+	scanner := bufio.NewScanner(controls)
+	for scanner.Scan() && ctx.Err() == nil {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] == "pause" || fields[0] == "p" {
+			c.togglePause()
+			continue
+		}
+		if len(fields) != 2 {
+			log.Printf("Unknown replay command '%s'", scanner.Text())
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[1], 64)
+		switch {
+		case err != nil:
+			log.Printf("Can't parse the number in '%s'", scanner.Text())
+		case fields[0] == "seek" || fields[0] == "s":
+			c.seek(value, strings.HasPrefix(fields[1], "+") || strings.HasPrefix(fields[1], "-"))
+		case (fields[0] == "speed" || fields[0] == "x") && value > 0:
+			c.setSpeed(value)
+		default:
+			log.Printf("Unknown replay command '%s'", scanner.Text())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+var errEnoughLines = errors.New("enough lines")
+
+// lineCollector keeps the written lines and fails once it has enough, which is the only way to stop a looping replay.
+type lineCollector struct {
+	lines []string
+	max   int
+}
+
+func (c *lineCollector) Write(p []byte) (int, error) {
+	c.lines = append(c.lines, strings.TrimSuffix(string(p), "\n"))
+	if len(c.lines) >= c.max {
+		return len(p), errEnoughLines
+	}
+	return len(p), nil
+}
+
+func TestReplayLoop(t *testing.T) {
+	file, err := ioutil.TempFile("", "replay-*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(testTrackAddictHeader +
+		"0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n" +
+		"0.050,1559734111.050,0,0,0,0,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n" +
+		"0.100,1559734111.100,0,0,0,1,0.000,51.9993283,13.6881679,91.2,299,12.5,90.0,5.0,0.10,-0.20,0.30,1,100.44,74.1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	out := &lineCollector{max: 3 + 6}
+	err = Replay(context.Background(), ReplayConfig{
+		DataConfig: DataConfig{InputFile: file.Name()},
+		Target:     "-",
+		Format:     ReplayFormatCSV,
+		Speed:      1e6,
+		Loop:       true,
+	}, out)
+	if err != errEnoughLines {
+		t.Fatalf("expected the replay to stop at the collector, got %v", err)
+	}
+
+	if !strings.HasPrefix(out.lines[0], "# RaceRender Data: TrackAddict") || !strings.HasPrefix(out.lines[1], "# End Point") {
+		t.Errorf("expected the header comments of the session, got %v", out.lines[:3])
+	}
+	for i, expected := range []string{"0.000", "0.050", "0.100", "0.150", "0.200", "0.250"} {
+		if !strings.HasPrefix(out.lines[3+i], expected+",") {
+			t.Errorf("expected measurement %d at %s, got %s", i, expected, out.lines[3+i])
+		}
+	}
+}
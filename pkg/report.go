@@ -0,0 +1,608 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	reportChartWidth  = 900
+	reportChartHeight = 300
+	reportMapSize     = 600
+	// reportProfileStepMeters thins out the lap profiles, so the report stays small even for long sessions.
+	reportProfileStepMeters = 5.0
+)
+
+// reportPalette colors the laps in the map and the charts, the fastest lap always gets the first color.
+var reportPalette = []string{"#d62728", "#1f77b4", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf",
+	"#bcbd22", "#7f7f7f"}
+
+// lapProfile is the distance, elapsed time and speed along a lap.
+type lapProfile struct {
+	distanceMeters []float64
+	seconds        []float64
+	speedKph       []float64
+}
+
+func newLapProfile(lap Lap, measures []GPSMeasurement) *lapProfile {
+	profile := &lapProfile{}
+	lapMeasures := MeasuresForLap(lap, measures)
+	distance := 0.0
+	for i, m := range lapMeasures {
+		if i > 0 {
+			distance += haversineDistance(lapMeasures[i-1].LatLng, m.LatLng)
+		}
+		last := len(profile.distanceMeters) - 1
+		if last >= 0 && distance-profile.distanceMeters[last] < reportProfileStepMeters && i != len(lapMeasures)-1 {
+			continue
+		}
+		profile.distanceMeters = append(profile.distanceMeters, distance)
+		profile.seconds = append(profile.seconds, m.RelativeTime-lapMeasures[0].RelativeTime)
+		profile.speedKph = append(profile.speedKph, m.SpeedKph)
+	}
+	return profile
+}
+
+// secondsAt interpolates the time it took to drive the given distance.
+func (p *lapProfile) secondsAt(distanceMeters float64) float64 {
+	i := sort.SearchFloat64s(p.distanceMeters, distanceMeters)
+	if i == 0 {
+		return p.seconds[0]
+	}
+	if i >= len(p.distanceMeters) {
+		return p.seconds[len(p.seconds)-1]
+	}
+	span := p.distanceMeters[i] - p.distanceMeters[i-1]
+	if span == 0 {
+		return p.seconds[i]
+	}
+	fraction := (distanceMeters - p.distanceMeters[i-1]) / span
+	return p.seconds[i-1] + fraction*(p.seconds[i]-p.seconds[i-1])
+}
+
+type reportProperty struct {
+	Name  string
+	Value string
+}
+
+type reportSessionRow struct {
+	File       string
+	Driver     string
+	Track      string
+	Start      string
+	Laps       string
+	FastestLap string
+}
+
+type reportLapRow struct {
+	Session      string
+	Number       string
+	Type         string
+	Time         string
+	Delta        string
+	Valid        string
+	Sectors      []string
+	Distance     string
+	TopSpeed     string
+	AverageSpeed string
+	MinSpeed     string
+	Color        string
+	Fastest      bool
+}
+
+type reportView struct {
+	Title      string
+	Generated  string
+	Properties []reportProperty
+	Sessions   []reportSessionRow
+	NumSectors []int
+	Laps       []reportLapRow
+	Map        template.HTML
+	MapImage   template.URL
+	SpeedChart template.HTML
+	DeltaChart template.HTML
+}
+
+// reportLap is a lap of the map and the charts together with the measurements of its session.
+type reportLap struct {
+	session  int
+	lap      Lap
+	measures []GPSMeasurement
+	profile  *lapProfile
+	color    string
+}
+
+// Report writes a single, self-contained html file with the laps, their statistics, a track map and speed charts.
+func Report(data *TrackData, config ReportConfig) error {
+	return SessionsReport([]*TrackData{data}, []string{config.InputFile}, config)
+}
+
+// SessionsReport writes the report of several sessions into a single html file, see WriteSessionsReport.
+func SessionsReport(sessions []*TrackData, inputFiles []string, config ReportConfig) error {
+	outputFile := config.OutputFile
+	if !strings.HasSuffix(strings.ToLower(outputFile), ".html") {
+		outputFile = outputFile + ".html"
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	if err := WriteSessionsReport(sessions, inputFiles, config, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved %s\n", outputFile)
+	return nil
+}
+
+// WriteReport renders the html report of the session into the writer. Unless MapTiles is set, it works without network
+// access since the map and the charts are drawn as inline svg.
+func WriteReport(data *TrackData, config ReportConfig, w io.Writer) error {
+	return WriteSessionsReport([]*TrackData{data}, []string{config.InputFile}, config, w)
+}
+
+// WriteSessionsReport renders the html report of the sessions of the input files into the writer. A single session is
+// reported like WriteReport, several get a table of the sessions and one lap table tagging every lap with its file,
+// the map and the charts then compare the fastest lap of each session.
+func WriteSessionsReport(sessions []*TrackData, inputFiles []string, config ReportConfig, w io.Writer) error {
+	multiSession := len(sessions) > 1
+	measures := make([][]GPSMeasurement, len(sessions))
+	var track *Track
+	var charted []*reportLap
+	for i, data := range sessions {
+		fileConfig := config.DataConfig
+		fileConfig.InputFile = inputFiles[i]
+		measures[i] = data.Measures(fileConfig)
+		if track == nil {
+			track = data.TrackInformation.Track
+		}
+		for _, lap := range reportChartedLaps(data.Laps, multiSession) {
+			charted = append(charted, &reportLap{session: i, lap: lap, measures: measures[i]})
+		}
+	}
+	sort.SliceStable(charted, func(i, j int) bool {
+		return charted[i].lap.Time < charted[j].lap.Time
+	})
+	for i, lap := range charted {
+		lap.profile = newLapProfile(lap.lap, lap.measures)
+		lap.color = reportPalette[i%len(reportPalette)]
+	}
+
+	view := &reportView{Generated: time.Now().Format(time.RFC1123)}
+	if multiSession {
+		view.Title = fmt.Sprintf("Report of %d Sessions", len(sessions))
+		view.Sessions = reportSessionRows(sessions, inputFiles)
+	} else {
+		view.Title = fmt.Sprintf("Session Report %s", filepath.Base(inputFiles[0]))
+		view.Properties = reportProperties(sessions[0], inputFiles[0])
+	}
+	for i, data := range sessions {
+		rows := reportLapRows(i, data.Laps, measures[i], charted)
+		if multiSession {
+			for j := range rows {
+				rows[j].Session = filepath.Base(inputFiles[i])
+			}
+		}
+		view.Laps = append(view.Laps, rows...)
+		for _, lap := range data.Laps {
+			for len(view.NumSectors) < len(lap.SectorTimes) {
+				view.NumSectors = append(view.NumSectors, len(view.NumSectors)+1)
+			}
+		}
+	}
+
+	if config.MapTiles {
+		image, err := renderTileMap(track, config, charted)
+		if err != nil {
+			return err
+		}
+		view.MapImage = template.URL("data:image/png;base64," + image)
+	} else {
+		view.Map = renderSVGMap(track, charted)
+	}
+
+	if len(charted) > 0 {
+		view.SpeedChart = renderSpeedChart(charted)
+		view.DeltaChart = renderDeltaChart(charted)
+	}
+
+	return reportTemplate.Execute(w, view)
+}
+
+// reportChartedLaps selects the laps of a session for the map and the charts. Only comparable laps are charted, unless
+// the session doesn't have any, and of several sessions only the fastest lap of each.
+func reportChartedLaps(laps []Lap, fastestOnly bool) []Lap {
+	if fastestOnly {
+		fastest, err := filterFastestLap(laps)
+		if err != nil {
+			return nil
+		}
+		return fastest
+	}
+	if charted := ValidFlyingLaps(laps); len(charted) > 0 {
+		return charted
+	}
+	return append([]Lap(nil), laps...)
+}
+
+func reportProperties(data *TrackData, inputFile string) []reportProperty {
+	properties := []reportProperty{{"File", filepath.Base(inputFile)}}
+	if track := data.TrackInformation.Track; track != nil {
+		properties = append(properties, reportProperty{"Track", track.Name})
+	}
+	if info := data.SessionInfo; info != nil {
+		if !info.StartTime.IsZero() {
+			properties = append(properties, reportProperty{"Session Start (UTC)", info.StartTime.Format(time.RFC3339)})
+		}
+		properties = append(properties,
+			reportProperty{"App", strings.TrimSpace(fmt.Sprintf("%s %s", info.App, info.AppVersion))},
+			reportProperty{"Device", strings.TrimSpace(fmt.Sprintf("%s %s", info.DeviceModel, info.OS))},
+			reportProperty{"GPS", strings.TrimSpace(fmt.Sprintf("%s %s", info.GPSSource, info.GPSMode))},
+		)
+	}
+	properties = append(properties, reportProperty{"Laps", fmt.Sprintf("%d", len(data.Laps))})
+	if best, err := filterFastestLap(ValidFlyingLaps(data.Laps)); err == nil {
+		properties = append(properties, reportProperty{"Fastest Lap", best[0].Time.String()})
+	}
+	return properties
+}
+
+func reportSessionRows(sessions []*TrackData, inputFiles []string) []reportSessionRow {
+	var rows []reportSessionRow
+	for i, data := range sessions {
+		row := reportSessionRow{
+			File:   filepath.Base(inputFiles[i]),
+			Driver: DriverName(inputFiles[i]),
+			Laps:   fmt.Sprintf("%d", len(data.Laps)),
+		}
+		if track := data.TrackInformation.Track; track != nil {
+			row.Track = track.Name
+		}
+		if info := data.SessionInfo; info != nil && !info.StartTime.IsZero() {
+			row.Start = info.StartTime.Format(time.RFC3339)
+		}
+		if best, err := filterFastestLap(ValidFlyingLaps(data.Laps)); err == nil {
+			row.FastestLap = best[0].Time.String()
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func reportLapRows(session int, laps []Lap, measures []GPSMeasurement, charted []*reportLap) []reportLapRow {
+	var fastest *reportLap
+	if len(charted) > 0 {
+		fastest = charted[0]
+	}
+	colors := map[int]string{}
+	for _, lap := range charted {
+		if lap.session == session {
+			colors[lap.lap.MeasureStartIndex] = lap.color
+		}
+	}
+
+	var rows []reportLapRow
+	for i, lap := range laps {
+		row := reportLapRow{
+			Number:   lapNumberFormat(i, lap),
+			Type:     lap.Type.String(),
+			Time:     lap.Time.String(),
+			Valid:    lapValidityFormat(lap),
+			Distance: fmt.Sprintf("%.0f m", lap.DistanceMeters),
+			TopSpeed: fmt.Sprintf("%.1f km/h", lap.TopSpeedKph),
+			Color:    colors[lap.MeasureStartIndex],
+		}
+		if lap.Time > 0 {
+			row.AverageSpeed = fmt.Sprintf("%.1f km/h", lap.DistanceMeters/lap.Time.Seconds()*3.6)
+		}
+		if lapMeasures := MeasuresForLap(lap, measures); len(lapMeasures) > 0 {
+			minSpeed := lapMeasures[0].SpeedKph
+			for _, m := range lapMeasures {
+				minSpeed = math.Min(minSpeed, m.SpeedKph)
+			}
+			row.MinSpeed = fmt.Sprintf("%.1f km/h", minSpeed)
+		}
+		if fastest != nil {
+			row.Fastest = fastest.session == session && lap.MeasureStartIndex == fastest.lap.MeasureStartIndex
+			if !row.Fastest {
+				row.Delta = fmt.Sprintf("%+.3fs", (lap.Time - fastest.lap.Time).Seconds())
+			}
+		}
+		for _, sector := range lap.SectorTimes {
+			row.Sectors = append(row.Sectors, sector.String())
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// renderTileMap draws the laps on OpenStreetMap tiles the same way Plot does and returns the base64 encoded png.
+func renderTileMap(track *Track, config ReportConfig, laps []*reportLap) (string, error) {
+	ctx := newPlotContext(PlotConfig{DataConfig: config.DataConfig, ImageWidth: reportMapSize, ImageHeight: reportMapSize}, "")
+	if track != nil {
+		addTrackGates(ctx, track)
+	}
+	for i, lap := range laps {
+		pathColor := Black
+		if i == 0 {
+			pathColor = Red
+		}
+		addLapPathToContext(lap.lap, lap.measures, ctx, pathColor)
+	}
+
+	img, err := ctx.Render()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// mapProjection maps coordinates to svg pixels with an equirectangular projection around the center of the session.
+type mapProjection struct {
+	origin LatLng
+	scale  float64
+	offset [2]float64
+}
+
+func (p *mapProjection) meters(latLng LatLng) (float64, float64) {
+	x := degreesToRadians(latLng.Lng-p.origin.Lng) * math.Cos(degreesToRadians(p.origin.Lat)) * EarthRadiusInMeters
+	y := degreesToRadians(latLng.Lat-p.origin.Lat) * EarthRadiusInMeters
+	return x, y
+}
+
+func (p *mapProjection) pixels(latLng LatLng) (float64, float64) {
+	x, y := p.meters(latLng)
+	return p.offset[0] + x*p.scale, p.offset[1] - y*p.scale
+}
+
+func newMapProjection(points []LatLng, size float64, margin float64) *mapProjection {
+	p := &mapProjection{origin: points[0]}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, point := range points {
+		x, y := p.meters(point)
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	extent := math.Max(math.Max(maxX-minX, maxY-minY), 1)
+	p.scale = (size - 2*margin) / extent
+	p.offset = [2]float64{
+		margin - minX*p.scale + ((size-2*margin)-(maxX-minX)*p.scale)/2,
+		margin + maxY*p.scale + ((size-2*margin)-(maxY-minY)*p.scale)/2,
+	}
+	return p
+}
+
+func renderSVGMap(track *Track, laps []*reportLap) template.HTML {
+	var points []LatLng
+	for _, lap := range laps {
+		for _, m := range MeasuresForLap(lap.lap, lap.measures) {
+			points = append(points, m.LatLng)
+		}
+	}
+	if len(points) == 0 {
+		return ""
+	}
+
+	projection := newMapProjection(points, reportMapSize, 20)
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		reportMapSize, reportMapSize, reportMapSize, reportMapSize)
+	svg.WriteString(`<rect width="100%" height="100%" fill="#f8f8f8"/>`)
+
+	// the slowest lap is drawn first, so the fastest one ends up on top
+	for i := len(laps) - 1; i >= 0; i-- {
+		width := 1.0
+		if i == 0 {
+			width = 2.5
+		}
+		fmt.Fprintf(&svg, `<polyline fill="none" stroke="%s" stroke-width="%.1f" stroke-opacity="0.8" points="`,
+			laps[i].color, width)
+		lapMeasures := MeasuresForLap(laps[i].lap, laps[i].measures)
+		for j, m := range lapMeasures {
+			if j > 0 && m.LatLng == lapMeasures[j-1].LatLng {
+				continue
+			}
+			x, y := projection.pixels(m.LatLng)
+			fmt.Fprintf(&svg, "%.1f,%.1f ", x, y)
+		}
+		svg.WriteString(`"/>`)
+	}
+
+	if track != nil {
+		gate := func(g Gate, color string, label string) {
+			ax, ay := projection.pixels(g.A)
+			bx, by := projection.pixels(g.B)
+			fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="3"/>`,
+				ax, ay, bx, by, color)
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" font-size="12">%s</text>`, bx+4, by, html.EscapeString(label))
+		}
+		gate(track.StartFinish, "#000", "S/F")
+		if track.Finish != nil {
+			gate(*track.Finish, "#000", "Finish")
+		}
+		for i, g := range track.Sectors {
+			gate(g, "#555", fmt.Sprintf("S%d", i+1))
+		}
+	}
+
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// svgChart draws line series into a chart with axes, x and y are in data units.
+type svgChart struct {
+	svg                    strings.Builder
+	xMin, xMax, yMin, yMax float64
+	left, top, right, bot  float64
+}
+
+func newSVGChart(xMax, yMin, yMax float64, xLabel, yLabel string) *svgChart {
+	c := &svgChart{xMax: math.Max(xMax, 1), yMin: yMin, yMax: math.Max(yMax, yMin+1), left: 60, top: 10, right: 10, bot: 40}
+	fmt.Fprintf(&c.svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		reportChartWidth, reportChartHeight, reportChartWidth, reportChartHeight)
+
+	for i := 0; i <= 5; i++ {
+		y := c.yMin + (c.yMax-c.yMin)*float64(i)/5
+		_, py := c.pixels(0, y)
+		fmt.Fprintf(&c.svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`, c.left, py, reportChartWidth-c.right, py)
+		fmt.Fprintf(&c.svg, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="end">%.1f</text>`, c.left-4, py+4, y)
+
+		x := c.xMax * float64(i) / 5
+		px, _ := c.pixels(x, 0)
+		fmt.Fprintf(&c.svg, `<text x="%.1f" y="%.1f" font-size="11" text-anchor="middle">%.0f</text>`,
+			px, reportChartHeight-c.bot+15, x)
+	}
+	fmt.Fprintf(&c.svg, `<text x="%.1f" y="%d" font-size="12" text-anchor="middle">%s</text>`,
+		c.left+(reportChartWidth-c.left-c.right)/2, reportChartHeight-5, html.EscapeString(xLabel))
+	fmt.Fprintf(&c.svg, `<text x="12" y="%.1f" font-size="12" text-anchor="middle" transform="rotate(-90 12 %.1f)">%s</text>`,
+		c.top+(reportChartHeight-c.top-c.bot)/2, c.top+(reportChartHeight-c.top-c.bot)/2, html.EscapeString(yLabel))
+	return c
+}
+
+func (c *svgChart) pixels(x, y float64) (float64, float64) {
+	width := reportChartWidth - c.left - c.right
+	height := reportChartHeight - c.top - c.bot
+	return c.left + (x-c.xMin)/(c.xMax-c.xMin)*width, c.top + (c.yMax-y)/(c.yMax-c.yMin)*height
+}
+
+func (c *svgChart) line(xs []float64, ys []float64, color string, width float64) {
+	fmt.Fprintf(&c.svg, `<polyline fill="none" stroke="%s" stroke-width="%.1f" points="`, color, width)
+	for i := range xs {
+		x, y := c.pixels(xs[i], math.Max(c.yMin, math.Min(c.yMax, ys[i])))
+		fmt.Fprintf(&c.svg, "%.1f,%.1f ", x, y)
+	}
+	c.svg.WriteString(`"/>`)
+}
+
+func (c *svgChart) html() template.HTML {
+	c.svg.WriteString(`</svg>`)
+	return template.HTML(c.svg.String())
+}
+
+func renderSpeedChart(laps []*reportLap) template.HTML {
+	maxDistance, maxSpeed := 0.0, 0.0
+	for _, lap := range laps {
+		profile := lap.profile
+		for i := range profile.distanceMeters {
+			maxDistance = math.Max(maxDistance, profile.distanceMeters[i])
+			maxSpeed = math.Max(maxSpeed, profile.speedKph[i])
+		}
+	}
+
+	chart := newSVGChart(maxDistance, 0, math.Ceil(maxSpeed/20)*20, "Distance (m)", "Speed (km/h)")
+	for i := len(laps) - 1; i >= 0; i-- {
+		profile := laps[i].profile
+		width := 1.0
+		if i == 0 {
+			width = 2.0
+		}
+		chart.line(profile.distanceMeters, profile.speedKph, laps[i].color, width)
+	}
+	return chart.html()
+}
+
+// renderDeltaChart compares every lap to the fastest one, showing how much time was lost or gained along the lap.
+func renderDeltaChart(laps []*reportLap) template.HTML {
+	fastest := laps[0].profile
+	fastestDistance := fastest.distanceMeters[len(fastest.distanceMeters)-1]
+
+	deltas := make([][]float64, len(laps))
+	distances := make([][]float64, len(laps))
+	maxDelta := 1.0
+	for j, lap := range laps[1:] {
+		profile := lap.profile
+		for i, d := range profile.distanceMeters {
+			if d > fastestDistance {
+				break
+			}
+			delta := profile.seconds[i] - fastest.secondsAt(d)
+			deltas[j+1] = append(deltas[j+1], delta)
+			distances[j+1] = append(distances[j+1], d)
+			maxDelta = math.Max(maxDelta, math.Abs(delta))
+		}
+	}
+	maxDelta = math.Ceil(maxDelta)
+
+	chart := newSVGChart(fastestDistance, -maxDelta, maxDelta, "Distance (m)", "Delta to fastest lap (s)")
+	chart.line([]float64{0, fastestDistance}, []float64{0, 0}, laps[0].color, 2.0)
+	for i := 1; i < len(laps); i++ {
+		chart.line(distances[i], deltas[i], laps[i].color, 1.0)
+	}
+	return chart.html()
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th { background: #eee; }
+td.left, th.left { text-align: left; }
+tr.fastest { font-weight: bold; background: #fff3f3; }
+.swatch { display: inline-block; width: 12px; height: 12px; margin-right: 4px; }
+footer { color: #888; font-size: small; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+
+{{if .Sessions}}<h2>Sessions</h2>
+<table>
+<tr><th class="left">File</th><th class="left">Driver</th><th class="left">Track</th><th class="left">Start (UTC)</th><th>Laps</th><th>Fastest Lap</th></tr>
+{{range .Sessions}}<tr><td class="left">{{.File}}</td><td class="left">{{.Driver}}</td><td class="left">{{.Track}}</td><td class="left">{{.Start}}</td><td>{{.Laps}}</td><td>{{.FastestLap}}</td></tr>
+{{end}}</table>
+{{else}}<h2>Session</h2>
+<table>
+{{range .Properties}}<tr><th class="left">{{.Name}}</th><td class="left">{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Laps</h2>
+<table>
+<tr>{{if .Sessions}}<th class="left">Session</th>{{end}}<th>Lap</th><th class="left">Type</th><th>Time</th><th>Delta</th><th class="left">Valid</th>{{range .NumSectors}}<th>S{{.}}</th>{{end}}<th>Distance</th><th>Top Speed</th><th>Avg Speed</th><th>Min Speed</th></tr>
+{{range .Laps}}{{$lap := .}}<tr{{if .Fastest}} class="fastest"{{end}}>
+{{if $.Sessions}}<td class="left">{{.Session}}</td>{{end}}<td>{{if .Color}}<span class="swatch" style="background: {{.Color}}"></span>{{end}}{{.Number}}</td><td class="left">{{.Type}}</td><td>{{.Time}}</td><td>{{.Delta}}</td><td class="left">{{.Valid}}</td>
+{{range $i, $s := $.NumSectors}}<td>{{if lt $i (len $lap.Sectors)}}{{index $lap.Sectors $i}}{{else}}-{{end}}</td>{{end}}
+<td>{{.Distance}}</td><td>{{.TopSpeed}}</td><td>{{.AverageSpeed}}</td><td>{{.MinSpeed}}</td>
+</tr>
+{{end}}</table>
+
+<h2>Track Map</h2>
+{{if .MapImage}}<img src="{{.MapImage}}" alt="track map">{{else}}{{.Map}}{{end}}
+
+{{if .SpeedChart}}
+<h2>Speed</h2>
+{{.SpeedChart}}
+
+<h2>Lap Comparison</h2>
+{{.DeltaChart}}
+{{end}}
+
+<footer>Generated by trackaddict-cli on {{.Generated}}</footer>
+</body>
+</html>
+`))
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriteSessionsReport(t *testing.T) {
+	inputFiles := []string{"../example/STC_log.csv", "../example/STC_log.csv"}
+	config := ReportConfig{DataConfig: DataConfig{RecalculateLaps: true}}
+	sessions, err := ReadAllData(context.Background(), config.DataConfig, inputFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sessions  []*TrackData
+		title     string
+		rows      int
+		polylines int
+	}{
+		// every valid lap is charted in the map, the speed and the delta chart
+		{"single session", sessions[:1], "Session Report STC_log.csv", len(sessions[0].Laps),
+			3 * len(ValidFlyingLaps(sessions[0].Laps))},
+		// only the fastest lap of each session is charted
+		{"several sessions", sessions, "Report of 2 Sessions", 2 * len(sessions[0].Laps), 3 * 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteSessionsReport(test.sessions, inputFiles[:len(test.sessions)], config, &buf); err != nil {
+				t.Fatal(err)
+			}
+			report := buf.String()
+			if !strings.Contains(report, "<h1>"+test.title+"</h1>") {
+				t.Errorf("expected the title %s", test.title)
+			}
+			if rows := strings.Count(report, "<tr class=\"fastest\">") + strings.Count(report, "<tr>\n"); rows != test.rows {
+				t.Errorf("expected %d lap rows, got %d", test.rows, rows)
+			}
+			if polylines := strings.Count(report, "<polyline"); polylines != test.polylines {
+				t.Errorf("expected %d polylines, got %d", test.polylines, polylines)
+			}
+			// a single session names its file in the properties, several tag every lap with its file and list the
+			// files in the sessions table
+			tagged := 1
+			if len(test.sessions) > 1 {
+				tagged = test.rows + len(test.sessions)
+			}
+			if cells := strings.Count(report, `<td class="left">STC_log.csv</td>`); cells != tagged {
+				t.Errorf("expected %d cells with the file, got %d", tagged, cells)
+			}
+		})
+	}
+}
+
+func TestOutputFilesForInputs(t *testing.T) {
+	tests := []struct {
+		outputFile string
+		inputFiles []string
+		expected   []string
+	}{
+		{"out.png", []string{"a/first.csv", "a/second.vbo"}, []string{"out_first.png", "out_second.png"}},
+		{"out", []string{"a/session.csv", "b/session.csv"}, []string{"out_a_session", "out_b_session"}},
+		{"dir/out.kml", []string{"a/session.csv", "b/other.csv"}, []string{"dir/out_session.kml", "dir/out_other.kml"}},
+	}
+	for _, test := range tests {
+		outputFiles := OutputFilesForInputs(test.outputFile, test.inputFiles)
+		if strings.Join(outputFiles, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%s %v: expected %v, got %v", test.outputFile, test.inputFiles, test.expected, outputFiles)
+		}
+	}
+}
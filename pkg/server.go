@@ -0,0 +1,576 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxUploadBytes limits the size of an uploaded session.
+const MaxUploadBytes = 1 << 30
+
+// ServerCacheSize is how many analysed sessions are kept in memory, the least recently used one is dropped first.
+const ServerCacheSize = 8
+
+// ServerConfig configures the http server, the DataConfig is the default for all requests, its InputFile is ignored.
+type ServerConfig struct {
+	DataConfig
+	Addr string
+	// DataDir keeps the uploaded sessions, they are loaded again when the server restarts.
+	DataDir string
+}
+
+// serverSession is an uploaded file, the analysed track data is cached per smoothing and lap recalculation.
+type serverSession struct {
+	ID         string    `json:"id"`
+	FileName   string    `json:"fileName"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	path       string
+}
+
+type serverCacheKey struct {
+	id              string
+	smooth, fixLaps bool
+}
+
+// Server analyses uploaded sessions and serves the results as json, images and a minimal web page.
+type Server struct {
+	config   ServerConfig
+	mutex    sync.Mutex
+	sessions map[string]*serverSession
+	cache    map[serverCacheKey]*TrackData
+	// cacheOrder has the keys of the cache, the least recently used first.
+	cacheOrder []serverCacheKey
+}
+
+type sessionResponse struct {
+	*serverSession
+	Track       string       `json:"track,omitempty"`
+	SessionInfo *SessionInfo `json:"sessionInfo,omitempty"`
+	NumLaps     int          `json:"numLaps"`
+	FastestLap  *float64     `json:"fastestLapSeconds,omitempty"`
+}
+
+type lapResponse struct {
+	Number            int       `json:"number"`
+	Type              string    `json:"type"`
+	TimeSeconds       float64   `json:"timeSeconds"`
+	Valid             bool      `json:"valid"`
+	InvalidReason     string    `json:"invalidReason,omitempty"`
+	SectorSeconds     []float64 `json:"sectorSeconds,omitempty"`
+	DistanceMeters    float64   `json:"distanceMeters"`
+	TopSpeedKph       float64   `json:"topSpeedKph"`
+	MeasureStartIndex int       `json:"measureStartIndex"`
+	MeasureEndIndex   int       `json:"measureEndIndexExclusive"`
+}
+
+type sectorsResponse struct {
+	Laps            []lapResponse `json:"laps"`
+	BestSectors     []float64     `json:"bestSectorSeconds"`
+	TheoreticalBest float64       `json:"theoreticalBestSeconds"`
+}
+
+type trackPointResponse struct {
+	Lat             float64 `json:"lat"`
+	Lng             float64 `json:"lng"`
+	RelativeSeconds float64 `json:"relativeSeconds"`
+	SpeedKph        float64 `json:"speedKph"`
+}
+
+// NewServer creates the server and loads the sessions that were uploaded before.
+func NewServer(config ServerConfig) (*Server, error) {
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Server{config: config, sessions: map[string]*serverSession{}, cache: map[serverCacheKey]*TrackData{}}
+
+	files, err := filepath.Glob(filepath.Join(config.DataDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		session := &serverSession{}
+		if err := json.Unmarshal(content, session); err != nil {
+			return nil, fmt.Errorf("can't parse uploaded session %s: %v", file, err)
+		}
+		session.path = strings.TrimSuffix(file, ".json") + ".csv"
+		s.sessions[session.ID] = session
+	}
+	return s, nil
+}
+
+// ListenAndServe serves until the context is cancelled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	server := &http.Server{Addr: s.config.Addr, Handler: s.Handler()}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// Handler returns the routes of the server:
+//
+//	GET  /                                  web page to upload and browse sessions
+//	GET  /api/sessions                      all sessions
+//	POST /api/sessions                      upload a session as multipart form field "file"
+//	GET  /api/sessions/{id}                 a session with its metadata
+//	GET  /api/sessions/{id}/laps            the classified laps
+//	GET  /api/sessions/{id}/sectors         the sector times and the theoretical best lap
+//	GET  /api/sessions/{id}/track?lap=N     the (smoothed) positions of the session or a single lap
+//	GET  /api/sessions/{id}/plot.png?lap=N  the plot of the session or a single lap
+//	GET  /api/sessions/{id}/report.html     the html report
+//
+// All session endpoints accept the query parameters smooth=true and fixLaps=true.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/sessions", s.handleSessions)
+	mux.HandleFunc("/api/sessions/", s.handleSession)
+	return mux
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, serverIndexHTML)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mutex.Lock()
+		var sessions []*serverSession
+		for _, session := range s.sessions {
+			sessions = append(sessions, session)
+		}
+		s.mutex.Unlock()
+
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].UploadedAt.After(sessions[j].UploadedAt)
+		})
+		if sessions == nil {
+			sessions = []*serverSession{}
+		}
+		writeJSON(w, sessions)
+	case http.MethodPost:
+		session, err := s.upload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Uploaded %s as session %s", session.FileName, session.ID)
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, session)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// upload stores the uploaded file under its sha1, uploading the same file twice returns the existing session.
+func (s *Server) upload(r *http.Request) (*serverSession, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, MaxUploadBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("expected the session as multipart form field 'file': %v", err)
+	}
+	defer file.Close()
+
+	tmp, err := ioutil.TempFile(s.config.DataDir, "upload-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), file); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	id := hex.EncodeToString(hash.Sum(nil))
+	s.mutex.Lock()
+	existing, ok := s.sessions[id]
+	s.mutex.Unlock()
+	if ok {
+		return existing, nil
+	}
+
+	session := &serverSession{
+		ID:         id,
+		FileName:   filepath.Base(header.Filename),
+		UploadedAt: time.Now().UTC(),
+		path:       filepath.Join(s.config.DataDir, id+".csv"),
+	}
+	// make sure the file can be analysed before it is kept
+	config := s.config.DataConfig
+	config.InputFile = tmp.Name()
+	data, err := ReadData(config)
+	if err != nil {
+		return nil, fmt.Errorf("can't analyse %s: %v", session.FileName, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.Rename(tmp.Name(), session.path); err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.config.DataDir, id+".json"), meta, 0644); err != nil {
+		return nil, err
+	}
+	s.sessions[id] = session
+	s.addToCache(serverCacheKey{id: id, smooth: config.UseSmoothedGPSData, fixLaps: config.RecalculateLaps}, data)
+	return session, nil
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), "/"), "/")
+	s.mutex.Lock()
+	session, ok := s.sessions[parts[0]]
+	s.mutex.Unlock()
+	if !ok || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	config := s.config.DataConfig
+	config.InputFile = session.path
+	config.UseSmoothedGPSData = queryBool(r, "smooth", config.UseSmoothedGPSData)
+	config.RecalculateLaps = queryBool(r, "fixLaps", config.RecalculateLaps)
+	data, err := s.trackData(session, config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resource := ""
+	if len(parts) == 2 {
+		resource = parts[1]
+	}
+	switch resource {
+	case "":
+		writeJSON(w, newSessionResponse(session, data))
+	case "laps":
+		writeJSON(w, newLapResponses(data.Laps))
+	case "sectors":
+		writeJSON(w, newSectorsResponse(data.Laps))
+	case "track":
+		laps, err := requestedLaps(r, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, newTrackResponse(laps, data.Measures(config)))
+	case "plot.png":
+		laps, err := requestedLaps(r, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		img, err := RenderPlot(data, PlotConfig{DataConfig: config, ImageWidth: 1000, ImageHeight: 1000}, laps)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_ = png.Encode(w, img)
+	case "report.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		reportConfig := ReportConfig{DataConfig: config}
+		reportConfig.InputFile = session.FileName
+		if err := WriteReport(data, reportConfig, w); err != nil {
+			log.Printf("Can't write the report of %s: %v", session.ID, err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) trackData(session *serverSession, config DataConfig) (*TrackData, error) {
+	key := serverCacheKey{id: session.ID, smooth: config.UseSmoothedGPSData, fixLaps: config.RecalculateLaps}
+	s.mutex.Lock()
+	data, ok := s.cache[key]
+	if ok {
+		s.touchCache(key)
+	}
+	s.mutex.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	data, err := ReadData(config)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	s.addToCache(key, data)
+	s.mutex.Unlock()
+	return data, nil
+}
+
+// addToCache keeps the track data and drops the least recently used ones beyond ServerCacheSize, the caller must hold
+// the mutex.
+func (s *Server) addToCache(key serverCacheKey, data *TrackData) {
+	if _, ok := s.cache[key]; ok {
+		s.touchCache(key)
+	} else {
+		s.cacheOrder = append(s.cacheOrder, key)
+	}
+	s.cache[key] = data
+	for len(s.cacheOrder) > ServerCacheSize {
+		delete(s.cache, s.cacheOrder[0])
+		s.cacheOrder = s.cacheOrder[1:]
+	}
+}
+
+// touchCache marks the key as the most recently used one, the caller must hold the mutex.
+func (s *Server) touchCache(key serverCacheKey) {
+	for i, k := range s.cacheOrder {
+		if k == key {
+			copy(s.cacheOrder[i:], s.cacheOrder[i+1:])
+			s.cacheOrder[len(s.cacheOrder)-1] = key
+			return
+		}
+	}
+}
+
+func queryBool(r *http.Request, name string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(r.URL.Query().Get(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// requestedLaps returns the lap of the "lap" query parameter or all laps without it.
+func requestedLaps(r *http.Request, data *TrackData) ([]Lap, error) {
+	lap := r.URL.Query().Get("lap")
+	if lap == "" {
+		return data.Laps, nil
+	}
+	i, err := strconv.Atoi(lap)
+	if err != nil || i < 0 || i >= len(data.Laps) {
+		return nil, fmt.Errorf("unknown lap %s, the session has %d laps", lap, len(data.Laps))
+	}
+	return data.Laps[i : i+1], nil
+}
+
+func newSessionResponse(session *serverSession, data *TrackData) sessionResponse {
+	response := sessionResponse{serverSession: session, SessionInfo: data.SessionInfo, NumLaps: len(data.Laps)}
+	if data.TrackInformation.Track != nil {
+		response.Track = data.TrackInformation.Track.Name
+	}
+	if best, err := filterFastestLap(ValidFlyingLaps(data.Laps)); err == nil {
+		fastest := best[0].Time.Seconds()
+		response.FastestLap = &fastest
+	}
+	return response
+}
+
+func newLapResponses(laps []Lap) []lapResponse {
+	responses := []lapResponse{}
+	for i, lap := range laps {
+		response := lapResponse{
+			Number:            i,
+			Type:              lap.Type.String(),
+			TimeSeconds:       lap.Time.Seconds(),
+			Valid:             lap.Valid,
+			InvalidReason:     lap.InvalidReason,
+			DistanceMeters:    lap.DistanceMeters,
+			TopSpeedKph:       lap.TopSpeedKph,
+			MeasureStartIndex: lap.MeasureStartIndex,
+			MeasureEndIndex:   lap.MeasureEndIndexExclusive,
+		}
+		for _, sector := range lap.SectorTimes {
+			response.SectorSeconds = append(response.SectorSeconds, sector.Seconds())
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func newSectorsResponse(laps []Lap) sectorsResponse {
+	response := sectorsResponse{Laps: newLapResponses(laps), BestSectors: []float64{}}
+	for _, lap := range laps {
+		for i, sector := range lap.SectorTimes {
+			if i >= len(response.BestSectors) {
+				response.BestSectors = append(response.BestSectors, sector.Seconds())
+			} else if sector.Seconds() < response.BestSectors[i] {
+				response.BestSectors[i] = sector.Seconds()
+			}
+		}
+	}
+	for _, best := range response.BestSectors {
+		response.TheoreticalBest += best
+	}
+	return response
+}
+
+// newTrackResponse only contains the GPS updates, the measurements in between repeat the last position.
+func newTrackResponse(laps []Lap, measures []GPSMeasurement) []trackPointResponse {
+	points := []trackPointResponse{}
+	for _, lap := range laps {
+		lapMeasures := MeasuresForLap(lap, measures)
+		for i, m := range lapMeasures {
+			if i > 0 && m.LatLng == lapMeasures[i-1].LatLng {
+				continue
+			}
+			points = append(points, trackPointResponse{Lat: m.LatLng.Lat, Lng: m.LatLng.Lng, RelativeSeconds: m.RelativeTime, SpeedKph: m.SpeedKph})
+		}
+	}
+	return points
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Can't write the response: %v", err)
+	}
+}
+
+const serverIndexHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>trackaddict-cli</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 1em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 6px 10px; text-align: left; }
+th { background: #eee; }
+tr.session { cursor: pointer; }
+tr.session:hover { background: #f4f4f4; }
+img { max-width: 100%; }
+button, input { font-size: 1em; padding: 6px; }
+</style>
+</head>
+<body>
+<h1>Sessions</h1>
+<form id="upload">
+<input type="file" name="file" accept=".csv,.vbo,.gz,.zst,.zip" required>
+<button type="submit">Upload</button>
+<span id="status"></span>
+</form>
+<p>
+<label><input type="checkbox" id="smooth"> Smooth GPS</label>
+<label><input type="checkbox" id="fixLaps"> Recalculate laps</label>
+</p>
+<table id="sessions"><tr><th>File</th><th>Uploaded</th></tr></table>
+<div id="details"></div>
+<script>
+function options() {
+  return 'smooth=' + document.getElementById('smooth').checked + '&fixLaps=' + document.getElementById('fixLaps').checked;
+}
+
+function text(value) {
+  var span = document.createElement('span');
+  span.textContent = value;
+  return span.innerHTML;
+}
+
+function loadSessions() {
+  fetch('api/sessions').then(function(r) { return r.json(); }).then(function(sessions) {
+    var rows = '<tr><th>File</th><th>Uploaded</th></tr>';
+    sessions.forEach(function(s) {
+      rows += '<tr class="session" data-id="' + s.id + '"><td>' + text(s.fileName) + '</td><td>' + text(s.uploadedAt) + '</td></tr>';
+    });
+    var table = document.getElementById('sessions');
+    table.innerHTML = rows;
+    table.querySelectorAll('tr.session').forEach(function(row) {
+      row.onclick = function() { showSession(row.dataset.id); };
+    });
+  });
+}
+
+function showSession(id) {
+  var base = 'api/sessions/' + id;
+  var details = document.getElementById('details');
+  details.textContent = 'Analysing...';
+  Promise.all([
+    fetch(base + '?' + options()).then(function(r) { return r.json(); }),
+    fetch(base + '/laps?' + options()).then(function(r) { return r.json(); })
+  ]).then(function(results) {
+    var session = results[0], laps = results[1];
+    var html = '<h2>' + text(session.fileName) + '</h2><p>Track: ' + text(session.track || 'unknown') +
+      ' &middot; <a href="' + base + '/report.html?' + options() + '" target="_blank">Report</a></p>';
+    html += '<table><tr><th>Lap</th><th>Type</th><th>Time (s)</th><th>Valid</th><th>Sectors (s)</th><th>Map</th></tr>';
+    laps.forEach(function(lap) {
+      html += '<tr><td>' + lap.number + '</td><td>' + text(lap.type) + '</td><td>' + lap.timeSeconds.toFixed(3) +
+        '</td><td>' + (lap.valid ? 'yes' : text(lap.invalidReason || '-')) + '</td><td>' +
+        (lap.sectorSeconds || []).map(function(s) { return s.toFixed(3); }).join(' ') +
+        '</td><td><a href="#" data-lap="' + lap.number + '">show</a></td></tr>';
+    });
+    html += '</table><img id="plot" alt="plot">';
+    details.innerHTML = html;
+    details.querySelectorAll('a[data-lap]').forEach(function(link) {
+      link.onclick = function(e) {
+        e.preventDefault();
+        document.getElementById('plot').src = base + '/plot.png?lap=' + link.dataset.lap + '&' + options();
+      };
+    });
+  }).catch(function(err) { details.textContent = err; });
+}
+
+document.getElementById('upload').onsubmit = function(e) {
+  e.preventDefault();
+  var status = document.getElementById('status');
+  status.textContent = 'Uploading...';
+  fetch('api/sessions', { method: 'POST', body: new FormData(e.target) }).then(function(r) {
+    if (!r.ok) { return r.text().then(function(t) { throw t; }); }
+    return r.json();
+  }).then(function(session) {
+    status.textContent = '';
+    loadSessions();
+    showSession(session.id);
+  }).catch(function(err) { status.textContent = err; });
+};
+
+loadSessions();
+</script>
+</body>
+</html>
+`
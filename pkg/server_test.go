@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func uploadRequest(t *testing.T, content string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "session.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/sessions", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestServerUpload(t *testing.T) {
+	valid := testTrackAddictHeader +
+		"0.000,1559734111.000,0,0,0,1,0.000,51.9993282,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n" +
+		"0.050,1559734111.050,0,0,0,1,0.000,51.9993283,13.6881679,91.2,299,12.5,90.0,5.0,0.10,-0.20,0.30,1,100.44,74.1\n"
+	tests := []struct {
+		name    string
+		content string
+		status  int
+		files   int
+	}{
+		{"valid", valid, http.StatusCreated, 2},
+		{"garbage value", testTrackAddictHeader +
+			"0.000,1559734111.000,0,0,0,1,0.000,abc,13.6881675,91.1,299,0.0,0.0,6.0,0.00,-0.00,-0.00,1,100.44,74.1\n",
+			http.StatusBadRequest, 0},
+		{"no measurements", testTrackAddictHeader, http.StatusBadRequest, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			server, err := NewServer(ServerConfig{DataDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, uploadRequest(t, test.content))
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			// the session and its metadata are kept, the temporary upload never is
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != test.files {
+				t.Errorf("expected %d files in the data dir, got %d", test.files, len(files))
+			}
+		})
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	s := &Server{cache: map[serverCacheKey]*TrackData{}}
+	key := func(i int) serverCacheKey {
+		return serverCacheKey{id: fmt.Sprintf("%d", i)}
+	}
+	for i := 0; i < ServerCacheSize; i++ {
+		s.addToCache(key(i), &TrackData{})
+	}
+	// using the oldest entry keeps it, so the second oldest is dropped
+	s.touchCache(key(0))
+	s.addToCache(key(ServerCacheSize), &TrackData{})
+
+	if len(s.cache) != ServerCacheSize || len(s.cacheOrder) != ServerCacheSize {
+		t.Fatalf("expected %d cached sessions, got %d", ServerCacheSize, len(s.cache))
+	}
+	if _, ok := s.cache[key(0)]; !ok {
+		t.Error("expected the recently used session to stay cached")
+	}
+	if _, ok := s.cache[key(1)]; ok {
+		t.Error("expected the least recently used session to be dropped")
+	}
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	raceRenderHeaderRegex = regexp.MustCompile(`^# RaceRender Data: (\S+) (\S+)(?: on ([^\[(]+))?(?:\[([^\]]+)\])?`)
+	gpsHeaderRegex        = regexp.MustCompile(`^# GPS: ([^;]*)(?:; Mode: (.*))?`)
+	freeSpaceHeaderRegex  = regexp.MustCompile(`^# Device Free Space: ([0-9]+) MB`)
+	userSettingRegex      = regexp.MustCompile(`^([A-Za-z]+)(.*)$`)
+)
+
+// SessionInfo is the metadata the logging app wrote about the device and the session.
+type SessionInfo struct {
+	App         string
+	AppVersion  string
+	OS          string
+	DeviceModel string
+	GPSSource   string
+	GPSMode     string
+	// UserSettings maps the abbreviated app setting (eg. "SL") to its value (eg. "1").
+	UserSettings      map[string]string
+	DeviceFreeSpaceMB int
+	// StartTime is the UTC timestamp of the first measurement.
+	StartTime time.Time
+	// Channels are the column names of the csv.
+	Channels []string
+	// HeaderComments are the comment lines before the column names, as the app wrote them.
+	HeaderComments []string
+}
+
+// SessionSummary describes a whole session without holding its measurements.
+type SessionSummary struct {
+	SessionInfo  *SessionInfo
+	TrackName    string
+	NumMeasures  int
+	NumGPSFixes  int
+	NumLaps      int
+	Duration     time.Duration
+	SampleRateHz float64
+}
+
+func newSessionInfo() *SessionInfo {
+	return &SessionInfo{UserSettings: map[string]string{}}
+}
+
+// parseHeaderLine fills the session info from a header comment or the column header, unknown lines are ignored.
+func (s *SessionInfo) parseHeaderLine(line string) {
+	if strings.HasPrefix(line, "#") {
+		s.HeaderComments = append(s.HeaderComments, line)
+	}
+	if matches := raceRenderHeaderRegex.FindStringSubmatch(line); matches != nil {
+		s.App = matches[1]
+		s.AppVersion = matches[2]
+		s.OS = strings.TrimSpace(matches[3])
+		s.DeviceModel = matches[4]
+	} else if matches := gpsHeaderRegex.FindStringSubmatch(line); matches != nil {
+		s.GPSSource = strings.TrimSpace(matches[1])
+		s.GPSMode = strings.TrimSpace(matches[2])
+	} else if strings.HasPrefix(line, "# User Settings:") {
+		for _, setting := range strings.Split(strings.TrimSpace(strings.TrimPrefix(line, "# User Settings:")), ";") {
+			if matches := userSettingRegex.FindStringSubmatch(setting); matches != nil {
+				s.UserSettings[matches[1]] = matches[2]
+			}
+		}
+	} else if matches := freeSpaceHeaderRegex.FindStringSubmatch(line); matches != nil {
+		s.DeviceFreeSpaceMB, _ = strconv.Atoi(matches[1])
+	} else if strings.HasPrefix(line, "\"") {
+		s.Channels = nil
+		for _, column := range strings.Split(line, ",") {
+			s.Channels = append(s.Channels, strings.Trim(column, "\""))
+		}
+	}
+}
+
+// SummarizeSession streams through the input file and collects its metadata and some basic statistics.
+func SummarizeSession(ctx context.Context, config DataConfig) (*SessionSummary, error) {
+	summary := &SessionSummary{}
+	var firstTime, lastTime float64
+	err := StreamData(ctx, config, StreamCallbacks{
+		SessionInfo: func(info *SessionInfo) error {
+			summary.SessionInfo = info
+			return nil
+		},
+		TrackInformation: func(info *TrackInformation) error {
+			if info.Track != nil {
+				summary.TrackName = info.Track.Name
+			}
+			return nil
+		},
+		Measurement: func(index int, measure GPSMeasurement) error {
+			if summary.NumMeasures == 0 {
+				firstTime = measure.RelativeTime
+			}
+			lastTime = measure.RelativeTime
+			summary.NumMeasures++
+			if measure.GPSUpdate {
+				summary.NumGPSFixes++
+			}
+			return nil
+		},
+		Lap: func(lap Lap) error {
+			summary.NumLaps++
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Duration = secondsToDuration(lastTime - firstTime)
+	if lastTime > firstTime {
+		summary.SampleRateHz = float64(summary.NumMeasures-1) / (lastTime - firstTime)
+	}
+	return summary, nil
+}
+
+func PrettyPrintSessionSummary(summary *SessionSummary) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Property", "Value"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	info := summary.SessionInfo
+	if info == nil {
+		info = newSessionInfo()
+	}
+
+	table.Append([]string{"App", strings.TrimSpace(fmt.Sprintf("%s %s", info.App, info.AppVersion))})
+	table.Append([]string{"OS", info.OS})
+	table.Append([]string{"Device", info.DeviceModel})
+	table.Append([]string{"GPS Source", info.GPSSource})
+	table.Append([]string{"GPS Mode", info.GPSMode})
+	table.Append([]string{"User Settings", formatUserSettings(info.UserSettings)})
+	table.Append([]string{"Device Free Space", fmt.Sprintf("%d MB", info.DeviceFreeSpaceMB)})
+	if !info.StartTime.IsZero() {
+		table.Append([]string{"Session Start (UTC)", info.StartTime.Format(time.RFC3339)})
+	}
+	table.Append([]string{"Track", summary.TrackName})
+	table.Append([]string{"Samples", fmt.Sprintf("%d", summary.NumMeasures)})
+	table.Append([]string{"GPS Fixes", fmt.Sprintf("%d", summary.NumGPSFixes)})
+	table.Append([]string{"Laps", fmt.Sprintf("%d", summary.NumLaps)})
+	table.Append([]string{"Duration", summary.Duration.String()})
+	table.Append([]string{"Sample Rate", fmt.Sprintf("%.2f Hz", summary.SampleRateHz)})
+	table.Append([]string{"Channels", strings.Join(info.Channels, ", ")})
+	table.Render()
+}
+
+func formatUserSettings(settings map[string]string) string {
+	var keys []string
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var formatted []string
+	for _, k := range keys {
+		formatted = append(formatted, k+"="+settings[k])
+	}
+	return strings.Join(formatted, " ")
+}
@@ -0,0 +1,332 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionLaps are the classified laps of one input file.
+type SessionLaps struct {
+	InputFile string
+	// Driver is the name of the directory of the input file, a track day is usually organized in a directory per car.
+	Driver           string
+	TrackInformation *TrackInformation
+	SessionInfo      *SessionInfo
+	Laps             []Lap
+	PitVisits        []PitVisit
+}
+
+// ExpandInputFiles resolves the given files, directories and glob patterns into the list of input files. Directories
+// are searched recursively for session files, StdinInputFile is kept as is.
+func ExpandInputFiles(inputs []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, input := range inputs {
+		if input == StdinInputFile {
+			add(input)
+			continue
+		}
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input pattern %s: %v", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input file matches %s", input)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() && isInputFile(path) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no session files found in %s", strings.Join(inputs, ", "))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// DriverName returns the name of the directory that contains the input file.
+func DriverName(inputFile string) string {
+	abs, err := filepath.Abs(inputFile)
+	if err != nil {
+		abs = inputFile
+	}
+	return filepath.Base(filepath.Dir(abs))
+}
+
+// ReadSessionLaps streams the input file of the config and returns its classified laps.
+func ReadSessionLaps(ctx context.Context, config DataConfig) (*SessionLaps, error) {
+	session := &SessionLaps{InputFile: config.InputFile, Driver: DriverName(config.InputFile)}
+	err := StreamData(ctx, config, StreamCallbacks{
+		TrackInformation: func(info *TrackInformation) error {
+			session.TrackInformation = info
+			return nil
+		},
+		SessionInfo: func(info *SessionInfo) error {
+			session.SessionInfo = info
+			return nil
+		},
+		Lap: func(lap Lap) error {
+			session.Laps = append(session.Laps, lap)
+			return nil
+		},
+		PitVisit: func(visit PitVisit) error {
+			session.PitVisits = append(session.PitVisits, visit)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", config.InputFile, err)
+	}
+
+	var track *Track
+	if session.TrackInformation != nil {
+		track = session.TrackInformation.Track
+	}
+	session.Laps = ClassifyLaps(session.Laps, session.PitVisits, track)
+	return session, nil
+}
+
+// ReadAllSessionLaps reads the laps of all input files concurrently, the config is used for every file. The sessions
+// are returned in the order of the input files.
+func ReadAllSessionLaps(ctx context.Context, config DataConfig, inputFiles []string) ([]*SessionLaps, error) {
+	sessions := make([]*SessionLaps, len(inputFiles))
+	err := forEachInputFile(ctx, inputFiles, func(ctx context.Context, i int, inputFile string) error {
+		fileConfig := config
+		fileConfig.InputFile = inputFile
+		session, err := ReadSessionLaps(ctx, fileConfig)
+		sessions[i] = session
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// SummarizeSessions summarizes all input files concurrently, in the order of the input files.
+func SummarizeSessions(ctx context.Context, config DataConfig, inputFiles []string) ([]*SessionSummary, error) {
+	summaries := make([]*SessionSummary, len(inputFiles))
+	err := forEachInputFile(ctx, inputFiles, func(ctx context.Context, i int, inputFile string) error {
+		fileConfig := config
+		fileConfig.InputFile = inputFile
+		summary, err := SummarizeSession(ctx, fileConfig)
+		if err != nil {
+			return fmt.Errorf("%s: %v", inputFile, err)
+		}
+		summaries[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// ForEachSessionData reads the input files concurrently with all their measurements and calls fn for each of them, the
+// config is used for every file. Only the sessions being processed are kept in memory.
+func ForEachSessionData(ctx context.Context, config DataConfig, inputFiles []string, fn func(i int, data *TrackData) error) error {
+	return forEachInputFile(ctx, inputFiles, func(ctx context.Context, i int, inputFile string) error {
+		fileConfig := config
+		fileConfig.InputFile = inputFile
+		data, err := ReadData(fileConfig)
+		if err == nil {
+			err = fn(i, data)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", inputFile, err)
+		}
+		return nil
+	})
+}
+
+// ReadAllData reads all input files concurrently with all their measurements, in the order of the input files.
+func ReadAllData(ctx context.Context, config DataConfig, inputFiles []string) ([]*TrackData, error) {
+	sessions := make([]*TrackData, len(inputFiles))
+	err := ForEachSessionData(ctx, config, inputFiles, func(i int, data *TrackData) error {
+		sessions[i] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// OutputFilesForInputs names the output of each of several input files by appending the name of the input file to the
+// output file, before its extension: out.png and a/session.csv become out_session.png. Files of the same name are told
+// apart by their driver, so b/session.csv then becomes out_b_session.png.
+func OutputFilesForInputs(outputFile string, inputFiles []string) []string {
+	names := make([]string, len(inputFiles))
+	count := map[string]int{}
+	for i, inputFile := range inputFiles {
+		names[i] = strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+		count[names[i]]++
+	}
+
+	ext := filepath.Ext(outputFile)
+	outputFiles := make([]string, len(inputFiles))
+	for i, inputFile := range inputFiles {
+		name := names[i]
+		if count[name] > 1 {
+			name = DriverName(inputFile) + "_" + name
+		}
+		outputFiles[i] = strings.TrimSuffix(outputFile, ext) + "_" + name + ext
+	}
+	return outputFiles
+}
+
+// forEachInputFile calls fn for every input file with one worker per CPU. The first error cancels the remaining files.
+func forEachInputFile(ctx context.Context, inputFiles []string, fn func(ctx context.Context, i int, inputFile string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	errs := make(chan error, len(inputFiles))
+	var wg sync.WaitGroup
+	for w := 0; w < Min(runtime.NumCPU(), len(inputFiles)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				if err := fn(ctx, i, inputFiles[i]); err != nil {
+					errs <- err
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := range inputFiles {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indices)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// PrettyPrintSessionsLaps prints the laps of all sessions in one table, every lap is tagged with its input file.
+func PrettyPrintSessionsLaps(sessions []*SessionLaps) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"File", "Lap Number", "Type", "Time (s)", "Valid", "Measure Range"})
+
+	for _, session := range sessions {
+		for i, v := range session.Laps {
+			table.Append([]string{
+				session.InputFile,
+				lapNumberFormat(i, v),
+				v.Type.String(),
+				v.Time.String(),
+				lapValidityFormat(v),
+				fmt.Sprintf("%d-%d", v.MeasureStartIndex, v.MeasureEndIndexExclusive),
+			})
+		}
+	}
+	table.Render()
+}
+
+// PrettyPrintBestLaps prints the best and average valid lap of every driver, followed by the fastest lap of all sessions.
+func PrettyPrintBestLaps(sessions []*SessionLaps) {
+	type driverStats struct {
+		best      Lap
+		bestFile  string
+		bestIndex int
+		numLaps   int
+		total     time.Duration
+	}
+
+	var drivers []string
+	stats := map[string]*driverStats{}
+	for _, session := range sessions {
+		for i, lap := range session.Laps {
+			if !lap.Valid {
+				continue
+			}
+			s, ok := stats[session.Driver]
+			if !ok {
+				s = &driverStats{}
+				stats[session.Driver] = s
+				drivers = append(drivers, session.Driver)
+			}
+			if s.numLaps == 0 || lap.Time < s.best.Time {
+				s.best = lap
+				s.bestFile = session.InputFile
+				s.bestIndex = i
+			}
+			s.numLaps++
+			s.total += lap.Time
+		}
+	}
+
+	if len(drivers) == 0 {
+		fmt.Println("No valid laps in any session")
+		return
+	}
+
+	// fastest driver first
+	sort.SliceStable(drivers, func(i, j int) bool {
+		return stats[drivers[i]].best.Time < stats[drivers[j]].best.Time
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Driver", "Best (s)", "Average (s)", "Valid Laps", "File", "Lap Number"})
+	for _, driver := range drivers {
+		s := stats[driver]
+		table.Append([]string{
+			driver,
+			s.best.Time.String(),
+			secondsToDuration(s.total.Seconds() / float64(s.numLaps)).String(),
+			fmt.Sprintf("%d", s.numLaps),
+			s.bestFile,
+			lapNumberFormat(s.bestIndex, s.best),
+		})
+	}
+	table.Render()
+
+	fastest := stats[drivers[0]]
+	fmt.Printf("Fastest lap: %s by %s (%s, lap %s)\n", fastest.best.Time.String(), drivers[0],
+		fastest.bestFile, lapNumberFormat(fastest.bestIndex, fastest.best))
+}
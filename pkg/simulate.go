@@ -0,0 +1,607 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	gravityMetersPerSecond2 = 9.81
+	// simulationStepMeters is the resolution of the resampled centreline.
+	simulationStepMeters = 2.0
+	// simulationGridMeters is how far before the start/finish gate the car stands at the beginning of the session.
+	simulationGridMeters = 50.0
+	// simulationGateHalfWidthMeters is half the width of the generated start/finish gate.
+	simulationGateHalfWidthMeters = 15.0
+)
+
+// SimulationConfig describes the session to generate, see DefaultSimulationConfig for sensible values.
+type SimulationConfig struct {
+	OutputFile string `json:"-"`
+	// Centerline of the track in driving order, the track is closed from the last back to the first point, which is
+	// also where the start/finish gate is placed. Defaults to DefaultSimulationCenterline.
+	Centerline []LatLng `json:"-"`
+	Laps       int      `json:"laps"`
+	Seed       int64    `json:"seed"`
+	// RateHz is how often a line is logged, GPSRateHz how often the GPS receiver delivers a fix.
+	RateHz    float64 `json:"rateHz"`
+	GPSRateHz float64 `json:"gpsRateHz"`
+	// the driver: the speed through a corner is limited by the lateral grip, between the corners by acceleration and braking
+	MaxSpeedKph      float64 `json:"maxSpeedKph"`
+	MaxLateralG      float64 `json:"maxLateralG"`
+	MaxBrakingG      float64 `json:"maxBrakingG"`
+	MaxAccelerationG float64 `json:"maxAccelerationG"`
+	// LapTimeVariation is the standard deviation of the driver's pace from lap to lap, as a fraction of the speed.
+	LapTimeVariation float64 `json:"lapTimeVariation"`
+	// the GPS receiver: the position error is correlated over time like for real receivers
+	GPSNoiseMeters             float64 `json:"gpsNoiseMeters"`
+	GPSNoiseCorrelationSeconds float64 `json:"gpsNoiseCorrelationSeconds"`
+	GPSLatencySeconds          float64 `json:"gpsLatencySeconds"`
+	// GPSDropoutProbability is the chance of every fix to start a dropout of GPSDropoutSeconds without any fix.
+	GPSDropoutProbability float64 `json:"gpsDropoutProbability"`
+	GPSDropoutSeconds     float64 `json:"gpsDropoutSeconds"`
+	AccelerometerNoiseG   float64 `json:"accelerometerNoiseG"`
+	// StandstillSeconds are spent standing before the start and after the end of the session.
+	StandstillSeconds float64 `json:"standstillSeconds"`
+}
+
+// DefaultSimulationConfig is a club racer with a phone in the car.
+func DefaultSimulationConfig() SimulationConfig {
+	return SimulationConfig{
+		Centerline:                 DefaultSimulationCenterline(),
+		Laps:                       5,
+		Seed:                       1,
+		RateHz:                     25,
+		GPSRateHz:                  10,
+		MaxSpeedKph:                180,
+		MaxLateralG:                1.1,
+		MaxBrakingG:                1.0,
+		MaxAccelerationG:           0.4,
+		LapTimeVariation:           0.01,
+		GPSNoiseMeters:             3,
+		GPSNoiseCorrelationSeconds: 5,
+		GPSLatencySeconds:          0.2,
+		GPSDropoutProbability:      0.002,
+		GPSDropoutSeconds:          2,
+		AccelerometerNoiseG:        0.05,
+		StandstillSeconds:          10,
+	}
+}
+
+// DefaultSimulationCenterline is a 1.8km circuit with two straights, a hairpin, a sweeper and a chicane, in an
+// area without any real track so it isn't matched to one of the track database.
+func DefaultSimulationCenterline() []LatLng {
+	projection := flatProjection{origin: LatLng{Lat: 47.0, Lng: -30.0}}
+	var points [][2]float64
+	line := func(x1, y1, x2, y2 float64) {
+		length := math.Hypot(x2-x1, y2-y1)
+		for d := 0.0; d < length; d += simulationStepMeters {
+			points = append(points, [2]float64{x1 + (x2-x1)*d/length, y1 + (y2-y1)*d/length})
+		}
+	}
+	arc := func(cx, cy, radius, from, to float64) {
+		steps := math.Abs(to-from) * radius / simulationStepMeters
+		for i := 0.0; i < steps; i++ {
+			angle := from + (to-from)*i/steps
+			points = append(points, [2]float64{cx + radius*math.Cos(angle), cy + radius*math.Sin(angle)})
+		}
+	}
+
+	// counterclockwise, x is east and y is north
+	line(100, 0, 600, 0)
+	arc(600, 80, 80, -math.Pi/2, 0)
+	line(680, 80, 680, 200)
+	arc(650, 200, 30, 0, math.Pi)
+	line(620, 200, 620, 150)
+	arc(560, 150, 60, 0, -math.Pi/2)
+	line(560, 90, 350, 90)
+	// chicane
+	arc(350, 120, 30, -math.Pi/2, -math.Pi)
+	arc(290, 120, 30, 0, math.Pi/2)
+	line(290, 150, 100, 150)
+	arc(100, 75, 75, math.Pi/2, 3*math.Pi/2)
+
+	centerline := make([]LatLng, len(points))
+	for i, p := range points {
+		centerline[i] = projection.toLatLng(p[0], p[1])
+	}
+	return centerline
+}
+
+// ReadCenterline reads a centreline from a text file with one "lat,lng" per line, lines starting with # are ignored.
+func ReadCenterline(file string) ([]LatLng, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var centerline []LatLng
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.Split(line, ",")
+		if len(split) < 2 {
+			return nil, fmt.Errorf("expected lat,lng in line %d of %s", i+1, file)
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(split[0]), 64)
+		lng, lngErr := strconv.ParseFloat(strings.TrimSpace(split[1]), 64)
+		if latErr != nil || lngErr != nil {
+			return nil, fmt.Errorf("expected lat,lng in line %d of %s", i+1, file)
+		}
+		centerline = append(centerline, LatLng{Lat: lat, Lng: lng})
+	}
+	return centerline, nil
+}
+
+// CenterlineFromSession uses the GPS fixes of the fastest lap of a recorded session as centreline.
+func CenterlineFromSession(data *TrackData) ([]LatLng, error) {
+	fastest, err := filterFastestLap(data.Laps)
+	if err != nil {
+		return nil, err
+	}
+	var centerline []LatLng
+	for _, m := range MeasuresForLap(fastest[0], data.GPSMeasurement) {
+		if m.GPSUpdate {
+			centerline = append(centerline, m.LatLng)
+		}
+	}
+	return centerline, nil
+}
+
+// SimulationTruth is what really happened in a simulated session.
+type SimulationTruth struct {
+	Seed         int64   `json:"seed"`
+	StartFinish  Gate    `json:"startFinish"`
+	LengthMeters float64 `json:"lengthMeters"`
+	// Laps refer to the measurements of the simulated csv, the first is the outlap and the last the inlap.
+	Laps []Lap `json:"laps"`
+	// PositionsFile has the true position of every measurement of the simulated csv.
+	PositionsFile string           `json:"positionsFile"`
+	Config        SimulationConfig `json:"config"`
+}
+
+// SimulationTruthFiles returns the files Simulate writes the truth to next to the simulated csv.
+func SimulationTruthFiles(outputFile string) (truthFile string, positionsFile string) {
+	base := strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	// the positions don't end in .csv, so they aren't mistaken for a session when analyzing a whole directory
+	return base + ".truth.json", base + ".truth.positions"
+}
+
+// ReadSimulationTruth reads the truth that was written by Simulate.
+func ReadSimulationTruth(truthFile string) (*SimulationTruth, error) {
+	content, err := ioutil.ReadFile(truthFile)
+	if err != nil {
+		return nil, err
+	}
+	truth := &SimulationTruth{}
+	if err := json.Unmarshal(content, truth); err != nil {
+		return nil, fmt.Errorf("can't read the simulation truth %s: %v", truthFile, err)
+	}
+	// the positions are next to the truth file, wherever both were moved to
+	truth.PositionsFile = filepath.Join(filepath.Dir(truthFile), truth.PositionsFile)
+	return truth, nil
+}
+
+// Simulate generates a TrackAddict csv of the configured session and writes the truth next to it, see
+// SimulationTruthFiles.
+func Simulate(config SimulationConfig) (*SimulationTruth, error) {
+	if config.Laps < 1 || config.RateHz <= 0 || config.GPSRateHz <= 0 || config.MaxSpeedKph <= 0 ||
+		config.MaxLateralG <= 0 || config.MaxBrakingG <= 0 || config.MaxAccelerationG <= 0 {
+		return nil, errors.New("the simulation needs at least one lap and positive rates, speeds and accelerations")
+	}
+	track, err := newSimulatedTrack(config.Centerline)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFile := config.OutputFile
+	if !strings.HasSuffix(strings.ToLower(outputFile), ".csv") {
+		outputFile = outputFile + ".csv"
+	}
+	truthFile, positionsFile := SimulationTruthFiles(outputFile)
+
+	csvFile, err := os.Create(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+	positions, err := os.Create(positionsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer positions.Close()
+
+	sim := &simulation{
+		config:    config,
+		track:     track,
+		random:    rand.New(rand.NewSource(config.Seed)),
+		csv:       bufio.NewWriter(csvFile),
+		positions: bufio.NewWriter(positions),
+	}
+	truth, err := sim.run()
+	if err != nil {
+		return nil, err
+	}
+	truth.PositionsFile = filepath.Base(positionsFile)
+	if err := sim.csv.Flush(); err != nil {
+		return nil, err
+	}
+	if err := sim.positions.Flush(); err != nil {
+		return nil, err
+	}
+
+	content, err := json.MarshalIndent(truth, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(truthFile, content, 0644); err != nil {
+		return nil, err
+	}
+	return truth, csvFile.Close()
+}
+
+// flatProjection maps coordinates around the origin to meters east (x) and north (y) of it.
+type flatProjection struct {
+	origin LatLng
+}
+
+func (p flatProjection) toXY(l LatLng) (float64, float64) {
+	x := degreesToRadians(l.Lng-p.origin.Lng) * math.Cos(degreesToRadians(p.origin.Lat)) * EarthRadiusInMeters
+	y := degreesToRadians(l.Lat-p.origin.Lat) * EarthRadiusInMeters
+	return x, y
+}
+
+func (p flatProjection) toLatLng(x float64, y float64) LatLng {
+	return LatLng{
+		Lat: p.origin.Lat + radiansToDegrees(y/EarthRadiusInMeters),
+		Lng: p.origin.Lng + radiansToDegrees(x/(EarthRadiusInMeters*math.Cos(degreesToRadians(p.origin.Lat)))),
+	}
+}
+
+// simulatedTrack is the centreline resampled every simulationStepMeters, smoothed so that the curvature is stable.
+type simulatedTrack struct {
+	projection   flatProjection
+	x, y         []float64
+	curvature    []float64
+	lengthMeters float64
+}
+
+func newSimulatedTrack(centerline []LatLng) (*simulatedTrack, error) {
+	if len(centerline) < 3 {
+		return nil, errors.New("the centreline needs at least three points")
+	}
+	projection := flatProjection{origin: centerline[0]}
+	var px, py []float64
+	for _, l := range centerline {
+		x, y := projection.toXY(l)
+		px = append(px, x)
+		py = append(py, y)
+	}
+	// close the loop
+	px = append(px, px[0])
+	py = append(py, py[0])
+
+	track := &simulatedTrack{projection: projection}
+	carry := 0.0
+	for i := 1; i < len(px); i++ {
+		length := math.Hypot(px[i]-px[i-1], py[i]-py[i-1])
+		for d := carry; d < length; d += simulationStepMeters {
+			track.x = append(track.x, px[i-1]+(px[i]-px[i-1])*d/length)
+			track.y = append(track.y, py[i-1]+(py[i]-py[i-1])*d/length)
+		}
+		carry = math.Mod(carry-length, simulationStepMeters)
+		if carry < 0 {
+			carry += simulationStepMeters
+		}
+	}
+	n := len(track.x)
+	if n < 20 {
+		return nil, errors.New("the centreline is too short for a track")
+	}
+
+	// a moving average over 10m takes out the noise of centrelines from recorded sessions
+	for pass := 0; pass < 3; pass++ {
+		x, y := make([]float64, n), make([]float64, n)
+		for i := 0; i < n; i++ {
+			for k := -2; k <= 2; k++ {
+				x[i] += track.x[(i+k+n)%n] / 5
+				y[i] += track.y[(i+k+n)%n] / 5
+			}
+		}
+		track.x, track.y = x, y
+	}
+
+	track.curvature = make([]float64, n)
+	for i := 0; i < n; i++ {
+		track.curvature[i] = circleCurvature(
+			track.x[(i-5+n)%n], track.y[(i-5+n)%n], track.x[i], track.y[i], track.x[(i+5)%n], track.y[(i+5)%n])
+	}
+	track.lengthMeters = float64(n) * simulationStepMeters
+	return track, nil
+}
+
+// circleCurvature is one over the radius of the circle through the three points.
+func circleCurvature(ax, ay, bx, by, cx, cy float64) float64 {
+	cross := (bx-ax)*(cy-ay) - (by-ay)*(cx-ax)
+	product := math.Hypot(bx-ax, by-ay) * math.Hypot(cx-bx, cy-by) * math.Hypot(cx-ax, cy-ay)
+	if product == 0 {
+		return 0
+	}
+	return math.Abs(2 * cross / product)
+}
+
+// at returns the position and heading in degrees at the given distance from the start/finish gate.
+func (t *simulatedTrack) at(distance float64) (float64, float64, float64) {
+	n := len(t.x)
+	distance = math.Mod(distance, t.lengthMeters)
+	if distance < 0 {
+		distance += t.lengthMeters
+	}
+	i := int(distance / simulationStepMeters)
+	f := distance/simulationStepMeters - float64(i)
+	a, b := i%n, (i+1)%n
+	dx, dy := t.x[b]-t.x[a], t.y[b]-t.y[a]
+	heading := math.Mod(radiansToDegrees(math.Atan2(dx, dy))+360, 360)
+	return t.x[a] + dx*f, t.y[a] + dy*f, heading
+}
+
+// speedProfile returns the speed in m/s the driver aims for at every point of the track.
+func (t *simulatedTrack) speedProfile(config SimulationConfig, pace float64) []float64 {
+	n := len(t.curvature)
+	speed := make([]float64, n)
+	for i, curvature := range t.curvature {
+		speed[i] = config.MaxSpeedKph / 3.6
+		if curvature > 0 {
+			speed[i] = math.Min(speed[i], math.Sqrt(config.MaxLateralG*gravityMetersPerSecond2/curvature))
+		}
+		speed[i] *= pace
+	}
+
+	// twice around, so the limits carry over the start/finish gate
+	acceleration := config.MaxAccelerationG * gravityMetersPerSecond2
+	braking := config.MaxBrakingG * gravityMetersPerSecond2
+	for i := 0; i < 2*n; i++ {
+		from, to := i%n, (i+1)%n
+		speed[to] = math.Min(speed[to], math.Sqrt(speed[from]*speed[from]+2*acceleration*simulationStepMeters))
+	}
+	for i := 2 * n; i > 0; i-- {
+		from, to := i%n, (i-1)%n
+		speed[to] = math.Min(speed[to], math.Sqrt(speed[from]*speed[from]+2*braking*simulationStepMeters))
+	}
+	return speed
+}
+
+// simulatedState is the true state of the car at a point in time.
+type simulatedState struct {
+	seconds       float64
+	x, y          float64
+	speed         float64
+	heading       float64
+	distance      float64
+	velocityNorth float64
+	velocityEast  float64
+}
+
+type simulation struct {
+	config    SimulationConfig
+	track     *simulatedTrack
+	random    *rand.Rand
+	csv       *bufio.Writer
+	positions *bufio.Writer
+
+	// history of the true states for the GPS latency
+	history    []simulatedState
+	fix        GPSMeasurement
+	nextFix    float64
+	dropoutEnd float64
+	noiseX     float64
+	noiseY     float64
+}
+
+func (s *simulation) run() (*SimulationTruth, error) {
+	config := s.config
+	dt := 1 / config.RateHz
+	acceleration := config.MaxAccelerationG * gravityMetersPerSecond2
+	braking := config.MaxBrakingG * gravityMetersPerSecond2
+
+	x0, y0, heading0 := s.track.at(0)
+	gate := Gate{
+		A: s.track.projection.toLatLng(x0-simulationGateHalfWidthMeters*math.Cos(degreesToRadians(heading0)),
+			y0+simulationGateHalfWidthMeters*math.Sin(degreesToRadians(heading0))),
+		B: s.track.projection.toLatLng(x0+simulationGateHalfWidthMeters*math.Cos(degreesToRadians(heading0)),
+			y0-simulationGateHalfWidthMeters*math.Sin(degreesToRadians(heading0))),
+		Heading: &heading0,
+	}
+	start := s.track.projection.toLatLng(x0, y0)
+	truth := &SimulationTruth{Seed: config.Seed, StartFinish: gate, LengthMeters: s.track.lengthMeters, Config: config}
+
+	if err := s.writeHeader(start); err != nil {
+		return nil, err
+	}
+
+	profile := s.track.speedProfile(config, s.pace())
+	distance := s.track.lengthMeters - simulationGridMeters
+	speed := 0.0
+	crossings := 0
+	lap := lapInProgress{}
+	lapStart := 0.0
+	stopped := -1.0
+	var previous *simulatedState
+	for index := 0; ; index++ {
+		seconds := float64(index) * dt
+		x, y, heading := s.track.at(distance)
+		state := simulatedState{
+			seconds:       seconds,
+			x:             x,
+			y:             y,
+			speed:         speed,
+			heading:       heading,
+			distance:      distance,
+			velocityNorth: speed * math.Cos(degreesToRadians(heading)),
+			velocityEast:  speed * math.Sin(degreesToRadians(heading)),
+		}
+		if previous == nil {
+			previous = &state
+		}
+		measure := s.measure(state, *previous, crossings)
+		if err := s.writeMeasure(measure, state); err != nil {
+			return nil, err
+		}
+		lap.add(index, GPSMeasurement{RelativeTime: seconds, SpeedKph: speed * 3.6, LatLng: s.track.projection.toLatLng(x, y)})
+		previous = &state
+
+		// the session ends after standing still at the end again
+		if stopped >= 0 && seconds-stopped >= config.StandstillSeconds {
+			inLap := lap.toLap(lapStart, seconds)
+			inLap.Type = InLap
+			truth.Laps = append(truth.Laps, inLap)
+			break
+		}
+
+		// move the car to the next measurement
+		switch {
+		case seconds < config.StandstillSeconds:
+		case crossings > config.Laps:
+			speed = math.Max(0, speed-braking*dt)
+			if speed == 0 && stopped < 0 {
+				stopped = seconds
+			}
+		default:
+			target := profile[int(distance/simulationStepMeters)%len(profile)]
+			if speed < target {
+				speed = math.Min(target, speed+acceleration*dt)
+			} else {
+				speed = math.Max(target, speed-braking*dt)
+			}
+		}
+
+		next := distance + speed*dt
+		if next >= s.track.lengthMeters {
+			crossing := seconds + (s.track.lengthMeters-distance)/(speed*dt)*dt
+			completed := lap.toLap(lapStart, crossing)
+			completed.Type = FlyingLap
+			completed.Valid = true
+			if crossings == 0 {
+				completed.Type = OutLap
+				completed.Valid = false
+			}
+			truth.Laps = append(truth.Laps, completed)
+			if err := s.writeLapAnnotation(crossings, completed); err != nil {
+				return nil, err
+			}
+
+			crossings++
+			lap = lapInProgress{}
+			lapStart = crossing
+			next -= s.track.lengthMeters
+			profile = s.track.speedProfile(config, s.pace())
+		}
+		distance = next
+	}
+
+	_, err := s.csv.WriteString("# Session End\n")
+	return truth, err
+}
+
+// pace is the fraction of the possible speed the driver manages in a lap.
+func (s *simulation) pace() float64 {
+	return math.Min(1, 1-math.Abs(s.random.NormFloat64()*s.config.LapTimeVariation))
+}
+
+// measure creates the logged measurement of the state, the GPS values only change with a new fix.
+func (s *simulation) measure(state simulatedState, previous simulatedState, lap int) GPSMeasurement {
+	config := s.config
+	s.history = append(s.history, state)
+	for len(s.history) > 1 && s.history[1].seconds <= state.seconds-config.GPSLatencySeconds {
+		s.history = s.history[1:]
+	}
+
+	gpsUpdate := false
+	if state.seconds >= s.nextFix {
+		interval := 1 / config.GPSRateHz
+		s.nextFix += interval
+		if state.seconds >= s.dropoutEnd && s.random.Float64() < config.GPSDropoutProbability {
+			s.dropoutEnd = state.seconds + config.GPSDropoutSeconds
+		}
+		if state.seconds >= s.dropoutEnd || state.seconds == 0 {
+			gpsUpdate = true
+			correlation := math.Exp(-interval / math.Max(config.GPSNoiseCorrelationSeconds, interval))
+			innovation := math.Sqrt(1-correlation*correlation) * config.GPSNoiseMeters
+			if state.seconds == 0 {
+				correlation, innovation = 0, config.GPSNoiseMeters
+			}
+			s.noiseX = correlation*s.noiseX + innovation*s.random.NormFloat64()
+			s.noiseY = correlation*s.noiseY + innovation*s.random.NormFloat64()
+
+			delayed := s.history[0]
+			s.fix = GPSMeasurement{
+				LatLng:         s.track.projection.toLatLng(delayed.x+s.noiseX, delayed.y+s.noiseY),
+				AltitudeMeters: 100,
+				SpeedKph:       math.Max(0, delayed.speed*3.6+s.random.NormFloat64()*0.5),
+				HeadingDegrees: delayed.heading,
+				AccuracyMeters: math.Round(config.GPSNoiseMeters*(1+0.25*math.Abs(s.random.NormFloat64()))*10) / 10,
+			}
+		}
+	}
+
+	measure := s.fix
+	measure.RelativeTime = state.seconds
+	measure.UTCTimestamp = simulationStartTimestamp + state.seconds
+	measure.GPSUpdate = gpsUpdate
+	measure.TrackAddictLap = lap
+	// the phone is assumed to lie north-aligned in the car, so X is north and Y east like the smoothing reads them
+	dt := state.seconds - previous.seconds
+	if dt > 0 {
+		measure.Acceleration.X = (state.velocityNorth-previous.velocityNorth)/dt/gravityMetersPerSecond2 +
+			s.random.NormFloat64()*config.AccelerometerNoiseG
+		measure.Acceleration.Y = (state.velocityEast-previous.velocityEast)/dt/gravityMetersPerSecond2 +
+			s.random.NormFloat64()*config.AccelerometerNoiseG
+	}
+	measure.Acceleration.Z = s.random.NormFloat64() * config.AccelerometerNoiseG
+	return measure
+}
+
+// simulationStartTimestamp is the unix time of every simulated session, 2020-01-01 12:00 UTC.
+const simulationStartTimestamp = 1577880000.0
+
+func (s *simulation) writeHeader(start LatLng) error {
+	lines := []string{
+		fmt.Sprintf("# RaceRender Data: trackaddict-cli simulate on Simulation [seed %d]", s.config.Seed),
+		fmt.Sprintf("# GPS: Simulated; Mode: %g Hz", s.config.GPSRateHz),
+	}
+	lines = append(lines, trackAddictHeader(&TrackInformation{StartLatLng: &start})...)
+	if err := writeReplayLines(s.csv, lines); err != nil {
+		return err
+	}
+	_, err := s.positions.WriteString(`"Time","Latitude","Longitude","Speed (Km/h)","Distance (m)"` + "\n")
+	return err
+}
+
+func (s *simulation) writeMeasure(measure GPSMeasurement, state simulatedState) error {
+	if _, err := s.csv.WriteString(formatTrackAddictLine(measure) + "\n"); err != nil {
+		return err
+	}
+	position := s.track.projection.toLatLng(state.x, state.y)
+	_, err := fmt.Fprintf(s.positions, "%.3f,%.8f,%.8f,%.2f,%.2f\n",
+		state.seconds, position.Lat, position.Lng, state.speed*3.6, state.distance)
+	return err
+}
+
+// writeLapAnnotation writes the "# Lap N: 00:01:48.011" line like the app does at the end of every lap.
+func (s *simulation) writeLapAnnotation(number int, lap Lap) error {
+	seconds := lap.Time.Seconds()
+	hours := int(seconds / 3600)
+	minutes := int(seconds/60) % 60
+	_, err := fmt.Fprintf(s.csv, "# Lap %d: %02d:%02d:%06.3f\n", number, hours, minutes, math.Mod(seconds, 60))
+	return err
+}
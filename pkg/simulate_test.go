@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimulatedLapDetection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := DefaultSimulationConfig()
+	config.Laps = 3
+	config.OutputFile = filepath.Join(dir, "session.csv")
+	truth, err := Simulate(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(truth.Laps) != config.Laps+2 {
+		t.Fatalf("expected %d laps with the outlap and inlap, got %d", config.Laps+2, len(truth.Laps))
+	}
+
+	evaluation, err := Evaluate(EvaluationConfig{DataConfig: DataConfig{InputFile: config.OutputFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the gate interpolates between GPS fixes that are up to 3m off, the laps written by the simulation are exact
+	tolerances := map[string]float64{"trackaddict": 0.01, "gate": 0.3}
+	checked := 0
+	for _, detector := range evaluation.Detectors {
+		tolerance, ok := tolerances[detector.Detector]
+		if !ok || detector.Smoother != "none" {
+			continue
+		}
+		checked++
+		if detector.Missed != 0 || detector.Extra != 0 {
+			t.Errorf("%s: expected all laps, missed %d and got %d extra", detector.Detector, detector.Missed, detector.Extra)
+		}
+		if max := detector.MaxAbsoluteErrorSeconds(); !(max <= tolerance) {
+			t.Errorf("%s: expected the lap times within %.2fs, the worst is off by %.3fs", detector.Detector, tolerance, max)
+		}
+	}
+	if checked != len(tolerances) {
+		t.Errorf("expected %d detectors to be evaluated, got %d", len(tolerances), checked)
+	}
+}
+
+func TestEvaluateAnnotatedSession(t *testing.T) {
+	evaluation, err := Evaluate(EvaluationConfig{DataConfig: DataConfig{InputFile: "../example/STC_log.csv"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evaluation.TruthLaps) == 0 {
+		t.Fatalf("expected the lap annotations as truth")
+	}
+
+	// TrackAddict's laps are timed by the annotations, so only the recalculated ones are compared against them
+	detectors := map[string]bool{}
+	for _, detector := range evaluation.Detectors {
+		detectors[detector.Detector] = true
+	}
+	if detectors["trackaddict"] || !detectors["gate"] || !detectors["threshold"] {
+		t.Errorf("expected the gate and threshold detectors without trackaddict, got %v", detectors)
+	}
+}
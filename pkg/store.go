@@ -0,0 +1,289 @@
+package pkg
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnknownTrackName is stored for sessions that couldn't be matched to a track.
+const UnknownTrackName = "Unknown"
+
+// StoredSession is a session as it is kept in the session store, it keeps the laps but not the measurements.
+type StoredSession struct {
+	// ID is the sha1 of the input file, importing the same file again replaces the stored session.
+	ID          string       `json:"id"`
+	SourceFile  string       `json:"sourceFile"`
+	ImportedAt  time.Time    `json:"importedAt"`
+	StartTime   time.Time    `json:"startTime"`
+	Track       string       `json:"track"`
+	Driver      string       `json:"driver"`
+	SessionInfo *SessionInfo `json:"sessionInfo,omitempty"`
+	Laps        []Lap        `json:"laps"`
+}
+
+// BestLap returns the fastest valid lap of the session and false if there is none.
+func (s *StoredSession) BestLap() (Lap, bool) {
+	valid := ValidFlyingLaps(s.Laps)
+	if len(valid) == 0 {
+		return Lap{}, false
+	}
+	best := valid[0]
+	for _, lap := range valid {
+		if lap.Time < best.Time {
+			best = lap
+		}
+	}
+	return best, true
+}
+
+// SessionFilter selects stored sessions, empty fields match every session.
+type SessionFilter struct {
+	Track  string
+	Driver string
+}
+
+func (f SessionFilter) matches(session *StoredSession) bool {
+	return (f.Track == "" || strings.EqualFold(f.Track, session.Track)) &&
+		(f.Driver == "" || strings.EqualFold(f.Driver, session.Driver))
+}
+
+// SessionStore keeps every imported session as a json file in a directory, so no database server is needed.
+type SessionStore struct {
+	dir string
+}
+
+// DefaultSessionStoreDir is the directory of the session store that is used if none is configured.
+func DefaultSessionStoreDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".trackaddict-cli", "sessions")
+}
+
+// OpenSessionStore opens the store in the given directory and creates the directory if it doesn't exist yet.
+func OpenSessionStore(dir string) (*SessionStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no session store directory configured")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &SessionStore{dir: dir}, nil
+}
+
+// NewStoredSession creates the session to store from the laps of an input file.
+func NewStoredSession(session *SessionLaps) (*StoredSession, error) {
+	id, err := fileID(session.InputFile)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StoredSession{
+		ID:          id,
+		SourceFile:  session.InputFile,
+		ImportedAt:  time.Now().UTC(),
+		Track:       UnknownTrackName,
+		Driver:      session.Driver,
+		SessionInfo: session.SessionInfo,
+		Laps:        session.Laps,
+	}
+	if session.SessionInfo != nil {
+		stored.StartTime = session.SessionInfo.StartTime
+	}
+	if session.TrackInformation != nil && session.TrackInformation.Track != nil {
+		stored.Track = session.TrackInformation.Track.Name
+	}
+	return stored, nil
+}
+
+func fileID(file string) (string, error) {
+	raw, size, closer, err := openRawInput(file)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(raw, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Import stores the session and returns true if it replaced an earlier import of the same file.
+func (s *SessionStore) Import(session *StoredSession) (bool, error) {
+	path := filepath.Join(s.dir, session.ID+".json")
+	_, err := os.Stat(path)
+	replaced := err == nil
+
+	content, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	// write to a temporary file first, so an interrupted import never leaves a broken session behind
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return false, err
+	}
+	return replaced, os.Rename(tmp, path)
+}
+
+// Sessions returns all stored sessions matching the filter, the oldest session first.
+func (s *SessionStore) Sessions(filter SessionFilter) ([]*StoredSession, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*StoredSession
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		session := &StoredSession{}
+		if err := json.Unmarshal(content, session); err != nil {
+			return nil, fmt.Errorf("can't parse stored session %s: %v", file, err)
+		}
+		if filter.matches(session) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.Before(sessions[j].StartTime)
+	})
+	return sessions, nil
+}
+
+// PrettyPrintHistory prints the stored sessions in chronological order together with the progression of the personal
+// best per track and driver.
+func PrettyPrintHistory(sessions []*StoredSession) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Date", "Track", "Driver", "Best (s)", "Average (s)", "Valid Laps", "Personal Best (s)", "Delta"})
+
+	personalBests := map[string]time.Duration{}
+	for _, session := range sessions {
+		row := []string{formatSessionDate(session), session.Track, session.Driver}
+		best, ok := session.BestLap()
+		if !ok {
+			table.Append(append(row, "-", "-", "0", "-", ""))
+			continue
+		}
+
+		valid := ValidFlyingLaps(session.Laps)
+		var total time.Duration
+		for _, lap := range valid {
+			total += lap.Time
+		}
+
+		key := strings.ToLower(session.Track + "\x00" + session.Driver)
+		delta := ""
+		if previous, seen := personalBests[key]; !seen {
+			personalBests[key] = best.Time
+		} else if best.Time < previous {
+			delta = (best.Time - previous).String()
+			personalBests[key] = best.Time
+		} else {
+			delta = "+" + (best.Time - previous).String()
+		}
+
+		table.Append(append(row,
+			best.Time.String(),
+			secondsToDuration(total.Seconds()/float64(len(valid))).String(),
+			fmt.Sprintf("%d", len(valid)),
+			personalBests[key].String(),
+			delta,
+		))
+	}
+	table.Render()
+}
+
+// PrettyPrintPersonalBests prints the best lap and the best sectors of every track and driver.
+func PrettyPrintPersonalBests(sessions []*StoredSession) {
+	type personalBest struct {
+		track, driver string
+		session       *StoredSession
+		lap           Lap
+		bestSectors   []time.Duration
+		numSessions   int
+	}
+
+	var keys []string
+	bests := map[string]*personalBest{}
+	for _, session := range sessions {
+		key := strings.ToLower(session.Track + "\x00" + session.Driver)
+		pb, ok := bests[key]
+		if !ok {
+			pb = &personalBest{track: session.Track, driver: session.Driver}
+			bests[key] = pb
+			keys = append(keys, key)
+		}
+		pb.numSessions++
+
+		for _, lap := range ValidFlyingLaps(session.Laps) {
+			if pb.session == nil || lap.Time < pb.lap.Time {
+				pb.session = session
+				pb.lap = lap
+			}
+			for s, sector := range lap.SectorTimes {
+				if s >= len(pb.bestSectors) {
+					pb.bestSectors = append(pb.bestSectors, sector)
+				} else if sector < pb.bestSectors[s] {
+					pb.bestSectors[s] = sector
+				}
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Track", "Driver", "Personal Best (s)", "Date", "Best Sectors", "Theoretical Best (s)", "Sessions"})
+	for _, key := range keys {
+		pb := bests[key]
+		if pb.session == nil {
+			table.Append([]string{pb.track, pb.driver, "-", "-", "-", "-", fmt.Sprintf("%d", pb.numSessions)})
+			continue
+		}
+
+		var sectors []string
+		var theoreticalBest time.Duration
+		for _, sector := range pb.bestSectors {
+			sectors = append(sectors, sector.String())
+			theoreticalBest += sector
+		}
+		theoretical := "-"
+		if len(sectors) > 0 {
+			theoretical = theoreticalBest.String()
+		}
+
+		table.Append([]string{
+			pb.track,
+			pb.driver,
+			pb.lap.Time.String(),
+			formatSessionDate(pb.session),
+			strings.Join(sectors, " "),
+			theoretical,
+			fmt.Sprintf("%d", pb.numSessions),
+		})
+	}
+	table.Render()
+}
+
+func formatSessionDate(session *StoredSession) string {
+	if session.StartTime.IsZero() {
+		return "-"
+	}
+	return session.StartTime.Format("2006-01-02 15:04")
+}
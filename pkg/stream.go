@@ -0,0 +1,193 @@
+package pkg
+
+import (
+	"context"
+)
+
+// StreamCallbacks receive the parts of a session while it is read, every callback is optional.
+// Returning an error from a callback stops the stream and StreamData returns that error.
+type StreamCallbacks struct {
+	// TrackInformation is called once with the header information before the first measurement.
+	TrackInformation func(info *TrackInformation) error
+	// SessionInfo is called once with the session metadata before the first measurement.
+	SessionInfo func(info *SessionInfo) error
+	// Measurement is called for every (smoothed, if configured) measurement, indices match the ones of the laps.
+	Measurement func(index int, measure GPSMeasurement) error
+	// Event is called for every annotation in the log, its MeasureIndex refers to the raw measurements.
+	Event func(event Event) error
+	// Lap is called as soon as a lap is completed. Its type and validity are not classified yet, since that depends on
+	// the whole session, see ClassifyLaps.
+	Lap func(lap Lap) error
+	// PitVisit is called as soon as the car left the pit lane or a long standstill ended.
+	PitVisit func(visit PitVisit) error
+}
+
+// StreamData reads the input file of the config and passes measurements, events and laps to the callbacks as soon as
+// they are available. In contrast to ReadData it only needs constant memory, which makes it suitable for endurance
+// sessions of hundreds of MB. If smoothing or the lap recalculation is enabled, the file is read twice since both
+// depend on statistics of the whole session.
+func StreamData(ctx context.Context, config DataConfig, callbacks StreamCallbacks) error {
+	var stats *measureStatistics
+	if config.UseSmoothedGPSData || config.RecalculateLaps {
+		var err error
+		stats, err = readMeasureStatistics(ctx, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	processor := &streamProcessor{config: config, stats: stats, callbacks: callbacks, pit: newPitDetector(config, nil)}
+	err := streamInputFile(ctx, config, StreamCallbacks{
+		TrackInformation: processor.trackInformation,
+		SessionInfo:      callbacks.SessionInfo,
+		Measurement:      processor.measurement,
+		Event:            processor.event,
+	})
+	if err != nil {
+		return err
+	}
+	return processor.finish()
+}
+
+func readMeasureStatistics(ctx context.Context, config DataConfig) (*measureStatistics, error) {
+	stats := newMeasureStatistics()
+	var trackInfo *TrackInformation
+	started := false
+	err := streamInputFile(ctx, config, StreamCallbacks{
+		TrackInformation: func(info *TrackInformation) error {
+			trackInfo = info
+			return nil
+		},
+		Measurement: func(index int, measure GPSMeasurement) error {
+			if !started {
+				started = true
+				needed, err := needsCircuitInference(config, trackInfo, measure.LatLng)
+				if err != nil {
+					return err
+				}
+				if needed {
+					stats.path = &circuitPath{}
+				}
+			}
+			stats.add(measure)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// streamProcessor applies the smoothing and lap detection to the raw measurements one at a time.
+type streamProcessor struct {
+	config     DataConfig
+	stats      *measureStatistics
+	callbacks  StreamCallbacks
+	trackInfo  *TrackInformation
+	smoother   *KalmanSmoother
+	detector   lapDetector
+	pit        *pitDetector
+	numMeasure int
+}
+
+func (p *streamProcessor) event(event Event) error {
+	p.pit.event(event)
+	if p.detector != nil {
+		annotateLap(p.detector, event)
+	}
+	if p.callbacks.Event != nil {
+		return p.callbacks.Event(event)
+	}
+	return nil
+}
+
+func (p *streamProcessor) trackInformation(info *TrackInformation) error {
+	// the track information is passed on with the first measurement, which is needed to match the track
+	p.trackInfo = info
+	return nil
+}
+
+func (p *streamProcessor) measurement(index int, measure GPSMeasurement) error {
+	if p.detector == nil {
+		if err := resolveTrack(p.config, p.trackInfo, measure.LatLng); err != nil {
+			return err
+		}
+		if p.stats != nil && p.stats.path != nil {
+			if err := inferMissingStartFinish(p.config, p.trackInfo, p.stats.path); err != nil {
+				return err
+			}
+		}
+		if p.callbacks.TrackInformation != nil {
+			if err := p.callbacks.TrackInformation(p.trackInfo); err != nil {
+				return err
+			}
+		}
+
+		var gpsAccuracyStdDev float64
+		if p.stats != nil {
+			gpsAccuracyStdDev = p.stats.accuracy.stddev()
+		}
+		p.detector = newLapDetector(p.config, p.trackInfo, gpsAccuracyStdDev)
+		p.pit.setTrack(p.trackInfo.Track)
+	}
+
+	if p.config.UseSmoothedGPSData {
+		// like PredictKalmanFilteredMeasures, the first measurement only initializes the filter
+		if p.smoother == nil {
+			p.smoother = p.stats.newKalmanSmoother(measure)
+			return nil
+		}
+		measure = p.smoother.Smooth(measure)
+	}
+
+	index = p.numMeasure
+	p.numMeasure++
+	if p.callbacks.Measurement != nil {
+		if err := p.callbacks.Measurement(index, measure); err != nil {
+			return err
+		}
+	}
+	if err := p.emitPitVisits(p.pit.add(index, measure)); err != nil {
+		return err
+	}
+	return p.emitLaps(p.detector.add(index, measure))
+}
+
+func (p *streamProcessor) finish() error {
+	if p.detector == nil {
+		// a session without any measurement
+		if p.trackInfo != nil && p.callbacks.TrackInformation != nil {
+			return p.callbacks.TrackInformation(p.trackInfo)
+		}
+		return nil
+	}
+	if err := p.emitPitVisits(p.pit.finish()); err != nil {
+		return err
+	}
+	return p.emitLaps(p.detector.finish())
+}
+
+func (p *streamProcessor) emitPitVisits(visits []PitVisit) error {
+	if p.callbacks.PitVisit == nil {
+		return nil
+	}
+	for _, visit := range visits {
+		if err := p.callbacks.PitVisit(visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *streamProcessor) emitLaps(laps []Lap) error {
+	if p.callbacks.Lap == nil {
+		return nil
+	}
+	for _, lap := range laps {
+		if err := p.callbacks.Lap(lap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TrackMatchRadiusMeters is how far away from the start/finish gate a session may begin to still be matched to a track.
+const TrackMatchRadiusMeters = 3000.0
+
+// GateMaxHeadingDifference is how many degrees the car may drive off the heading of a gate for a crossing to count.
+const GateMaxHeadingDifference = 60.0
+
+// Gate is a line across the track, a lap or sector starts when the car crosses it.
+type Gate struct {
+	A LatLng `json:"a"`
+	B LatLng `json:"b"`
+	// Heading is the driving direction through the gate in degrees, if not set the direction of the first crossing counts.
+	Heading *float64 `json:"heading,omitempty"`
+}
+
+// ParseGate parses a gate given as "lat,lng,lat,lng" of both end points, optionally followed by its heading.
+func ParseGate(s string) (*Gate, error) {
+	split := strings.Split(s, ",")
+	if len(split) != 4 && len(split) != 5 {
+		return nil, fmt.Errorf("a gate needs four coordinates lat,lng,lat,lng and an optional heading but got '%s'", s)
+	}
+
+	var coordinates []float64
+	for _, c := range split {
+		f, err := strconv.ParseFloat(strings.TrimSpace(c), 64)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse gate coordinate '%s': %v", c, err)
+		}
+		coordinates = append(coordinates, f)
+	}
+	gate := &Gate{A: LatLng{Lat: coordinates[0], Lng: coordinates[1]}, B: LatLng{Lat: coordinates[2], Lng: coordinates[3]}}
+	if len(coordinates) == 5 {
+		gate.Heading = &coordinates[4]
+	}
+	return gate, nil
+}
+
+// Center returns the mid point of the gate.
+func (g Gate) Center() LatLng {
+	return LatLng{Lat: (g.A.Lat + g.B.Lat) / 2, Lng: (g.A.Lng + g.B.Lng) / 2}
+}
+
+// CustomTrackName is the name of the track made from gates given in the DataConfig.
+const CustomTrackName = "Custom"
+
+// Track describes a circuit or a point-to-point course like a hillclimb with its timing gates.
+type Track struct {
+	Name         string  `json:"name"`
+	LengthMeters float64 `json:"lengthMeters,omitempty"`
+	// StartFinish is only the start gate if the track has a separate finish gate.
+	StartFinish Gate `json:"startFinish"`
+	// Finish is only set for point-to-point tracks.
+	Finish *Gate `json:"finish,omitempty"`
+	// Sectors are the gates that split a lap into sectors, in driving order without the start/finish gate.
+	Sectors []Gate `json:"sectors,omitempty"`
+	// PitLane is a polygon around the pit lane.
+	PitLane []LatLng `json:"pitLane,omitempty"`
+}
+
+type TrackDatabase struct {
+	Tracks []Track `json:"tracks"`
+}
+
+// DefaultTrackDatabaseDir is the directory with user defined tracks that is used if none is configured.
+func DefaultTrackDatabaseDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".trackaddict-cli", "tracks")
+}
+
+// LoadTrackDatabase returns the builtin tracks together with all tracks defined in json or yaml files of the given
+// directory. User defined tracks replace builtin ones with the same name. A missing directory is not an error.
+func LoadTrackDatabase(dir string) (*TrackDatabase, error) {
+	db := &TrackDatabase{}
+	if err := json.Unmarshal([]byte(builtinTracksJSON), db); err != nil {
+		return nil, fmt.Errorf("can't parse builtin tracks: %v", err)
+	}
+
+	if dir == "" {
+		return db, nil
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".yaml" || ext == ".yml" {
+			if content, err = yamlToJSON(content); err != nil {
+				return nil, fmt.Errorf("can't parse track file %s: %v", file, err)
+			}
+		}
+		userDb := &TrackDatabase{}
+		if err := json.Unmarshal(content, userDb); err != nil {
+			return nil, fmt.Errorf("can't parse track file %s: %v", file, err)
+		}
+		for _, track := range userDb.Tracks {
+			db.add(track)
+		}
+	}
+
+	return db, nil
+}
+
+// yamlToJSON converts a yaml track file into json, so that both formats use the same field names.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func (db *TrackDatabase) add(track Track) {
+	for i := range db.Tracks {
+		if strings.EqualFold(db.Tracks[i].Name, track.Name) {
+			db.Tracks[i] = track
+			return
+		}
+	}
+	db.Tracks = append(db.Tracks, track)
+}
+
+// Find returns the track with the given name, ignoring the case.
+func (db *TrackDatabase) Find(name string) (*Track, error) {
+	for i := range db.Tracks {
+		if strings.EqualFold(db.Tracks[i].Name, name) {
+			return &db.Tracks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown track %s", name)
+}
+
+// Match returns the track whose start/finish gate is closest to the given position, nil if none is close enough.
+func (db *TrackDatabase) Match(position LatLng) *Track {
+	var closest *Track
+	closestDistance := TrackMatchRadiusMeters
+	for i := range db.Tracks {
+		dist := haversineDistance(db.Tracks[i].StartFinish.Center(), position)
+		if dist < closestDistance {
+			closest = &db.Tracks[i]
+			closestDistance = dist
+		}
+	}
+	return closest
+}
+
+// resolveTrack sets the track of the track information, either the one configured by name or the one matching the
+// given position. Without any match, the track information stays untouched.
+func resolveTrack(config DataConfig, trackInfo *TrackInformation, position LatLng) error {
+	if config.StartGate != nil {
+		trackInfo.Track = &Track{Name: CustomTrackName, StartFinish: *config.StartGate, Finish: config.FinishGate}
+		center := config.StartGate.Center()
+		trackInfo.StartLatLng = &center
+		return nil
+	}
+	if trackInfo.Track != nil {
+		return nil
+	}
+
+	dir := config.TrackDatabaseDir
+	if dir == "" {
+		dir = DefaultTrackDatabaseDir()
+	}
+	db, err := LoadTrackDatabase(dir)
+	if err != nil {
+		return err
+	}
+
+	if config.TrackName != "" {
+		trackInfo.Track, err = db.Find(config.TrackName)
+		if err != nil {
+			return err
+		}
+	} else {
+		if trackInfo.StartLatLng != nil {
+			position = *trackInfo.StartLatLng
+		}
+		trackInfo.Track = db.Match(position)
+	}
+
+	if trackInfo.Track != nil && trackInfo.StartLatLng == nil {
+		center := trackInfo.Track.StartFinish.Center()
+		trackInfo.StartLatLng = &center
+	}
+	return nil
+}
+
+// crossing is like crossingFraction, but a gate without a heading takes the direction of its first crossing.
+func (g *Gate) crossing(from LatLng, to LatLng) (float64, bool) {
+	fraction, ok := g.crossingFraction(from, to)
+	if ok && g.Heading == nil {
+		heading := bearingDegrees(from, to)
+		g.Heading = &heading
+	}
+	return fraction, ok
+}
+
+// crossingFraction returns where along the segment from -> to the gate was crossed, as a fraction between 0 and 1.
+// Crossings against the heading of the gate don't count.
+func (g Gate) crossingFraction(from LatLng, to LatLng) (float64, bool) {
+	if g.Heading != nil && headingDifference(bearingDegrees(from, to), *g.Heading) > GateMaxHeadingDifference {
+		return 0, false
+	}
+
+	// a local flat projection around the gate is precise enough for the few meters involved
+	origin := g.A
+	project := func(p LatLng) (float64, float64) {
+		x := degreesToRadians(p.Lng-origin.Lng) * math.Cos(degreesToRadians(origin.Lat)) * EarthRadiusInMeters
+		y := degreesToRadians(p.Lat-origin.Lat) * EarthRadiusInMeters
+		return x, y
+	}
+
+	px, py := project(from)
+	rx, ry := project(to)
+	rx, ry = rx-px, ry-py
+	qx, qy := project(g.A)
+	sx, sy := project(g.B)
+	sx, sy = sx-qx, sy-qy
+
+	denominator := rx*sy - ry*sx
+	if denominator == 0 {
+		// parallel or no movement at all
+		return 0, false
+	}
+
+	t := ((qx-px)*sy - (qy-py)*sx) / denominator
+	u := ((qx-px)*ry - (qy-py)*rx) / denominator
+	// a crossing exactly at the start of the segment was already counted as the end of the previous one
+	if t <= 0 || t > 1 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
+}
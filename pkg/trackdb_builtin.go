@@ -0,0 +1,21 @@
+package pkg
+
+// builtinTracksJSON contains the tracks that are known without any configuration, it uses the same format as the
+// json files in the track database directory.
+const builtinTracksJSON = `{
+  "tracks": [
+    {
+      "name": "Spreewaldring",
+      "lengthMeters": 2300,
+      "startFinish": {"a": {"lat": 51.999412, "lng": 13.688426}, "b": {"lat": 51.998841, "lng": 13.686606}, "heading": 153},
+      "sectors": [
+        {"a": {"lat": 51.996229, "lng": 13.683208}, "b": {"lat": 51.996518, "lng": 13.683767}, "heading": 325},
+        {"a": {"lat": 51.997591, "lng": 13.685471}, "b": {"lat": 51.997305, "lng": 13.686034}, "heading": 42}
+      ],
+      "pitLane": [
+        {"lat": 51.99960, "lng": 13.68680}, {"lat": 51.99960, "lng": 13.68730}, {"lat": 52.00030, "lng": 13.68745},
+        {"lat": 52.00060, "lng": 13.68710}, {"lat": 52.00060, "lng": 13.68630}, {"lat": 52.00010, "lng": 13.68630}
+      ]
+    }
+  ]
+}`
@@ -0,0 +1,168 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGateCrossingFraction(t *testing.T) {
+	north := 0.0
+	south := 180.0
+	// a gate of about 14 meters across a road to the north
+	gate := Gate{A: LatLng{Lat: 50.0, Lng: 12.0}, B: LatLng{Lat: 50.0, Lng: 12.0002}}
+
+	tests := []struct {
+		name     string
+		heading  *float64
+		from     LatLng
+		to       LatLng
+		crossed  bool
+		fraction float64
+	}{
+		{"halfway", nil, LatLng{Lat: 49.9999, Lng: 12.0001}, LatLng{Lat: 50.0001, Lng: 12.0001}, true, 0.5},
+		{"at the end", nil, LatLng{Lat: 49.9999, Lng: 12.0001}, LatLng{Lat: 50.0, Lng: 12.0001}, true, 1},
+		{"at the start", nil, LatLng{Lat: 50.0, Lng: 12.0001}, LatLng{Lat: 50.0001, Lng: 12.0001}, false, 0},
+		{"before the gate", nil, LatLng{Lat: 49.9998, Lng: 12.0001}, LatLng{Lat: 49.9999, Lng: 12.0001}, false, 0},
+		{"beside the gate", nil, LatLng{Lat: 49.9999, Lng: 12.0003}, LatLng{Lat: 50.0001, Lng: 12.0003}, false, 0},
+		{"parallel", nil, LatLng{Lat: 50.0, Lng: 12.0}, LatLng{Lat: 50.0, Lng: 12.0002}, false, 0},
+		{"in direction", &north, LatLng{Lat: 49.9999, Lng: 12.0001}, LatLng{Lat: 50.0001, Lng: 12.0001}, true, 0.5},
+		{"diagonal in direction", &north, LatLng{Lat: 49.9999, Lng: 12.0}, LatLng{Lat: 50.0001, Lng: 12.0002}, true, 0.5},
+		{"against direction", &south, LatLng{Lat: 49.9999, Lng: 12.0001}, LatLng{Lat: 50.0001, Lng: 12.0001}, false, 0},
+		{"backwards against direction", &north, LatLng{Lat: 50.0001, Lng: 12.0001}, LatLng{Lat: 49.9999, Lng: 12.0001}, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := gate
+			g.Heading = test.heading
+			fraction, crossed := g.crossingFraction(test.from, test.to)
+			if crossed != test.crossed || math.Abs(fraction-test.fraction) > 1e-6 {
+				t.Errorf("expected crossed=%v at %.2f, got crossed=%v at %.2f", test.crossed, test.fraction, crossed, fraction)
+			}
+		})
+	}
+}
+
+func TestGateCrossingLearnsHeading(t *testing.T) {
+	gate := Gate{A: LatLng{Lat: 50.0, Lng: 12.0}, B: LatLng{Lat: 50.0, Lng: 12.0002}}
+	south, north := LatLng{Lat: 49.9999, Lng: 12.0001}, LatLng{Lat: 50.0001, Lng: 12.0001}
+
+	if _, ok := gate.crossing(north, south); !ok {
+		t.Fatal("expected the first crossing to count")
+	}
+	if gate.Heading == nil || headingDifference(*gate.Heading, 180) > 1 {
+		t.Fatalf("expected the gate to learn the heading south, got %v", gate.Heading)
+	}
+	if _, ok := gate.crossing(south, north); ok {
+		t.Error("expected a crossing to the north not to count")
+	}
+	if _, ok := gate.crossing(north, south); !ok {
+		t.Error("expected another crossing to the south to count")
+	}
+}
+
+func TestParseGate(t *testing.T) {
+	tests := []struct {
+		input   string
+		heading *float64
+		err     bool
+	}{
+		{"50.0,12.0,50.0,12.0002", nil, false},
+		{"50.0, 12.0, 50.0, 12.0002, 90", func() *float64 { h := 90.0; return &h }(), false},
+		{"50.0,12.0,50.0", nil, true},
+		{"50.0,12.0,50.0,x", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			gate, err := ParseGate(test.input)
+			if (err != nil) != test.err {
+				t.Fatalf("expected error=%v, got %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if gate.A != (LatLng{Lat: 50.0, Lng: 12.0}) || gate.B != (LatLng{Lat: 50.0, Lng: 12.0002}) {
+				t.Errorf("unexpected gate %+v", gate)
+			}
+			if (gate.Heading == nil) != (test.heading == nil) || (gate.Heading != nil && *gate.Heading != *test.heading) {
+				t.Errorf("expected heading %v, got %v", test.heading, gate.Heading)
+			}
+		})
+	}
+}
+
+func TestLoadTrackDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trackaddict-tracks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"custom.json": `{"tracks": [{"name": "Json Track", "lengthMeters": 1200,
+			"startFinish": {"a": {"lat": 50.0, "lng": 12.0}, "b": {"lat": 50.0, "lng": 12.001}}}]}`,
+		"custom.yaml": `
+tracks:
+  - name: Yaml Track
+    lengthMeters: 3400
+    startFinish: {a: {lat: 48.0, lng: 11.0}, b: {lat: 48.0, lng: 11.001}, heading: 90}
+    pitLane:
+      - {lat: 48.001, lng: 11.0}
+      - {lat: 48.002, lng: 11.0}
+      - {lat: 48.002, lng: 11.001}
+`,
+		"spreewaldring.yml": `
+tracks:
+  - name: spreewaldring
+    lengthMeters: 2400
+    startFinish:
+      a: {lat: 51.999412, lng: 13.688426}
+      b: {lat: 51.998841, lng: 13.686606}
+`,
+		"notes.txt": "not a track",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := LoadTrackDatabase(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		length  float64
+		heading bool
+		pitLane int
+	}{
+		{"json track", 1200, false, 0},
+		{"Yaml Track", 3400, true, 3},
+		{"Spreewaldring", 2400, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			track, err := db.Find(test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if track.LengthMeters != test.length || (track.StartFinish.Heading != nil) != test.heading ||
+				len(track.PitLane) != test.pitLane {
+				t.Errorf("unexpected track %+v", track)
+			}
+		})
+	}
+	if len(db.Tracks) != 3 {
+		t.Errorf("expected the user defined tracks to replace the builtin one of the same name, got %d tracks", len(db.Tracks))
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("tracks: [{name: "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTrackDatabase(dir); err == nil {
+		t.Error("expected an error for the broken yaml file")
+	}
+}
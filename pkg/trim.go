@@ -0,0 +1,206 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TrimConfig configures the cut of a session into the parts that are worth analyzing.
+type TrimConfig struct {
+	DataConfig
+	// OutputFile is the file of trim, split appends the number of the part to it.
+	OutputFile string
+	// FromSeconds and ToSeconds limit the session time that trim keeps, a ToSeconds of 0 keeps the rest of the session.
+	FromSeconds float64
+	ToSeconds   float64
+	// Laps limits trim to a range of laps as the laps command numbers them, nil keeps all laps.
+	Laps *LapRange
+}
+
+// LapRange is a range of laps as the laps command numbers them, including the first and the last lap.
+type LapRange struct {
+	First int
+	Last  int
+}
+
+func (r *LapRange) String() string {
+	if r.Last < 0 {
+		return fmt.Sprintf("%d-", r.First)
+	} else if r.Last == r.First {
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// SessionPart is a range of measurements that is written as a session of its own.
+type SessionPart struct {
+	MeasureStartIndex        int
+	MeasureEndIndexExclusive int
+}
+
+// ParseLapRange parses "3" for a single lap, "3-7" for the laps 3 to 7 and "3-" for the laps from 3 on.
+func ParseLapRange(s string) (*LapRange, error) {
+	first, last := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		first, last = s[:i], s[i+1:]
+	}
+	firstLap, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the first lap of '%s': %v", s, err)
+	}
+	lapRange := &LapRange{First: firstLap, Last: -1}
+	if strings.TrimSpace(last) != "" {
+		if lapRange.Last, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+			return nil, fmt.Errorf("can't parse the last lap of '%s': %v", s, err)
+		}
+		if lapRange.Last < lapRange.First {
+			return nil, fmt.Errorf("the last lap of '%s' is before the first", s)
+		}
+	}
+	return lapRange, nil
+}
+
+// ParseSessionTime parses a time of the session given as seconds, m:ss or h:mm:ss, the seconds can have decimals.
+func ParseSessionTime(s string) (float64, error) {
+	seconds := 0.0
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("can't parse the session time '%s', expected seconds, m:ss or h:mm:ss", s)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
+
+// TrimPart returns the part of the session within the time and lap range of the config.
+func TrimPart(data *TrackData, config TrimConfig) (SessionPart, error) {
+	measures := data.Measures(config.DataConfig)
+	part := SessionPart{MeasureEndIndexExclusive: len(measures)}
+	for part.MeasureStartIndex < len(measures) && measures[part.MeasureStartIndex].RelativeTime < config.FromSeconds {
+		part.MeasureStartIndex++
+	}
+	if config.ToSeconds > 0 {
+		part.MeasureEndIndexExclusive = part.MeasureStartIndex
+		for part.MeasureEndIndexExclusive < len(measures) && measures[part.MeasureEndIndexExclusive].RelativeTime <= config.ToSeconds {
+			part.MeasureEndIndexExclusive++
+		}
+	}
+
+	if config.Laps != nil {
+		lapStart, lapEnd := -1, -1
+		for i, lap := range data.Laps {
+			number := exportLapNumber(i, lap)
+			if number < config.Laps.First || (config.Laps.Last >= 0 && number > config.Laps.Last) {
+				continue
+			}
+			if lapStart < 0 {
+				lapStart = lap.MeasureStartIndex
+			}
+			lapEnd = lap.MeasureEndIndexExclusive
+		}
+		if lapStart < 0 {
+			return part, fmt.Errorf("the session has no laps in the range %s", config.Laps)
+		}
+		part.MeasureStartIndex = Max(part.MeasureStartIndex, lapStart)
+		part.MeasureEndIndexExclusive = Min(part.MeasureEndIndexExclusive, lapEnd)
+	}
+
+	if part.MeasureStartIndex >= part.MeasureEndIndexExclusive {
+		return part, fmt.Errorf("nothing of the session is left after trimming")
+	}
+	return part, nil
+}
+
+// OutingParts returns the outings between the pit visits of a session. Parts that never got faster than the pit lane
+// speed limit are left out, they are the driving around in the paddock.
+func OutingParts(data *TrackData, config DataConfig) []SessionPart {
+	measures := data.Measures(config)
+	var parts []SessionPart
+	addPart := func(start int, end int) {
+		for i := start; i < end; i++ {
+			if measures[i].SpeedKph >= PitLaneMaxSpeedKph {
+				parts = append(parts, SessionPart{MeasureStartIndex: start, MeasureEndIndexExclusive: end})
+				return
+			}
+		}
+	}
+
+	start := 0
+	for _, visit := range data.PitVisits {
+		addPart(start, Min(visit.MeasureStartIndex, len(measures)))
+		start = visit.MeasureEndIndexExclusive
+	}
+	addPart(start, len(measures))
+	return parts
+}
+
+// Trim reads the input file of the config and writes the part within its time and lap range as a TrackAddict csv.
+func Trim(config TrimConfig) error {
+	// the parts are cut from the measurements as they were recorded
+	config.UseSmoothedGPSData = false
+	data, err := ReadData(config.DataConfig)
+	if err != nil {
+		return err
+	}
+	part, err := TrimPart(data, config)
+	if err != nil {
+		return err
+	}
+	return writeSessionPart(data, config.DataConfig, part, trackAddictOutputFile(config.OutputFile))
+}
+
+// Split reads the input file of the config and writes every outing as a TrackAddict csv of its own, numbered from 1.
+func Split(config TrimConfig) error {
+	config.UseSmoothedGPSData = false
+	data, err := ReadData(config.DataConfig)
+	if err != nil {
+		return err
+	}
+	parts := OutingParts(data, config.DataConfig)
+	if len(parts) == 0 {
+		return fmt.Errorf("the session has no outings on track")
+	}
+
+	prefix := strings.TrimSuffix(trackAddictOutputFile(config.OutputFile), ".csv")
+	for i, part := range parts {
+		if err := writeSessionPart(data, config.DataConfig, part, fmt.Sprintf("%s_%d.csv", prefix, i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trackAddictOutputFile(outputFile string) string {
+	if !strings.HasSuffix(strings.ToLower(outputFile), ".csv") {
+		return outputFile + ".csv"
+	}
+	return outputFile
+}
+
+func writeSessionPart(data *TrackData, config DataConfig, part SessionPart, outputFile string) error {
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(file)
+	err = writeTrackAddictPart(data, config, part, buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	measures := data.Measures(config)
+	fmt.Printf("Saved %s with %s of the session from %s to %s\n", outputFile,
+		secondsToDuration(measures[part.MeasureEndIndexExclusive-1].RelativeTime-measures[part.MeasureStartIndex].RelativeTime),
+		secondsToDuration(measures[part.MeasureStartIndex].RelativeTime), secondsToDuration(measures[part.MeasureEndIndexExclusive-1].RelativeTime))
+	return nil
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLapRange(t *testing.T) {
+	tests := []struct {
+		input string
+		first int
+		last  int
+		error string
+	}{
+		{"3", 3, 3, ""},
+		{"3-7", 3, 7, ""},
+		{" 3 - 7 ", 3, 7, ""},
+		{"3-", 3, -1, ""},
+		{"0-0", 0, 0, ""},
+		{"", 0, 0, "can't parse the first lap"},
+		{"-7", 0, 0, "can't parse the first lap"},
+		{"a-7", 0, 0, "can't parse the first lap"},
+		{"3-b", 0, 0, "can't parse the last lap"},
+		{"7-3", 0, 0, "the last lap of '7-3' is before the first"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			lapRange, err := ParseLapRange(test.input)
+			if test.error != "" {
+				if err == nil || !strings.Contains(err.Error(), test.error) {
+					t.Errorf("expected an error with '%s', got %v", test.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lapRange.First != test.first || lapRange.Last != test.last {
+				t.Errorf("expected the laps %d to %d, got %+v", test.first, test.last, lapRange)
+			}
+		})
+	}
+}
+
+func TestParseSessionTime(t *testing.T) {
+	tests := []struct {
+		input   string
+		seconds float64
+		error   bool
+	}{
+		{"0", 0, false},
+		{"90", 90, false},
+		{"12.5", 12.5, false},
+		{"1:30", 90, false},
+		{"1:02:03.25", 3723.25, false},
+		{" 2:00 ", 120, false},
+		{"", 0, true},
+		{"1:", 0, true},
+		{"-5", 0, true},
+		{"1:-5", 0, true},
+		{"1m30s", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			seconds, err := ParseSessionTime(test.input)
+			if test.error {
+				if err == nil {
+					t.Errorf("expected an error, got %.2f seconds", seconds)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seconds != test.seconds {
+				t.Errorf("expected %.2f seconds, got %.2f", test.seconds, seconds)
+			}
+		})
+	}
+}
+
+func TestSplitRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		cut   func(config TrimConfig) error
+		parts int
+	}{
+		{"split", Split, 4},
+		{"trim within a lap", func(config TrimConfig) error {
+			config.FromSeconds = 500
+			return Trim(config)
+		}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "trackaddict-split")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			config := TrimConfig{DataConfig: DataConfig{InputFile: "../example/STC_log.csv"}, OutputFile: filepath.Join(dir, "part")}
+			if err := test.cut(config); err != nil {
+				t.Fatal(err)
+			}
+			files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != test.parts {
+				t.Fatalf("expected %d parts, got %v", test.parts, files)
+			}
+			for _, file := range files {
+				data, err := ReadData(DataConfig{InputFile: file})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, lap := range data.Laps {
+					// the app starts a new lap at the last measurement of some sessions, which has no time
+					if lap.Time < 0 || (lap.Time == 0 && lap.MeasureEndIndexExclusive-lap.MeasureStartIndex > 1) {
+						t.Errorf("%s: lap %d has the time %s", filepath.Base(file), i, lap.Time)
+					}
+				}
+			}
+		})
+	}
+}
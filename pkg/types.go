@@ -1,9 +1,26 @@
 package pkg
 
+import (
+	"errors"
+	"math"
+	"time"
+)
+
 type DataConfig struct {
-	InputFile          string
+	InputFile string
+	// InputFormat is one of the InputFormats, the format is detected from the file if it is empty.
+	InputFormat        string
 	UseSmoothedGPSData bool
 	RecalculateLaps    bool
+	// TrackName forces a track of the track database, otherwise the track is matched by the session's position.
+	TrackName string
+	// TrackDatabaseDir contains json files with additional tracks, defaults to DefaultTrackDatabaseDir.
+	TrackDatabaseDir string
+	// StartGate overrides the track database, together with a FinishGate the session is timed point-to-point.
+	StartGate  *Gate
+	FinishGate *Gate
+	// PitLane is a polygon around the pit lane, it overrides the one of the track database.
+	PitLane []LatLng
 }
 
 type PlotConfig struct {
@@ -15,32 +32,252 @@ type PlotConfig struct {
 	PlotLapsSeparately bool
 }
 
+type ReportConfig struct {
+	DataConfig
+	OutputFile string
+	// MapTiles renders the track map on OpenStreetMap tiles like Plot, which needs network access.
+	MapTiles bool
+}
+
 type TrackData struct {
 	Laps                   []Lap
 	TrackInformation       *TrackInformation
+	SessionInfo            *SessionInfo
 	GPSMeasurement         []GPSMeasurement
 	FilteredGPSMeasurement []GPSMeasurement
+	Events                 []Event
+	// PitVisits refer to the measurements the laps were computed on.
+	PitVisits []PitVisit
+}
+
+// LatLng is a WGS84 coordinate in degrees.
+type LatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
 }
 
+// Acceleration is the accelerometer reading in g along the three device axes. Those are the axes of the phone for
+// TrackAddict, a VBOX is mounted in the car so X is longitudinal and Y lateral. The g that RaceChrono and Harry's
+// compute from the GPS are left out, the exporters compute them from the GPS anyway.
+type Acceleration struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+// Lap is a contiguous range of measurements, the indices refer to the measurement slice the laps were computed on.
 type Lap struct {
-	timeSeconds              float64
-	measureStartIndex        int
-	measureEndIndexExclusive int
+	Time                     time.Duration
+	MeasureStartIndex        int
+	MeasureEndIndexExclusive int
+	// StartTimeSeconds is the relative time at which the lap started, for gate based laps it lies between two measurements.
+	StartTimeSeconds float64
+	// SectorTimes is only set if the track has sector gates and all of them were crossed during the lap.
+	SectorTimes    []time.Duration
+	DistanceMeters float64
+	TopSpeedKph    float64
+	Type           LapType
+	// Valid and InvalidReason are set by ClassifyLaps.
+	Valid         bool
+	InvalidReason string
+}
+
+type LapType int
+
+const (
+	UnclassifiedLap LapType = iota
+	// PointToPointRun is a timed run from the start to the finish gate of a hillclimb or rally stage.
+	PointToPointRun
+	// OutLap starts in the pit lane or at the beginning of the session.
+	OutLap
+	// InLap ends in the pit lane or at the end of the session.
+	InLap
+	// FlyingLap is driven on the track from start to finish.
+	FlyingLap
+	// PitThroughLap enters and leaves the pit lane within the same lap.
+	PitThroughLap
+)
+
+func (t LapType) String() string {
+	switch t {
+	case PointToPointRun:
+		return "Run"
+	case OutLap:
+		return "Outlap"
+	case InLap:
+		return "Inlap"
+	case FlyingLap:
+		return "Flying"
+	case PitThroughLap:
+		return "Pit-Through"
+	}
+	return "Unclassified"
+}
+
+// PitVisit is the range of measurements the car spent in the pit lane.
+type PitVisit struct {
+	MeasureStartIndex        int
+	MeasureEndIndexExclusive int
 }
 
 type TrackInformation struct {
-	startLatLng       []float64
-	gpsAccuracyStdDev float64
+	// StartLatLng is nil if the session did not define a start/finish point.
+	StartLatLng       *LatLng
+	GPSAccuracyStdDev float64
+	// Track is the matching track of the track database, nil if the session couldn't be matched.
+	Track *Track
+	// InferredCircuit is set if the start/finish gate of Track had to be inferred from the driven path.
+	InferredCircuit *CircuitInference
+}
+
+type EventType int
+
+const (
+	UnknownEvent EventType = iota
+	LapEvent
+	PitLaneEntryEvent
+	PitLaneExitEvent
+	SessionEndEvent
+)
+
+func (t EventType) String() string {
+	switch t {
+	case LapEvent:
+		return "Lap"
+	case PitLaneEntryEvent:
+		return "Pit Lane Entry"
+	case PitLaneExitEvent:
+		return "Pit Lane Exit"
+	case SessionEndEvent:
+		return "Session End"
+	}
+	return "Unknown"
+}
+
+// Event is an annotation the logging app wrote between two measurements, like "# Pit Lane Entry".
+type Event struct {
+	Type EventType
+	// MeasureIndex is the index of the first raw measurement after the annotation.
+	MeasureIndex int
+	// LapNumber and LapTime are only set for lap events.
+	LapNumber int
+	LapTime   time.Duration
+	Text      string
 }
 
 type GPSMeasurement struct {
-	latLng             []float64
-	relativeTime       float64
-	utcTimestamp       float64
-	accelerationVector []float64
-	altitudeMeters     float64
-	speedKph           float64
-	accuracyMeter      float64
-	headingDegrees     float64
-	trackAddictLap     int
+	LatLng LatLng
+	// RelativeTime is the time in seconds since the start of the session.
+	RelativeTime float64
+	// UTCTimestamp is the unix time in seconds.
+	UTCTimestamp   float64
+	Acceleration   Acceleration
+	AltitudeMeters float64
+	SpeedKph       float64
+	AccuracyMeters float64
+	HeadingDegrees float64
+	TrackAddictLap int
+	// GPSUpdate is true if the GPS receiver delivered a new fix with this measurement.
+	GPSUpdate bool
+	// Channels are only read from TrackAddict csv files.
+	Channels TrackAddictChannels
+}
+
+// TrackAddictChannels are the columns of a TrackAddict csv that the analysis doesn't use, they are kept to write them
+// back as they were.
+type TrackAddictChannels struct {
+	PredictedLapSeconds       float64
+	PredictedVsBestLapSeconds float64
+	GPSDelaySeconds           float64
+	Brake                     float64
+	BarometricPressureKPa     float64
+	PressureAltitudeMeters    float64
+}
+
+// NewLap creates a lap spanning the given measurement range and derives its time from the relative timestamps.
+func NewLap(measures []GPSMeasurement, measureStartIndex int, measureEndIndexExclusive int) Lap {
+	lap := lapInProgress{}
+	for i := measureStartIndex; i < measureEndIndexExclusive; i++ {
+		lap.add(i, measures[i])
+	}
+	return lap.toLap(lap.startTime, lap.lastTime)
+}
+
+// newLapFromTimes creates a lap when only the relative times of its first and last measurement are at hand.
+func newLapFromTimes(measureStartIndex int, measureEndIndexExclusive int, startTime float64, lastTime float64) Lap {
+	return Lap{
+		Time:                     secondsToDuration(lastTime - startTime),
+		MeasureStartIndex:        measureStartIndex,
+		MeasureEndIndexExclusive: measureEndIndexExclusive,
+		StartTimeSeconds:         startTime,
+	}
+}
+
+// NumMeasures returns how many measurements belong to the lap.
+func (l Lap) NumMeasures() int {
+	return l.MeasureEndIndexExclusive - l.MeasureStartIndex
+}
+
+// NewTrackInformation creates the track information for a start/finish point, pass nil if it is unknown.
+func NewTrackInformation(startLatLng *LatLng) *TrackInformation {
+	return &TrackInformation{StartLatLng: startLatLng}
+}
+
+// Time returns the UTC wall clock time of the measurement.
+func (m GPSMeasurement) Time() time.Time {
+	sec, frac := math.Modf(m.UTCTimestamp)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+// SpeedMetersPerSecond returns the GPS speed in m/s.
+func (m GPSMeasurement) SpeedMetersPerSecond() float64 {
+	return m.SpeedKph / 3.6
+}
+
+// NewTrackData builds the track data from measurements of any source, it smoothes the GPS data and extracts the laps
+// according to the given config. The InputFile of the config is ignored.
+func NewTrackData(config DataConfig, trackInfo *TrackInformation, measures []GPSMeasurement) (*TrackData, error) {
+	return NewTrackDataWithEvents(config, trackInfo, measures, nil)
+}
+
+// NewTrackDataWithEvents is like NewTrackData, the events like pit lane entries and exits improve the lap classification.
+func NewTrackDataWithEvents(config DataConfig, trackInfo *TrackInformation, measures []GPSMeasurement, events []Event) (*TrackData, error) {
+	if len(measures) == 0 {
+		return nil, errors.New("no measurements given")
+	}
+	if trackInfo == nil {
+		trackInfo = NewTrackInformation(nil)
+	}
+	if err := resolveTrack(config, trackInfo, measures[0].LatLng); err != nil {
+		return nil, err
+	}
+	if config.RecalculateLaps && trackInfo.StartLatLng == nil && trackInfo.Track == nil {
+		path := &circuitPath{}
+		for _, m := range measures {
+			path.add(m)
+		}
+		if err := inferMissingStartFinish(config, trackInfo, path); err != nil {
+			return nil, err
+		}
+	}
+
+	filteredMeasures := PredictKalmanFilteredMeasures(measures)
+	data := &TrackData{TrackInformation: trackInfo, GPSMeasurement: measures, FilteredGPSMeasurement: filteredMeasures, Events: events}
+	data.Laps = extractLaps(config, data)
+	data.PitVisits = detectPitVisits(config, data)
+	data.Laps = ClassifyLaps(data.Laps, data.PitVisits, trackInfo.Track)
+	return data, nil
+}
+
+// Measures returns either the raw or the smoothed measurements, depending on the config.
+func (d *TrackData) Measures(config DataConfig) []GPSMeasurement {
+	if config.UseSmoothedGPSData {
+		return d.FilteredGPSMeasurement
+	}
+	return d.GPSMeasurement
+}
+
+// secondsToDuration converts to a duration with millisecond precision, which is the resolution of the logs.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds*1000)) * time.Millisecond
 }
@@ -0,0 +1,666 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	ValidationPass ValidationStatus = "pass"
+	ValidationWarn ValidationStatus = "warn"
+	ValidationFail ValidationStatus = "fail"
+
+	// ValidationMaxJitterFraction is the standard deviation of the sample intervals, relative to their median, above which
+	// the sample timing counts as irregular.
+	ValidationMaxJitterFraction = 0.25
+	// ValidationMinGPSRateHz is the GPS update rate below which laps and speeds become imprecise, below 1 Hz it is unusable.
+	ValidationMinGPSRateHz = 5.0
+	// ValidationMaxAccuracyMeters is the accuracy the 90th percentile of the fixes has to stay within, the median within
+	// twice of it.
+	ValidationMaxAccuracyMeters = 10.0
+	// ValidationMinGapSeconds is the shortest time without samples that counts as a gap, it is at least ten sample intervals.
+	ValidationMinGapSeconds = 1.0
+	// ValidationMaxDropoutFraction is the share of the session without GPS fixes above which the session fails.
+	ValidationMaxDropoutFraction = 0.1
+	// ValidationStuckSeconds is how long a sensor can report the same value while the car is moving.
+	ValidationStuckSeconds = 5.0
+	// ValidationZeroSpeedSeconds is the shortest standstill that is reported.
+	ValidationZeroSpeedSeconds = 10.0
+	// ValidationLapMarkerDistanceMeters is how far from the start/finish a lap may start before its marker is suspicious.
+	ValidationLapMarkerDistanceMeters = 100.0
+	// ValidationLapMarkerToleranceSeconds is how much an annotated lap time may differ from the Lap column.
+	ValidationLapMarkerToleranceSeconds = 1.0
+	// maxValidationFindings limits the findings listed per check, the remaining ones are only counted
+	maxValidationFindings = 10
+)
+
+type ValidationStatus string
+
+// ValidationCheck is the result of one check of the data quality. Values has its key figures for scripts.
+type ValidationCheck struct {
+	Name     string             `json:"name"`
+	Status   ValidationStatus   `json:"status"`
+	Summary  string             `json:"summary"`
+	Findings []string           `json:"findings,omitempty"`
+	Values   map[string]float64 `json:"values,omitempty"`
+}
+
+// ValidationReport is the data quality of a session, its status is the worst of its checks.
+type ValidationReport struct {
+	InputFile string            `json:"inputFile"`
+	Status    ValidationStatus  `json:"status"`
+	Checks    []ValidationCheck `json:"checks"`
+}
+
+// timeSpan is a stretch of the session, like a gap or a standstill. The value is the one a stuck sensor reported.
+type timeSpan struct {
+	startSeconds float64
+	seconds      float64
+	value        float64
+}
+
+// stuckRun follows how long a channel reports the same value while the car is moving.
+type stuckRun struct {
+	name         string
+	value        float64
+	startSeconds float64
+	lastSeconds  float64
+	started      bool
+	changed      bool
+	stuck        []timeSpan
+}
+
+func (r *stuckRun) add(value float64, seconds float64, moving bool) {
+	if r.started && value != r.value {
+		r.changed = true
+	}
+	if !moving || !r.started || value != r.value {
+		r.close()
+		r.started = moving
+		r.value = value
+		r.startSeconds = seconds
+	}
+	r.lastSeconds = seconds
+}
+
+func (r *stuckRun) close() {
+	if r.started && r.lastSeconds-r.startSeconds > ValidationStuckSeconds {
+		r.stuck = append(r.stuck, timeSpan{startSeconds: r.startSeconds, seconds: r.lastSeconds - r.startSeconds, value: r.value})
+	}
+	r.started = false
+}
+
+// validator collects the statistics of a session while it is streamed.
+type validator struct {
+	trackInfo  *TrackInformation
+	numMeasure int
+	previous   GPSMeasurement
+	firstTime  float64
+
+	intervals []float64
+	longGaps  []timeSpan
+	backwards []string
+	repeated  []string
+
+	numFixes     int
+	lastFix      GPSMeasurement
+	gapSinceFix  float64
+	fixIntervals []float64
+	fixGaps      []timeSpan
+	accuracies   []float64
+
+	stuck       []*stuckRun
+	standing    bool
+	standStart  float64
+	standstills []timeSpan
+	topSpeedKph float64
+
+	lapChanges  []GPSMeasurement
+	lapStarts   map[int]float64
+	lapEnds     map[int]float64
+	lapFindings []string
+	lapEvents   []Event
+	laps        []Lap
+	pitVisits   []PitVisit
+}
+
+func newValidator() *validator {
+	v := &validator{lapStarts: map[int]float64{}, lapEnds: map[int]float64{}}
+	for _, name := range []string{"Accel X", "Accel Y", "Accel Z", "Speed", "Position"} {
+		v.stuck = append(v.stuck, &stuckRun{name: name})
+	}
+	return v
+}
+
+func (v *validator) measurement(index int, m GPSMeasurement) error {
+	moving := m.SpeedKph >= StandstillSpeedKph
+	if v.numMeasure == 0 {
+		v.firstTime = m.RelativeTime
+		v.lapStarts[m.TrackAddictLap] = m.RelativeTime
+	} else {
+		dt := m.RelativeTime - v.previous.RelativeTime
+		switch {
+		case dt < 0 || m.UTCTimestamp < v.previous.UTCTimestamp:
+			v.backwards = append(v.backwards, fmt.Sprintf("time goes back by %s at %s", secondsToDuration(-dt),
+				secondsToDuration(m.RelativeTime)))
+		case dt == 0 || m.UTCTimestamp == v.previous.UTCTimestamp:
+			// TrackAddict writes a GPS fix as a row of its own with the time of the sensor row before it
+			if m.GPSUpdate == v.previous.GPSUpdate {
+				v.repeated = append(v.repeated, fmt.Sprintf("repeated timestamp at %s", secondsToDuration(m.RelativeTime)))
+			}
+		default:
+			v.intervals = append(v.intervals, dt)
+			if dt >= ValidationMinGapSeconds {
+				v.longGaps = append(v.longGaps, timeSpan{startSeconds: v.previous.RelativeTime, seconds: dt})
+				v.gapSinceFix += dt
+			}
+		}
+
+		if m.TrackAddictLap != v.previous.TrackAddictLap {
+			v.lapChanges = append(v.lapChanges, m)
+			v.lapEnds[v.previous.TrackAddictLap] = m.RelativeTime
+			v.lapStarts[m.TrackAddictLap] = m.RelativeTime
+			if m.TrackAddictLap != v.previous.TrackAddictLap+1 {
+				v.lapFindings = append(v.lapFindings, fmt.Sprintf("the Lap column jumps from %d to %d at %s",
+					v.previous.TrackAddictLap, m.TrackAddictLap, secondsToDuration(m.RelativeTime)))
+			}
+		}
+	}
+
+	if m.GPSUpdate {
+		if v.numFixes > 0 {
+			interval := m.RelativeTime - v.lastFix.RelativeTime
+			v.fixIntervals = append(v.fixIntervals, interval)
+			// the time without any samples is a gap of the whole log rather than of the GPS
+			if dropout := interval - v.gapSinceFix; dropout >= ValidationMinGapSeconds {
+				v.fixGaps = append(v.fixGaps, timeSpan{startSeconds: v.lastFix.RelativeTime, seconds: dropout})
+			}
+		}
+		v.numFixes++
+		v.lastFix = m
+		v.gapSinceFix = 0
+		v.accuracies = append(v.accuracies, m.AccuracyMeters)
+		v.stuck[3].add(m.SpeedKph, m.RelativeTime, moving)
+		// two coordinates are stuck only together, the sum changes whenever one of them does
+		v.stuck[4].add(m.LatLng.Lat*1000+m.LatLng.Lng, m.RelativeTime, moving)
+	}
+	v.stuck[0].add(m.Acceleration.X, m.RelativeTime, moving)
+	v.stuck[1].add(m.Acceleration.Y, m.RelativeTime, moving)
+	v.stuck[2].add(m.Acceleration.Z, m.RelativeTime, moving)
+
+	if !moving && !v.standing {
+		v.standing = true
+		v.standStart = m.RelativeTime
+	} else if moving && v.standing {
+		v.closeStandstill(m.RelativeTime)
+	}
+	v.topSpeedKph = math.Max(v.topSpeedKph, m.SpeedKph)
+
+	v.previous = m
+	v.numMeasure++
+	return nil
+}
+
+func (v *validator) closeStandstill(seconds float64) {
+	v.standing = false
+	if seconds-v.standStart >= ValidationZeroSpeedSeconds {
+		v.standstills = append(v.standstills, timeSpan{startSeconds: v.standStart, seconds: seconds - v.standStart})
+	}
+}
+
+func (v *validator) finish() {
+	for _, run := range v.stuck {
+		run.close()
+	}
+	if v.standing {
+		v.closeStandstill(v.previous.RelativeTime)
+	}
+	if v.numMeasure > 0 {
+		v.lapEnds[v.previous.TrackAddictLap] = v.previous.RelativeTime
+	}
+}
+
+// ValidateSession streams the input file of the config and checks the quality of its data: the timing of the samples
+// and GPS fixes, the accuracy, gaps, stuck sensors, standstills and the lap markers.
+func ValidateSession(ctx context.Context, config DataConfig) (*ValidationReport, error) {
+	// the data is checked as it was recorded
+	config.UseSmoothedGPSData = false
+	v := newValidator()
+	err := StreamData(ctx, config, StreamCallbacks{
+		TrackInformation: func(info *TrackInformation) error {
+			v.trackInfo = info
+			return nil
+		},
+		Measurement: v.measurement,
+		Event: func(event Event) error {
+			if event.Type == LapEvent {
+				v.lapEvents = append(v.lapEvents, event)
+			}
+			return nil
+		},
+		Lap: func(lap Lap) error {
+			v.laps = append(v.laps, lap)
+			return nil
+		},
+		PitVisit: func(visit PitVisit) error {
+			v.pitVisits = append(v.pitVisits, visit)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", config.InputFile, err)
+	}
+	v.finish()
+	if v.numMeasure == 0 {
+		return nil, fmt.Errorf("%s: the session has no measurements", config.InputFile)
+	}
+
+	report := &ValidationReport{InputFile: config.InputFile, Status: ValidationPass}
+	report.Checks = []ValidationCheck{
+		v.checkSampleRate(),
+		v.checkGPSRate(),
+		v.checkAccuracy(),
+		v.checkTimestamps(),
+		v.checkGaps(),
+		v.checkDropouts(),
+		v.checkStuckSensors(),
+		v.checkStandstills(),
+		v.checkTopSpeed(),
+		v.checkLapMarkers(),
+	}
+	for _, check := range report.Checks {
+		report.Status = worseValidationStatus(report.Status, check.Status)
+	}
+	return report, nil
+}
+
+// ValidateSessions validates several input files in parallel, the reports are in the order of the files.
+func ValidateSessions(ctx context.Context, config DataConfig, inputFiles []string) ([]*ValidationReport, error) {
+	reports := make([]*ValidationReport, len(inputFiles))
+	err := forEachInputFile(ctx, inputFiles, func(ctx context.Context, i int, inputFile string) error {
+		fileConfig := config
+		fileConfig.InputFile = inputFile
+		report, err := ValidateSession(ctx, fileConfig)
+		if err != nil {
+			return err
+		}
+		reports[i] = report
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (v *validator) duration() float64 {
+	return v.previous.RelativeTime - v.firstTime
+}
+
+func (v *validator) checkSampleRate() ValidationCheck {
+	check := ValidationCheck{Name: "Sample Rate", Status: ValidationPass}
+	if len(v.intervals) == 0 {
+		check.Status = ValidationFail
+		check.Summary = "the session has a single sample"
+		return check
+	}
+	interval := median(v.intervals)
+	// gaps are checked on their own, they would dominate the jitter
+	var jitter runningStdDev
+	for _, dt := range v.intervals {
+		if dt < 10*interval {
+			jitter.add(dt)
+		}
+	}
+	check.Values = map[string]float64{
+		"sampleRateHz":     1 / interval,
+		"medianIntervalMs": interval * 1000,
+		"jitterMs":         jitter.stddev() * 1000,
+	}
+	check.Summary = fmt.Sprintf("%.1f Hz, the intervals vary by %.1f ms", 1/interval, jitter.stddev()*1000)
+	if jitter.stddev() > interval*ValidationMaxJitterFraction {
+		check.Status = ValidationWarn
+		check.Summary += fmt.Sprintf(", more than %.0f%% of the interval", ValidationMaxJitterFraction*100)
+	}
+	return check
+}
+
+func (v *validator) checkGPSRate() ValidationCheck {
+	check := ValidationCheck{Name: "GPS Update Rate", Status: ValidationPass}
+	if v.numFixes < 2 {
+		check.Status = ValidationFail
+		check.Summary = fmt.Sprintf("%d GPS fixes, the GPS_Update column never changes", v.numFixes)
+		return check
+	}
+	rate := 1 / median(v.fixIntervals)
+	check.Values = map[string]float64{
+		"gpsRateHz":        rate,
+		"gpsFixes":         float64(v.numFixes),
+		"samplesPerGPSFix": float64(v.numMeasure) / float64(v.numFixes),
+	}
+	check.Summary = fmt.Sprintf("%.1f Hz from %d GPS fixes", rate, v.numFixes)
+	// the fixes of phones don't arrive exactly in time, so the rates may be 10% lower
+	if rate < 0.9 {
+		check.Status = ValidationFail
+		check.Summary += ", too few to time laps"
+	} else if rate < ValidationMinGPSRateHz*0.9 {
+		check.Status = ValidationWarn
+		check.Summary += fmt.Sprintf(", below %.0f Hz laps are timed less precisely", ValidationMinGPSRateHz)
+	}
+	return check
+}
+
+func (v *validator) checkAccuracy() ValidationCheck {
+	check := ValidationCheck{Name: "GPS Accuracy", Status: ValidationPass}
+	if len(v.accuracies) == 0 {
+		check.Status = ValidationFail
+		check.Summary = "no GPS fixes"
+		return check
+	}
+	sorted := make([]float64, len(v.accuracies))
+	copy(sorted, v.accuracies)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		return sorted[Min(len(sorted)-1, int(p*float64(len(sorted))))]
+	}
+	check.Values = map[string]float64{
+		"medianMeters": percentile(0.5),
+		"p90Meters":    percentile(0.9),
+		"maxMeters":    sorted[len(sorted)-1],
+	}
+
+	// the distribution as the share of the fixes per accuracy range
+	bounds := []float64{2, 5, 10, 20, math.Inf(1)}
+	counts := make([]int, len(bounds))
+	for _, accuracy := range sorted {
+		for i, bound := range bounds {
+			if accuracy < bound {
+				counts[i]++
+				break
+			}
+		}
+	}
+	lower := 0.0
+	for i, bound := range bounds {
+		share := float64(counts[i]) / float64(len(sorted))
+		name := fmt.Sprintf("%.0f-%.0f m", lower, bound)
+		key := fmt.Sprintf("share%.0fTo%.0fMeters", lower, bound)
+		if math.IsInf(bound, 1) {
+			name = fmt.Sprintf("over %.0f m", lower)
+			key = fmt.Sprintf("shareOver%.0fMeters", lower)
+		}
+		check.Values[key] = share
+		check.Findings = append(check.Findings, fmt.Sprintf("%s: %.1f%% of the fixes", name, share*100))
+		lower = bound
+	}
+
+	check.Summary = fmt.Sprintf("median %.1f m, 90%% within %.1f m", percentile(0.5), percentile(0.9))
+	if percentile(0.5) > 2*ValidationMaxAccuracyMeters {
+		check.Status = ValidationFail
+	} else if percentile(0.9) > ValidationMaxAccuracyMeters {
+		check.Status = ValidationWarn
+	}
+	return check
+}
+
+func (v *validator) checkTimestamps() ValidationCheck {
+	check := ValidationCheck{Name: "Timestamps", Status: ValidationPass, Summary: "the time always advances"}
+	check.Values = map[string]float64{"backwards": float64(len(v.backwards)), "repeated": float64(len(v.repeated))}
+	switch {
+	case len(v.backwards) > 0:
+		check.Status = ValidationFail
+		check.Summary = fmt.Sprintf("the time goes back in %s", pluralize(len(v.backwards), "place"))
+	case len(v.repeated) > 0:
+		check.Status = ValidationWarn
+		check.Summary = fmt.Sprintf("%s repeat the timestamp before", pluralize(len(v.repeated), "sample"))
+	}
+	check.Findings = limitValidationFindings(append(append([]string(nil), v.backwards...), v.repeated...))
+	return check
+}
+
+func (v *validator) checkGaps() ValidationCheck {
+	check := ValidationCheck{Name: "Time Gaps", Status: ValidationPass, Summary: "no gaps between samples"}
+	minGap := ValidationMinGapSeconds
+	if len(v.intervals) > 0 {
+		minGap = math.Max(minGap, 10*median(v.intervals))
+	}
+	gaps := filterTimeSpans(v.longGaps, minGap)
+	total := 0.0
+	var findings []string
+	for _, gap := range gaps {
+		total += gap.seconds
+		findings = append(findings, fmt.Sprintf("no samples for %s after %s", secondsToDuration(gap.seconds),
+			secondsToDuration(gap.startSeconds)))
+	}
+	check.Values = map[string]float64{"gaps": float64(len(gaps)), "gapSeconds": total}
+	if len(gaps) > 0 {
+		check.Status = ValidationWarn
+		check.Summary = fmt.Sprintf("%s with %s without samples", pluralize(len(gaps), "gap"), secondsToDuration(total))
+		check.Findings = limitValidationFindings(findings)
+	}
+	return check
+}
+
+func (v *validator) checkDropouts() ValidationCheck {
+	check := ValidationCheck{Name: "GPS Dropouts", Status: ValidationPass, Summary: "no dropouts"}
+	minDropout := ValidationMinGapSeconds
+	if len(v.fixIntervals) > 0 {
+		minDropout = math.Max(minDropout, 3*median(v.fixIntervals))
+	}
+	dropouts := filterTimeSpans(v.fixGaps, minDropout)
+	total, longest := 0.0, 0.0
+	var findings []string
+	for _, dropout := range dropouts {
+		total += dropout.seconds
+		longest = math.Max(longest, dropout.seconds)
+		findings = append(findings, fmt.Sprintf("no GPS fix for %s after %s", secondsToDuration(dropout.seconds),
+			secondsToDuration(dropout.startSeconds)))
+	}
+	check.Values = map[string]float64{"dropouts": float64(len(dropouts)), "dropoutSeconds": total, "longestSeconds": longest}
+	if len(dropouts) > 0 {
+		check.Status = ValidationWarn
+		check.Summary = fmt.Sprintf("%s with %s without GPS, the longest %s", pluralize(len(dropouts), "dropout"),
+			secondsToDuration(total), secondsToDuration(longest))
+		check.Findings = limitValidationFindings(findings)
+		if v.duration() > 0 && total/v.duration() > ValidationMaxDropoutFraction {
+			check.Status = ValidationFail
+		}
+	}
+	return check
+}
+
+func (v *validator) checkStuckSensors() ValidationCheck {
+	check := ValidationCheck{Name: "Stuck Sensors", Status: ValidationPass, Summary: "all sensors change while moving",
+		Values: map[string]float64{}}
+	var findings, stuckNames []string
+	for _, run := range v.stuck {
+		if !run.changed && run.value == 0 {
+			// a channel that is 0 throughout isn't recorded by the logger, like the Accel Z of most exports
+			continue
+		}
+		total := 0.0
+		for _, span := range run.stuck {
+			total += span.seconds
+			// the value of the position is a mix of both coordinates that means nothing on its own
+			value := fmt.Sprintf(" at %g", span.value)
+			if run.name == "Position" {
+				value = ""
+			}
+			findings = append(findings, fmt.Sprintf("%s stuck%s for %s after %s", run.name, value,
+				secondsToDuration(span.seconds), secondsToDuration(span.startSeconds)))
+		}
+		key := strings.Replace(run.name, " ", "", -1)
+		check.Values[strings.ToLower(key[:1])+key[1:]+"StuckSeconds"] = total
+		if !run.changed {
+			stuckNames = append(stuckNames, run.name+" (never changes)")
+		} else if len(run.stuck) > 0 {
+			stuckNames = append(stuckNames, run.name)
+		}
+	}
+	if len(stuckNames) > 0 {
+		check.Status = ValidationWarn
+		check.Summary = "stuck while moving: " + strings.Join(stuckNames, ", ")
+		check.Findings = limitValidationFindings(findings)
+	}
+	return check
+}
+
+func (v *validator) checkStandstills() ValidationCheck {
+	check := ValidationCheck{Name: "Zero Speed", Status: ValidationPass}
+	total := 0.0
+	var findings []string
+	for _, standstill := range v.standstills {
+		total += standstill.seconds
+		findings = append(findings, fmt.Sprintf("standing still for %s after %s", secondsToDuration(standstill.seconds),
+			secondsToDuration(standstill.startSeconds)))
+	}
+	check.Values = map[string]float64{"standstills": float64(len(v.standstills)), "standstillSeconds": total}
+	check.Summary = fmt.Sprintf("%s of %s in total", pluralize(len(v.standstills), "standstill"), secondsToDuration(total))
+	check.Findings = limitValidationFindings(findings)
+	if v.duration() > 0 && total/v.duration() > 0.5 {
+		check.Status = ValidationWarn
+		check.Summary += ", the car stood still most of the time"
+	}
+	return check
+}
+
+// checkTopSpeed fails sessions that were never driven on the track, which is faster than the pit lane.
+func (v *validator) checkTopSpeed() ValidationCheck {
+	check := ValidationCheck{Name: "Top Speed", Status: ValidationPass,
+		Summary: fmt.Sprintf("%.1f km/h", v.topSpeedKph), Values: map[string]float64{"topSpeedKph": v.topSpeedKph}}
+	if v.topSpeedKph < PitLaneMaxSpeedKph {
+		check.Status = ValidationFail
+		check.Summary += fmt.Sprintf(", the car never got faster than %.0f km/h", PitLaneMaxSpeedKph)
+	}
+	return check
+}
+
+func (v *validator) checkLapMarkers() ValidationCheck {
+	check := ValidationCheck{Name: "Lap Markers", Status: ValidationPass}
+	findings := append([]string(nil), v.lapFindings...)
+
+	// the annotations are numbered from 0 and have the time of the Lap column
+	for i, event := range v.lapEvents {
+		expected := i
+		if i > 0 {
+			expected = v.lapEvents[i-1].LapNumber + 1
+		}
+		if event.LapNumber != expected {
+			findings = append(findings, fmt.Sprintf("the annotation of lap %d follows the one of lap %d", event.LapNumber, expected-1))
+		}
+		start, hasStart := v.lapStarts[event.LapNumber]
+		end, hasEnd := v.lapEnds[event.LapNumber]
+		if hasStart && hasEnd && math.Abs(end-start-event.LapTime.Seconds()) > ValidationLapMarkerToleranceSeconds {
+			findings = append(findings, fmt.Sprintf("lap %d is annotated with %s but the Lap column has %s",
+				event.LapNumber, event.LapTime, secondsToDuration(end-start)))
+		}
+	}
+
+	// on a circuit the laps change at the start/finish
+	var startFinish *LatLng
+	if v.trackInfo != nil && v.trackInfo.Track != nil && v.trackInfo.Track.Finish == nil {
+		center := v.trackInfo.Track.StartFinish.Center()
+		startFinish = &center
+	} else if v.trackInfo != nil && v.trackInfo.StartLatLng != nil {
+		startFinish = v.trackInfo.StartLatLng
+	}
+	if startFinish != nil {
+		fixInterval := 0.0
+		if len(v.fixIntervals) > 0 {
+			fixInterval = median(v.fixIntervals)
+		}
+		for _, m := range v.lapChanges {
+			// the lap changes at the first sample across the line, which is a fix interval late at most
+			maxDistance := ValidationLapMarkerDistanceMeters + m.SpeedKph/3.6*fixInterval
+			if distance := haversineDistance(*startFinish, m.LatLng); distance > maxDistance {
+				findings = append(findings, fmt.Sprintf("lap %d starts %.0f m away from the start/finish at %s",
+					m.TrackAddictLap, distance, secondsToDuration(m.RelativeTime)))
+			}
+		}
+	}
+
+	var track *Track
+	if v.trackInfo != nil {
+		track = v.trackInfo.Track
+	}
+	laps := ClassifyLaps(v.laps, v.pitVisits, track)
+	for i, lap := range laps {
+		if lap.Type == FlyingLap && !lap.Valid {
+			findings = append(findings, fmt.Sprintf("lap %s is %s: %s", lapNumberFormat(i, lap), lap.InvalidReason, lap.Time))
+		}
+	}
+
+	check.Values = map[string]float64{"laps": float64(len(laps)), "annotatedLaps": float64(len(v.lapEvents)),
+		"suspicious": float64(len(findings))}
+	check.Summary = fmt.Sprintf("%s, %d annotated", pluralize(len(laps), "lap"), len(v.lapEvents))
+	if len(findings) > 0 {
+		check.Status = ValidationWarn
+		check.Summary += fmt.Sprintf(", %d suspicious", len(findings))
+		check.Findings = limitValidationFindings(findings)
+	}
+	return check
+}
+
+func filterTimeSpans(spans []timeSpan, minSeconds float64) []timeSpan {
+	var filtered []timeSpan
+	for _, span := range spans {
+		if span.seconds >= minSeconds {
+			filtered = append(filtered, span)
+		}
+	}
+	return filtered
+}
+
+func limitValidationFindings(findings []string) []string {
+	if len(findings) <= maxValidationFindings {
+		return findings
+	}
+	return append(findings[:maxValidationFindings:maxValidationFindings],
+		fmt.Sprintf("and %d more", len(findings)-maxValidationFindings))
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+func worseValidationStatus(a ValidationStatus, b ValidationStatus) ValidationStatus {
+	rank := map[ValidationStatus]int{ValidationPass: 0, ValidationWarn: 1, ValidationFail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// PrettyPrintValidationReport prints the checks as a table followed by their findings and the summary.
+func PrettyPrintValidationReport(report *ValidationReport) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Check", "Status", "Result"})
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	counts := map[ValidationStatus]int{}
+	for _, check := range report.Checks {
+		table.Append([]string{check.Name, strings.ToUpper(string(check.Status)), check.Summary})
+		counts[check.Status]++
+	}
+	table.Render()
+
+	for _, check := range report.Checks {
+		if len(check.Findings) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", check.Name)
+		for _, finding := range check.Findings {
+			fmt.Printf("  - %s\n", finding)
+		}
+	}
+	fmt.Printf("Summary: %s, %d passed, %s, %d failed\n", strings.ToUpper(string(report.Status)),
+		counts[ValidationPass], pluralize(counts[ValidationWarn], "warning"), counts[ValidationFail])
+}
@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// validateTestSample is a row of a 10 Hz TrackAddict session with a GPS fix in every row.
+type validateTestSample struct {
+	seconds float64
+	gps     bool
+	speed   float64
+	accelX  float64
+}
+
+// validateTestSession writes 20 seconds of driving at about 100 km/h, every sensor changes with every row unless the
+// sample function changes the row.
+func validateTestSession(t *testing.T, sample func(i int, s *validateTestSample)) string {
+	var csv strings.Builder
+	csv.WriteString(testTrackAddictHeader)
+	for i := 0; i < 200; i++ {
+		s := validateTestSample{seconds: float64(i) / 10, gps: true, speed: 100 + float64(i%3), accelX: float64(i%7) / 100}
+		if sample != nil {
+			sample(i, &s)
+		}
+		gps := 0
+		if s.gps {
+			gps = 1
+		}
+		fmt.Fprintf(&csv, "%.3f,%.3f,0,0,0,%d,0.000,%.7f,%.7f,91.1,299,%.1f,90.0,3.0,%.2f,%.2f,%.2f,0,100.44,74.1\n",
+			s.seconds, 1559734111+s.seconds, gps, 50.1+float64(i)*1e-5, 12.2, s.speed, s.accelX, float64(i%5)/100,
+			1+float64(i%3)/100)
+	}
+	return writeTestSession(t, csv.String())
+}
+
+func TestValidateSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample func(i int, s *validateTestSample)
+		// checks are the statuses of the checks that don't pass
+		checks map[string]ValidationStatus
+		status ValidationStatus
+	}{
+		{"clean", nil, nil, ValidationPass},
+		{"short dropout", func(i int, s *validateTestSample) {
+			s.gps = s.gps && (i < 50 || i >= 65)
+		}, map[string]ValidationStatus{"GPS Dropouts": ValidationWarn}, ValidationWarn},
+		{"long dropout", func(i int, s *validateTestSample) {
+			s.gps = s.gps && (i < 50 || i >= 150)
+		}, map[string]ValidationStatus{"GPS Dropouts": ValidationFail}, ValidationFail},
+		{"time goes back", func(i int, s *validateTestSample) {
+			if i == 100 {
+				s.seconds = 9.85
+			}
+		}, map[string]ValidationStatus{"Timestamps": ValidationFail}, ValidationFail},
+		{"repeated timestamp", func(i int, s *validateTestSample) {
+			if i == 100 {
+				s.seconds = 9.9
+			}
+		}, map[string]ValidationStatus{"Timestamps": ValidationWarn}, ValidationWarn},
+		{"gap", func(i int, s *validateTestSample) {
+			if i >= 100 {
+				s.seconds += 3
+			}
+		}, map[string]ValidationStatus{"Time Gaps": ValidationWarn}, ValidationWarn},
+		{"stuck sensor", func(i int, s *validateTestSample) {
+			if i >= 50 && i < 150 {
+				s.accelX = 0.5
+			}
+		}, map[string]ValidationStatus{"Stuck Sensors": ValidationWarn}, ValidationWarn},
+		// standing still is no sensor failure, even though nothing changes
+		{"standing most of the time", func(i int, s *validateTestSample) {
+			if i >= 50 {
+				s.speed = 0
+			}
+		}, map[string]ValidationStatus{"Zero Speed": ValidationWarn}, ValidationWarn},
+		{"never on the track", func(i int, s *validateTestSample) {
+			s.speed = 40 + float64(i%3)
+		}, map[string]ValidationStatus{"Top Speed": ValidationFail}, ValidationFail},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inputFile := validateTestSession(t, test.sample)
+			defer os.Remove(inputFile)
+
+			report, err := ValidateSession(context.Background(), DataConfig{InputFile: inputFile})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, check := range report.Checks {
+				expected, ok := test.checks[check.Name]
+				if !ok {
+					expected = ValidationPass
+				}
+				if check.Status != expected {
+					t.Errorf("expected %s to %s, got %s: %s %v", check.Name, expected, check.Status, check.Summary, check.Findings)
+				}
+			}
+			if report.Status != test.status {
+				t.Errorf("expected the session to %s, got %s", test.status, report.Status)
+			}
+		})
+	}
+}
+
+func TestValidateSessionFindings(t *testing.T) {
+	inputFile := validateTestSession(t, func(i int, s *validateTestSample) {
+		s.gps = s.gps && (i < 50 || i >= 65)
+		if i >= 100 && i < 160 {
+			s.accelX = 0.5
+		}
+	})
+	defer os.Remove(inputFile)
+
+	report, err := ValidateSession(context.Background(), DataConfig{InputFile: inputFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"GPS Dropouts":  "no GPS fix for 1.6s after 4.9s",
+		"Stuck Sensors": "Accel X stuck at 0.5 for 5.9s after 10s",
+	}
+	for _, check := range report.Checks {
+		finding, ok := expected[check.Name]
+		if ok && (len(check.Findings) != 1 || check.Findings[0] != finding) {
+			t.Errorf("%s: expected the finding %q, got %v", check.Name, finding, check.Findings)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatVBO = "vbo"
+	// VBOSatelliteAccuracyMeters estimates the accuracy of a VBOX fix, which only records the number of satellites:
+	// a fix with n satellites is taken to be accurate to VBOSatelliteAccuracyMeters / n meters.
+	VBOSatelliteAccuracyMeters = 40.0
+	// vboSatelliteFlags are set on top of the number of satellites for brake trigger and DGPS fixes
+	vboSatelliteFlags = 64 | 128
+)
+
+var vboCreatedRegex = regexp.MustCompile(`^File created on (\d+)/(\d+)/(\d+)`)
+
+// vboParser reads the Racelogic VBOX text format. Positions are in minutes with positive longitudes to the west. The
+// logger is mounted in the car, so its longitudinal and lateral accelerations are the X and Y of the device axes.
+type vboParser struct {
+	callbacks     StreamCallbacks
+	trackInfo     TrackInformation
+	sessionInfo   *SessionInfo
+	section       string
+	headerNames   []string
+	columns       map[string]int
+	date          time.Time
+	dayOffset     float64
+	lastSeconds   float64
+	firstUTC      float64
+	trackInfoSent bool
+	measureIndex  int
+	lineCount     int
+}
+
+func streamVBO(ctx context.Context, reader io.Reader, callbacks StreamCallbacks) error {
+	parser := &vboParser{callbacks: callbacks, sessionInfo: newSessionInfo()}
+	parser.sessionInfo.App = "VBOX"
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := parser.parseLine(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return parser.emitTrackInformation()
+}
+
+func (p *vboParser) parseLine(line string) error {
+	defer func() { p.lineCount++ }()
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		p.section = strings.ToLower(line)
+		return nil
+	}
+
+	switch p.section {
+	case "":
+		if matches := vboCreatedRegex.FindStringSubmatch(line); matches != nil {
+			columns := &columnParser{fields: matches[1:], lineCount: p.lineCount}
+			day, month, year := columns.int(0, "day"), columns.int(1, "month"), columns.int(2, "year")
+			if columns.err != nil {
+				return columns.err
+			}
+			p.date = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+		}
+		p.sessionInfo.HeaderComments = append(p.sessionInfo.HeaderComments, "# "+line)
+	case "[header]":
+		p.headerNames = append(p.headerNames, line)
+	case "[comments]":
+		p.sessionInfo.HeaderComments = append(p.sessionInfo.HeaderComments, "# "+line)
+	case "[laptiming]":
+		return p.parseLapTiming(line)
+	case "[column names]":
+		p.setColumns(strings.Fields(line))
+	case "[data]":
+		return p.parseData(line)
+	}
+	return nil
+}
+
+// parseLapTiming takes the start/finish point from the "Start" line, which has two points in minutes as long lat long lat.
+func (p *vboParser) parseLapTiming(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || !strings.EqualFold(fields[0], "Start") {
+		return nil
+	}
+	var values [4]float64
+	for i := range values {
+		value, err := strconv.ParseFloat(fields[i+1], 64)
+		if err != nil {
+			return fmt.Errorf("can't parse the start line %d of the vbo file: %v", p.lineCount, err)
+		}
+		values[i] = value
+	}
+	gate := Gate{A: vboLatLng(values[1], values[0]), B: vboLatLng(values[3], values[2])}
+	center := gate.Center()
+	p.trackInfo.StartLatLng = &center
+	return nil
+}
+
+func (p *vboParser) setColumns(names []string) {
+	p.columns = map[string]int{}
+	p.sessionInfo.Channels = names
+	for i, name := range names {
+		if channel := vboChannel(name); channel != "" {
+			if _, ok := p.columns[channel]; !ok {
+				p.columns[channel] = i
+			}
+		}
+	}
+}
+
+func (p *vboParser) parseData(line string) error {
+	if p.columns == nil {
+		// old files only list the channels in the header, in the order of the columns
+		p.setColumns(p.headerNames)
+	}
+	for _, channel := range []string{"time", "lat", "long"} {
+		if _, ok := p.columns[channel]; !ok {
+			return fmt.Errorf("the vbo file has no %s channel", channel)
+		}
+	}
+
+	fields := strings.Fields(line)
+	value := func(channel string) (float64, error) {
+		i, ok := p.columns[channel]
+		if !ok {
+			return 0, nil
+		}
+		if i >= len(fields) {
+			return 0, fmt.Errorf("not enough columns in line %d", p.lineCount)
+		}
+		return strconv.ParseFloat(fields[i], 64)
+	}
+	values := map[string]float64{}
+	for channel := range p.columns {
+		v, err := value(channel)
+		if err != nil {
+			return fmt.Errorf("can't parse %s in line %d: %v", channel, p.lineCount, err)
+		}
+		values[channel] = v
+	}
+
+	// the time is hhmmss.ss of the UTC day, it wraps around at midnight
+	hhmmss := values["time"]
+	seconds := math.Floor(hhmmss/10000)*3600 + math.Floor(math.Mod(hhmmss, 10000)/100)*60 + math.Mod(hhmmss, 100)
+	if p.measureIndex > 0 && seconds+p.dayOffset < p.lastSeconds-12*3600 {
+		p.dayOffset += 24 * 3600
+	}
+	seconds += p.dayOffset
+	p.lastSeconds = seconds
+	utc := float64(p.date.Unix()) + seconds
+	if p.measureIndex == 0 {
+		p.firstUTC = utc
+	}
+
+	accuracy := VBOSatelliteAccuracyMeters / 4
+	if sats := int(values["sats"]) &^ vboSatelliteFlags; sats > 0 {
+		accuracy = VBOSatelliteAccuracyMeters / float64(sats)
+	}
+	measure := GPSMeasurement{
+		RelativeTime:   utc - p.firstUTC,
+		UTCTimestamp:   utc,
+		LatLng:         vboLatLng(values["lat"], values["long"]),
+		AltitudeMeters: values["height"],
+		SpeedKph:       values["velocity"],
+		HeadingDegrees: values["heading"],
+		AccuracyMeters: accuracy,
+		Acceleration:   Acceleration{X: values["longacc"], Y: values["latacc"]},
+		GPSUpdate:      true,
+	}
+
+	if !p.trackInfoSent {
+		p.sessionInfo.StartTime = measure.Time()
+		if err := p.emitTrackInformation(); err != nil {
+			return err
+		}
+	}
+	index := p.measureIndex
+	p.measureIndex++
+	if p.callbacks.Measurement != nil {
+		return p.callbacks.Measurement(index, measure)
+	}
+	return nil
+}
+
+func (p *vboParser) emitTrackInformation() error {
+	if p.trackInfoSent {
+		return nil
+	}
+	p.trackInfoSent = true
+	if p.callbacks.SessionInfo != nil {
+		if err := p.callbacks.SessionInfo(p.sessionInfo); err != nil {
+			return err
+		}
+	}
+	if p.callbacks.TrackInformation != nil {
+		info := p.trackInfo
+		return p.callbacks.TrackInformation(&info)
+	}
+	return nil
+}
+
+// vboChannel maps the many spellings of the VBOX channels to the ones we read, unknown channels map to "".
+func vboChannel(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer(" ", "", "-", "", "_", "", ".", "").Replace(name)
+	switch {
+	case strings.HasPrefix(name, "sat"):
+		return "sats"
+	case name == "time" || name == "utctime":
+		return "time"
+	case name == "lat" || name == "latitude":
+		return "lat"
+	case name == "long" || name == "lon" || name == "longitude":
+		return "long"
+	case strings.HasPrefix(name, "velocity") || name == "speed" || name == "speedkmh":
+		return "velocity"
+	case name == "heading":
+		return "heading"
+	case name == "height" || name == "altitude":
+		return "height"
+	case strings.HasPrefix(name, "longacc") || strings.HasPrefix(name, "longitudinalacc"):
+		return "longacc"
+	case strings.HasPrefix(name, "latacc") || strings.HasPrefix(name, "lateralacc"):
+		return "latacc"
+	}
+	return ""
+}
+
+// vboLatLng converts the minutes of the VBOX format, whose longitudes are positive to the west.
+func vboLatLng(latMinutes float64, longMinutes float64) LatLng {
+	return LatLng{Lat: latMinutes / 60, Lng: -longMinutes / 60}
+}
+
+// writeVBO writes the session in the VBOX text format that Circuit Tools and VBOX Test Suite open. The number of
+// satellites is estimated from the accuracy, the start/finish and sector gates become the lap timing lines and the
+// longitudinal and lateral g are computed from the GPS speed and heading like in the MoTeC export.
+func writeVBO(data *TrackData, config ExportConfig, w io.Writer) error {
+	measures := data.Measures(config.DataConfig)
+	start := time.Unix(0, 0).UTC()
+	if len(measures) > 0 {
+		start = measures[0].Time()
+	}
+
+	lines := []string{
+		fmt.Sprintf("File created on %s at %s", start.Format("02/01/2006"), start.Format("15:04:05")),
+		"",
+		"[header]",
+		"satellites", "time", "latitude", "longitude", "velocity kmh", "heading", "height", "long accel g", "lat accel g",
+		"",
+		"[channel units]",
+		"", "", "min", "min", "km/h", "deg", "m", "g", "g",
+		"",
+		"[comments]",
+		fmt.Sprintf("Converted by trackaddict-cli from %s", filepath.Base(config.InputFile)),
+		"",
+	}
+	if track := data.TrackInformation.Track; track != nil {
+		lines = append(lines, "[laptiming]", vboGateLine("Start", track.StartFinish, "Start / Finish"))
+		for i, gate := range track.Sectors {
+			lines = append(lines, vboGateLine("Split", gate, fmt.Sprintf("Split %d", i+1)))
+		}
+		if track.Finish != nil {
+			lines = append(lines, vboGateLine("Finish", *track.Finish, "Finish"))
+		}
+		lines = append(lines, "")
+	}
+	lines = append(lines, "[column names]", "sats time lat long velocity heading height longacc latacc", "", "[data]")
+	if err := writeReplayLines(w, lines); err != nil {
+		return err
+	}
+
+	seconds := make([]float64, len(measures))
+	for i, m := range measures {
+		seconds[i] = m.RelativeTime
+	}
+	longitudinal, lateral := gpsGForces(measures, seconds)
+	for i, m := range measures {
+		sats := 4
+		if m.AccuracyMeters > 0 {
+			sats = Max(3, Min(30, int(math.Round(VBOSatelliteAccuracyMeters/m.AccuracyMeters))))
+		}
+		t := m.Time().Round(10 * time.Millisecond)
+		hhmmss := float64(t.Hour()*10000+t.Minute()*100+t.Second()) + float64(t.Nanosecond())/1e9
+		line := fmt.Sprintf("%03d %09.2f %s %s %07.3f %06.2f %+09.2f %+06.2f %+06.2f", sats, hhmmss,
+			vboMinutes(m.LatLng.Lat), vboMinutes(-m.LatLng.Lng), m.SpeedKph, m.HeadingDegrees, m.AltitudeMeters,
+			longitudinal[i], lateral[i])
+		if err := writeReplayLines(w, []string{line}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func vboGateLine(kind string, gate Gate, name string) string {
+	return fmt.Sprintf("%s %s %s %s %s ¬ %s", kind, vboMinutes(-gate.A.Lng), vboMinutes(gate.A.Lat),
+		vboMinutes(-gate.B.Lng), vboMinutes(gate.B.Lat), name)
+}
+
+func vboMinutes(degrees float64) string {
+	return fmt.Sprintf("%+012.5f", degrees*60)
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStreamVBO(t *testing.T) {
+	vbo := `File created on 05/06/2019 at 11:48:31
+
+[header]
+satellites
+time
+latitude
+longitude
+velocity kmh
+heading
+height
+long accel g
+lat accel g
+
+[column names]
+sats time lat long velocity heading height longacc latacc
+
+[data]
+009 114831.00 +03119.95969 -00821.29005 000.000 000.00 +00091.10 +00.00 +00.00
+074 114831.10 +03119.95970 -00821.29007 012.500 090.00 +00091.20 +00.25 -00.50
+010 235959.90 +03119.95970 -00821.29007 012.500 090.00 +00091.20 +00.00 +00.00
+010 000000.10 +03119.95970 -00821.29007 012.500 090.00 +00091.20 +00.00 +00.00
+`
+	var measures []GPSMeasurement
+	err := streamVBO(context.Background(), strings.NewReader(vbo), StreamCallbacks{
+		Measurement: func(index int, m GPSMeasurement) error {
+			measures = append(measures, m)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measures) != 4 {
+		t.Fatalf("expected 4 measurements, got %d", len(measures))
+	}
+
+	tests := []struct {
+		name         string
+		measure      GPSMeasurement
+		relativeTime float64
+		accuracy     float64
+	}{
+		{"first", GPSMeasurement{LatLng: LatLng{Lat: 51.9993282, Lng: 13.6881675}, AltitudeMeters: 91.1}, 0, 40.0 / 9},
+		// the brake trigger flag is set on top of the 10 satellites
+		{"accelerations", GPSMeasurement{LatLng: LatLng{Lat: 51.9993283, Lng: 13.6881678}, AltitudeMeters: 91.2, SpeedKph: 12.5,
+			HeadingDegrees: 90, Acceleration: Acceleration{X: 0.25, Y: -0.5}}, 0.1, 40.0 / 10},
+		{"before midnight", GPSMeasurement{LatLng: LatLng{Lat: 51.9993283, Lng: 13.6881678}, AltitudeMeters: 91.2, SpeedKph: 12.5,
+			HeadingDegrees: 90}, 12*3600 + 11*60 + 28.9, 40.0 / 10},
+		{"after midnight", GPSMeasurement{LatLng: LatLng{Lat: 51.9993283, Lng: 13.6881678}, AltitudeMeters: 91.2, SpeedKph: 12.5,
+			HeadingDegrees: 90}, 12*3600 + 11*60 + 29.1, 40.0 / 10},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := measures[i]
+			if !closeTo(m.RelativeTime, test.relativeTime) || !closeTo(m.AccuracyMeters, test.accuracy) ||
+				math.Abs(m.LatLng.Lat-test.measure.LatLng.Lat) > 1e-7 || math.Abs(m.LatLng.Lng-test.measure.LatLng.Lng) > 1e-7 ||
+				m.AltitudeMeters != test.measure.AltitudeMeters || m.SpeedKph != test.measure.SpeedKph ||
+				m.HeadingDegrees != test.measure.HeadingDegrees || m.Acceleration != test.measure.Acceleration || !m.GPSUpdate {
+				t.Errorf("expected %+v at %.1f, got %+v", test.measure, test.relativeTime, m)
+			}
+		})
+	}
+}
+
+func TestExportVBORoundTrip(t *testing.T) {
+	config := DataConfig{InputFile: "../example/STC_log.csv", RecalculateLaps: true}
+	data, err := ReadData(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteExport(data, ExportConfig{DataConfig: config, Format: ExportFormatVBO}, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "trackaddict-vbo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	vboFile := filepath.Join(dir, "session.vbo")
+	if err := ioutil.WriteFile(vboFile, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := ReadData(DataConfig{InputFile: vboFile, RecalculateLaps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Laps) != 11 || len(reread.Laps) != len(data.Laps) {
+		t.Fatalf("expected 11 laps in both sessions, got %d and %d", len(data.Laps), len(reread.Laps))
+	}
+	// the vbo has the times in hundredths, the lap types may differ as it has no pit lane annotations
+	for i, lap := range reread.Laps {
+		if math.Abs(lap.Time.Seconds()-data.Laps[i].Time.Seconds()) > 0.02 {
+			t.Errorf("lap %d: expected %s, got %s", i, data.Laps[i].Time, lap.Time)
+		}
+	}
+}